@@ -103,6 +103,13 @@ type IRPCModule interface {
 	CallBroadcast(ctx context.Context, moduleType, _func string, params ...any)
 }
 
+// IActorModule 支持actor执行方式的模块(可选实现,通过类型断言使用;ModuleBase已实现)
+type IActorModule interface {
+	// 按actor key顺序执行(同一key依次执行,不同key并行)
+	RegisterActor(msg string, f interface{})
+	SetActorOptions(opts mqrpc.ActorOptions)
+}
+
 // IModuleServerSession Module服务会话代理
 type IModuleServerSession interface {
 	// 服务ID
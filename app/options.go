@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/cloudapex/river/mqrpc"
 	"github.com/cloudapex/river/registry"
 	"github.com/cloudapex/river/selector"
 	"github.com/cloudapex/river/selector/cache"
@@ -168,6 +169,9 @@ type Options struct {
 
 	ClientRPCHandler ClientRPCHook // 配置全局的RPC调用方监控器(nil)
 	ServerRPCHandler ServerRPCHook // 配置全局的RPC服务方监控器(nil)
+
+	ClientInterceptors []mqrpc.ClientInterceptor // 全局的RPC调用方拦截器链(按添加顺序由外到内)
+	ServerInterceptors []mqrpc.ServerInterceptor // 全局的RPC服务方拦截器链(按添加顺序由外到内)
 	//RpcCompleteHook RpcCompleteHook // 配置全局的RPC执行结果监控器(nil)
 
 	// 自定义日志文件名字(主要作用方便k8s映射日志不会被冲突，建议使用k8s pod实现)
@@ -293,6 +297,20 @@ func SetServerRPCHandler(t ServerRPCHook) Option {
 	}
 }
 
+// WithClientInterceptor 添加全局的RPC调用方拦截器
+func WithClientInterceptor(t ...mqrpc.ClientInterceptor) Option {
+	return func(o *Options) {
+		o.ClientInterceptors = append(o.ClientInterceptors, t...)
+	}
+}
+
+// WithServerInterceptor 添加全局的RPC服务方拦截器
+func WithServerInterceptor(t ...mqrpc.ServerInterceptor) Option {
+	return func(o *Options) {
+		o.ServerInterceptors = append(o.ServerInterceptors, t...)
+	}
+}
+
 // SetServerRPCCompleteHandler 服务RPC执行结果监控器
 // func SetRpcCompleteHook(t RpcCompleteHook) Option {
 // 	return func(o *Options) {
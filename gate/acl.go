@@ -0,0 +1,128 @@
+// Package gate topic访问控制
+package gate
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TopicRule 一条topic访问规则
+type TopicRule struct {
+	Topic    string            `json:"topic"`    // 完整topic、模块类型("chat"或"chat/*")或"*"
+	Guest    bool              `json:"guest"`    // 是否允许访客(未绑定userId)
+	Roles    []string          `json:"roles"`    // 允许的角色(session中TopicACL.RoleKey的值,空不限制)
+	Settings map[string]string `json:"settings"` // session中必须具有的设置(值为空时只要求存在)
+}
+
+// TopicACL 客户端topic访问控制(在gate转发之前检查)
+// 按 完整topic > 模块类型 > "*" 选择最匹配的一条规则,没有匹配的规则时允许(AllowModules限制仍然生效)
+type TopicACL struct {
+	AllowModules []string    `json:"allow_modules"` // 客户端可以访问的模块类型(空不限制)
+	Rules        []TopicRule `json:"rules"`
+	RoleKey      string      `json:"role_key"` // session中保存角色的key(默认"role")
+}
+
+// ParseTopicACL 解析settings中的访问控制配置(json对象)
+func ParseTopicACL(v any) (*TopicACL, error) {
+	acl := &TopicACL{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, acl)
+	return acl, err
+}
+
+// Match topic最匹配的规则(没有时返回nil),topic按转发时的解析规则规范为"moduleTyp/msgId"后匹配
+func (this *TopicACL) Match(topic string) *TopicRule {
+	if canon, err := CanonicalTopic(topic); err == nil {
+		topic = canon
+	}
+	moduleTyp := topicModule(topic)
+	var module, all *TopicRule
+	for i := range this.Rules {
+		r := &this.Rules[i]
+		switch r.Topic {
+		case topic:
+			return r
+		case moduleTyp, moduleTyp + "/*":
+			module = r
+		case "*":
+			all = r
+		}
+	}
+	if module != nil {
+		return module
+	}
+	return all
+}
+
+// Check 检查session是否可以发送topic(拒绝时返回原因)
+// 转发时会被解析为其他topic的(如"/admin/kick"、"admin/kick/x")直接拒绝
+func (this *TopicACL) Check(session ISession, topic string) error {
+	topic, err := CanonicalTopic(topic)
+	if err != nil {
+		return err
+	}
+	if len(this.AllowModules) > 0 && !slices.Contains(this.AllowModules, topicModule(topic)) {
+		return fmt.Errorf("module of topic %s not allowed", topic)
+	}
+	r := this.Match(topic)
+	if r == nil {
+		return nil
+	}
+	if !r.Guest && session.IsGuest() {
+		return fmt.Errorf("topic %s not allowed for guest", topic)
+	}
+	if len(r.Roles) > 0 {
+		roleKey := this.RoleKey
+		if roleKey == "" {
+			roleKey = "role"
+		}
+		role, _ := session.Get(roleKey)
+		if !slices.Contains(r.Roles, role) {
+			return fmt.Errorf("topic %s not allowed for role %q", topic, role)
+		}
+	}
+	for k, want := range r.Settings {
+		v, ok := session.Get(k)
+		if !ok || (want != "" && v != want) {
+			return fmt.Errorf("topic %s requires session setting %s", topic, k)
+		}
+	}
+	return nil
+}
+
+// ParseTopic 按gate转发时的规则解析topic: '/'或'_'分隔,前两段为模块类型和msgId
+func ParseTopic(topic string) (moduleTyp, msgId string, err error) {
+	parts := strings.FieldsFunc(topic, isTopicSep)
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("pack.Topic resolving faild with:%v", topic)
+	}
+	return parts[0], parts[1], nil
+}
+
+// CanonicalTopic topic的规范形式"moduleTyp/msgId"("chat_say"规范为"chat/say")
+// 有多余的段或分隔符(转发时会被解析为不同的topic)时返回错误
+func CanonicalTopic(topic string) (string, error) {
+	moduleTyp, msgId, err := ParseTopic(topic)
+	if err != nil {
+		return "", err
+	}
+	if len(topic) != len(moduleTyp)+1+len(msgId) {
+		return "", fmt.Errorf("topic %q is not in moduleTyp/msgId form", topic)
+	}
+	return moduleTyp + "/" + msgId, nil
+}
+
+func isTopicSep(r rune) bool { return r == '/' || r == '_' }
+
+// topicModule topic所属的模块类型
+func topicModule(topic string) string {
+	if i := strings.IndexAny(topic, "/_"); i >= 0 {
+		return topic[:i]
+	}
+	return topic
+}
@@ -0,0 +1,147 @@
+package gate_test
+
+import (
+	"testing"
+
+	"github.com/cloudapex/river/gate"
+	gatebase "github.com/cloudapex/river/gate/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSession(t *testing.T, userId string, settings map[string]string) gate.ISession {
+	data := map[string]any{"SessionId": "s1"}
+	if userId != "" {
+		data["UserId"] = userId
+	}
+	if settings != nil {
+		data["Settings"] = settings
+	}
+	session, err := gatebase.NewSessionByMap(data)
+	assert.NoError(t, err)
+	return session
+}
+
+func TestCanonicalTopic(t *testing.T) {
+	cases := []struct {
+		topic string
+		want  string // 空表示拒绝
+	}{
+		{"chat/say", "chat/say"},
+		{"chat_say", "chat/say"},
+		{"/admin/kick", ""},
+		{"admin/kick/", ""},
+		{"admin//kick", ""},
+		{"admin/kick/x", ""},
+		{"admin_kick_x", ""},
+		{"chat/say_hello", ""},
+		{"admin", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		got, err := gate.CanonicalTopic(c.topic)
+		if c.want == "" {
+			assert.Error(t, err, c.topic)
+			continue
+		}
+		assert.NoError(t, err, c.topic)
+		assert.Equal(t, c.want, got, c.topic)
+	}
+}
+
+func TestTopicACLMatch(t *testing.T) {
+	acl := &gate.TopicACL{Rules: []gate.TopicRule{
+		{Topic: "admin/kick", Roles: []string{"gm"}},
+		{Topic: "admin/*", Roles: []string{"admin"}},
+		{Topic: "chat"},
+		{Topic: "*", Guest: true},
+	}}
+	cases := []struct {
+		topic string
+		rule  string // 空表示没有匹配的规则
+	}{
+		{"admin/kick", "admin/kick"},
+		{"admin_kick", "admin/kick"},
+		{"admin/ban", "admin/*"},
+		{"chat/say", "chat"},
+		{"chat_say", "chat"},
+		{"room/join", "*"},
+	}
+	for _, c := range cases {
+		r := acl.Match(c.topic)
+		if c.rule == "" {
+			assert.Nil(t, r, c.topic)
+			continue
+		}
+		if assert.NotNil(t, r, c.topic) {
+			assert.Equal(t, c.rule, r.Topic, c.topic)
+		}
+	}
+	assert.Nil(t, (&gate.TopicACL{Rules: []gate.TopicRule{{Topic: "chat"}}}).Match("room/join"))
+}
+
+func TestTopicACLCheck(t *testing.T) {
+	acl := &gate.TopicACL{
+		AllowModules: []string{"chat", "admin", "room"},
+		Rules: []gate.TopicRule{
+			{Topic: "admin/kick", Roles: []string{"gm"}},
+			{Topic: "admin", Roles: []string{"admin", "gm"}},
+			{Topic: "room/*", Settings: map[string]string{"room": "", "region": "eu"}},
+			{Topic: "*", Guest: true},
+		},
+	}
+	guest := newTestSession(t, "", nil)
+	user := newTestSession(t, "u1", nil)
+	admin := newTestSession(t, "u2", map[string]string{"role": "admin"})
+	gm := newTestSession(t, "u3", map[string]string{"role": "gm"})
+	roomEU := newTestSession(t, "u4", map[string]string{"room": "r1", "region": "eu"})
+	roomUS := newTestSession(t, "u5", map[string]string{"room": "r1", "region": "us"})
+
+	cases := []struct {
+		session gate.ISession
+		topic   string
+		allow   bool
+	}{
+		{guest, "chat/say", true},
+		{guest, "shop/buy", false}, // 不在AllowModules中
+		{guest, "admin/ban", false},
+		{user, "admin/ban", false},
+		{admin, "admin/ban", true},
+		{admin, "admin/kick", false},
+		{admin, "admin_kick", false},
+		{gm, "admin/kick", true},
+		{gm, "admin_kick", true},
+		// 转发时会被解析为admin/kick的topic不能绕过规则
+		{user, "/admin/kick", false},
+		{user, "admin/kick/x", false},
+		{admin, "admin/kick/x", false},
+		{admin, "admin_kick_x", false},
+		{roomEU, "room/join", true},
+		{roomUS, "room/join", false},
+		{user, "room/join", false},
+	}
+	for _, c := range cases {
+		err := acl.Check(c.session, c.topic)
+		assert.Equal(t, c.allow, err == nil, "%s %s: %v", c.session.GetUserID(), c.topic, err)
+	}
+}
+
+func TestIsPublicTopic(t *testing.T) {
+	publics := []string{"login", "room/*", "chat/hello"}
+	cases := []struct {
+		topic  string
+		public bool
+	}{
+		{"login/auth", true},
+		{"login_auth", true},
+		{"room/list", true},
+		{"chat/hello", true},
+		{"chat_hello", true},
+		{"chat/say", false},
+		{"/login/auth", false},
+		{"chat/hello/x", false},
+		{"login", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.public, gate.IsPublicTopic(publics, c.topic), c.topic)
+	}
+}
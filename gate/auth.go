@@ -0,0 +1,181 @@
+// Package gate 客户端认证
+package gate
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudapex/river/app"
+	"github.com/cloudapex/river/mqrpc"
+)
+
+// IAuthenticator 客户端认证器(开启Options.Authenticator时)
+// ws连接可在握手时通过url参数(Options.AuthTokenParam)或"Authorization: Bearer"头携带token,
+// 其他连接(或握手时未携带token)发送PACK_TOPIC_AUTH包认证;认证成功后gate自动绑定userId
+type IAuthenticator interface {
+	// 验证token,返回userId和需要放入session的Settings
+	Authenticate(ctx context.Context, token string) (userId string, settings map[string]string, err error)
+}
+
+// AuthToken 从ws握手请求中获取token(url参数优先)
+func AuthToken(r *http.Request, param string) string {
+	if param != "" {
+		if token := r.URL.Query().Get(param); token != "" {
+			return token
+		}
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// IsPublicTopic topic是否在公开列表中(未认证也可发送)
+// 列表项为模块类型("login"或"login/*")时整个模块公开,否则需与规范后的topic(见CanonicalTopic)一致
+func IsPublicTopic(publics []string, topic string) bool {
+	topic, err := CanonicalTopic(topic)
+	if err != nil {
+		return false
+	}
+	moduleTyp := topicModule(topic)
+	for _, p := range publics {
+		if p == topic || p == moduleTyp || p == moduleTyp+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ========== HMAC签名的token(JWT HS256)
+
+// jwt中不放入session的标准声明
+var jwtRegisteredClaims = map[string]bool{"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true}
+
+// HMACAuthenticator 本地验证HS256签名的JWT: sub为userId,其他字符串类型的自定义声明放入session的Settings
+type HMACAuthenticator struct {
+	Secret []byte
+	Leeway time.Duration // exp/nbf允许的时钟误差
+}
+
+// errEmptySecret 没有密钥时任何人都能签发token
+var errEmptySecret = fmt.Errorf("hmac authenticator without secret")
+
+// NewHMACAuthenticator 创建HMAC token认证器(secret不能为空)
+func NewHMACAuthenticator(secret string) *HMACAuthenticator {
+	return &HMACAuthenticator{Secret: []byte(secret)}
+}
+
+// Sign 签发token(登录服务使用),claims需包含sub,可包含exp等
+func (this *HMACAuthenticator) Sign(claims map[string]any) (string, error) {
+	if len(this.Secret) == 0 {
+		return "", errEmptySecret
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(this.sign(unsigned)), nil
+}
+
+func (this *HMACAuthenticator) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, this.Secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+// Authenticate 验证签名和有效期
+func (this *HMACAuthenticator) Authenticate(ctx context.Context, token string) (string, map[string]string, error) {
+	if len(this.Secret) == 0 {
+		return "", nil, errEmptySecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, fmt.Errorf("invalid token format")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, this.sign(parts[0]+"."+parts[1])) {
+		return "", nil, fmt.Errorf("invalid token signature")
+	}
+	header := map[string]any{}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header["alg"] != "HS256" {
+		return "", nil, fmt.Errorf("invalid token header")
+	}
+	claims := map[string]any{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", nil, fmt.Errorf("invalid token claims")
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(this.Leeway)) {
+		return "", nil, fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(this.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return "", nil, fmt.Errorf("token not valid yet")
+	}
+	userId, _ := claims["sub"].(string)
+	if userId == "" {
+		return "", nil, fmt.Errorf("token without sub")
+	}
+	settings := map[string]string{}
+	for k, v := range claims {
+		if s, ok := v.(string); ok && !jwtRegisteredClaims[k] {
+			settings[k] = s
+		}
+	}
+	return userId, settings, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ========== 通过RPC由认证模块验证
+
+// RPCAuthenticator 调用认证模块验证token: 方法参数为token,返回userId(string)或
+// 包含"userId"及其他Settings(字符串值)的map[string]any
+type RPCAuthenticator struct {
+	ModuleType string
+	Method     string
+}
+
+// NewRPCAuthenticator 创建RPC认证器
+func NewRPCAuthenticator(moduleType, method string) *RPCAuthenticator {
+	return &RPCAuthenticator{ModuleType: moduleType, Method: method}
+}
+
+// Authenticate 调用认证模块
+func (this *RPCAuthenticator) Authenticate(ctx context.Context, token string) (string, map[string]string, error) {
+	result, err := app.App().Call(ctx, this.ModuleType, this.Method, mqrpc.Param(token))
+	if err != nil {
+		return "", nil, err
+	}
+	switch r := result.(type) {
+	case string:
+		if r != "" {
+			return r, nil, nil
+		}
+	case map[string]any:
+		if userId, _ := r["userId"].(string); userId != "" {
+			settings := map[string]string{}
+			for k, v := range r {
+				if s, ok := v.(string); ok && k != "userId" {
+					settings[k] = s
+				}
+			}
+			return userId, settings, nil
+		}
+	}
+	return "", nil, fmt.Errorf("auth module returned no userId")
+}
@@ -0,0 +1,89 @@
+package gate
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signWithHeader 使用指定的header签发token
+func signWithHeader(a *HMACAuthenticator, header map[string]string, claims map[string]any) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(a.sign(unsigned))
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	a := NewHMACAuthenticator("secret")
+	now := time.Now().Unix()
+	token, err := a.Sign(map[string]any{"sub": "u1", "exp": now + 60, "iat": now, "role": "gm", "level": 10})
+	assert.NoError(t, err)
+	userId, settings, err := a.Authenticate(context.TODO(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", userId)
+	// 字符串类型的自定义声明放入Settings,标准声明和其他类型的不放入
+	assert.Equal(t, map[string]string{"role": "gm"}, settings)
+
+	bad := []string{
+		"",
+		"a.b",
+		token + "x", // 签名错误
+		token[:strings.LastIndex(token, ".")+1] + base64.RawURLEncoding.EncodeToString([]byte("forged")),
+	}
+	other, _ := NewHMACAuthenticator("other").Sign(map[string]any{"sub": "u1"})
+	bad = append(bad, other)
+	for _, token := range bad {
+		_, _, err := a.Authenticate(context.TODO(), token)
+		assert.Error(t, err, token)
+	}
+}
+
+func TestHMACAuthenticatorHeader(t *testing.T) {
+	a := NewHMACAuthenticator("secret")
+	claims := map[string]any{"sub": "u1"}
+	_, _, err := a.Authenticate(context.TODO(), signWithHeader(a, map[string]string{"alg": "HS256", "typ": "JWT"}, claims))
+	assert.NoError(t, err)
+	for _, alg := range []string{"none", "HS512", "RS256", ""} {
+		_, _, err := a.Authenticate(context.TODO(), signWithHeader(a, map[string]string{"alg": alg}, claims))
+		assert.Error(t, err, alg)
+	}
+}
+
+func TestHMACAuthenticatorClaims(t *testing.T) {
+	a := &HMACAuthenticator{Secret: []byte("secret"), Leeway: 30 * time.Second}
+	now := time.Now().Unix()
+	cases := []struct {
+		claims map[string]any
+		valid  bool
+	}{
+		{map[string]any{"sub": "u1", "exp": now - 10}, true}, // 在允许的时钟误差内
+		{map[string]any{"sub": "u1", "exp": now - 60}, false},
+		{map[string]any{"sub": "u1", "nbf": now + 10}, true},
+		{map[string]any{"sub": "u1", "nbf": now + 60}, false},
+		{map[string]any{"exp": now + 60}, false}, // 缺少sub
+		{map[string]any{"sub": "", "exp": now + 60}, false},
+		{map[string]any{"sub": 1, "exp": now + 60}, false},
+	}
+	for _, c := range cases {
+		token, err := a.Sign(c.claims)
+		assert.NoError(t, err)
+		_, _, err = a.Authenticate(context.TODO(), token)
+		assert.Equal(t, c.valid, err == nil, "%v: %v", c.claims, err)
+	}
+}
+
+func TestHMACAuthenticatorEmptySecret(t *testing.T) {
+	a := NewHMACAuthenticator("")
+	_, err := a.Sign(map[string]any{"sub": "u1"})
+	assert.Error(t, err)
+	// 空密钥签名的token不能通过
+	token := signWithHeader(a, map[string]string{"alg": "HS256"}, map[string]any{"sub": "u1"})
+	_, _, err = a.Authenticate(context.TODO(), token)
+	assert.Error(t, err)
+}
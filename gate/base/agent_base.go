@@ -2,9 +2,13 @@ package gatebase
 
 import (
 	"bufio"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,8 +17,15 @@ import (
 	"github.com/cloudapex/river/network"
 	"github.com/cloudapex/river/tools"
 	"github.com/cloudapex/river/tools/aes"
+	"github.com/cloudapex/river/tools/secure"
 )
 
+// orderedQueueSize 有序转发时单个连接等待转发的包数上限
+const orderedQueueSize = 256
+
+// handshakeUserKey ws握手时认证成功的userId(不放入session的Settings)
+const handshakeUserKey = "gate_auth_user"
+
 type agentBase struct {
 	impl gate.IClientAgent
 
@@ -24,14 +35,35 @@ type agentBase struct {
 	conn         network.Conn
 	r            *bufio.Reader
 	w            *bufio.Writer
-	ch           chan int        // 控制模块可同时开启的最大协程数(暂时没用)
-	sendPackChan chan *gate.Pack // 需要发送的消息缓存
+	ch           chan int     // 控制同时等待模块返回的请求数(ConcurrentTasks)
+	sendPackBuff *sendQueue   // 需要发送的消息缓存(按优先级)
+	limiter      *packLimiter // 接收限流(未配置时为nil)
 	isClosed     int32
 	isShaked     int32
 	recvNum      int64
 	sendNum      int64
 	connTime     time.Time
 	lastError    error
+	lastRecv     int64           // 最后收到数据的时间(UnixNano)
+	rtt          int64           // 最近一次心跳的往返时间
+	channel      *secure.Channel // 加密通道(开启SecureCipher时握手后建立)
+	compressor   atomic.Value    // 协商后的压缩算法(gate.ICompressor)
+	codec        gate.IPackCodec // 数据包编解码(ws按协商的子协议选择)
+	authUser     string          // ws握手时认证成功的userId(连接建立后绑定)
+	authing      int32           // 正在验证PACK_TOPIC_AUTH的token
+	batch        int             // 一次合并写入的最大包数(只对tcp/kcp连接,<=1不合并)
+	ordered      chan *gate.Pack // 有序转发时等待转发的包(第一次转发时创建)
+	orderedOnce  sync.Once
+
+	// 断线重连(开启ResumeGrace时)
+	resumable  bool         // 开启了断线重连(Init时确定)
+	token      string       // 重连token(只在sessionResumer.lock内访问)
+	noResume   int32        // 被服务端主动关闭(踢下线等)的连接不可重连
+	parkTimer  *time.Timer  // 断线后等待重连的计时器
+	replayLock sync.Mutex   // 保护以下字段
+	seq        uint64       // 最后分配的发送序号
+	replay     []*gate.Pack // 最近发送的消息(重连时补发)
+	successor  *agentBase   // 接管session的新连接
 }
 
 func (this *agentBase) Init(impl gate.IClientAgent, gt gate.IGate, conn network.Conn) error {
@@ -46,7 +78,19 @@ func (this *agentBase) Init(impl gate.IClientAgent, gt gate.IGate, conn network.
 	this.isShaked = 0
 	this.recvNum = 0
 	this.sendNum = 0
-	this.sendPackChan = make(chan *gate.Pack, gt.Options().SendPackBuffSize)
+	this.sendPackBuff = newSendQueue(gt.Options(), this.stats())
+	this.resumable = this.resumer() != nil
+	switch conn.(type) {
+	case *network.TCPConn, *network.KCPConn: // 流式连接才能合并写入(ws每次写入是一个消息,quic按topic选择流)
+		this.batch = gt.Options().WriteBatch
+	}
+	this.limiter = newPackLimiter(gt.Options())
+	this.codec = gt.Options().Codec
+	if sub, ok := conn.(interface{ Subprotocol() string }); ok {
+		if codec, ok := gt.Options().SubprotocolCodecs[sub.Subprotocol()]; ok {
+			this.codec = codec
+		}
+	}
 	return nil
 }
 func (this *agentBase) Close() {
@@ -58,7 +102,24 @@ func (this *agentBase) Close() {
 }
 func (this *agentBase) OnClose() error {
 	atomic.StoreInt32(&this.isClosed, 1)
-	close(this.sendPackChan)
+	this.orderedOnce.Do(func() {}) // 接收协程已退出,不再有新的包
+	if this.ordered != nil {
+		close(this.ordered)
+	}
+	if this.resumable {
+		this.sendPackBuff.stop() // 等待重连期间继续缓存
+	} else {
+		this.sendPackBuff.close()
+	}
+
+	if !this.IsShaked() { // 未建立连接(等待重连握手时断开)
+		this.sendPackBuff.clear()
+		return nil
+	}
+	if resumer := this.resumer(); resumer != nil && resumer.park(this) {
+		return nil // 等待重连或已被新连接接管
+	}
+	this.sendPackBuff.clear()
 
 	this.gate.GetAgentLearner().DisConnect(this.impl) // 触发连接断开的事件
 
@@ -76,23 +137,123 @@ func (this *agentBase) Run() (err error) {
 	}()
 
 	addr := this.conn.RemoteAddr()
+	settings := make(map[string]string)
+	if valuer, ok := this.conn.(network.HandshakeValuer); ok { // 握手钩子返回的值(OnConnect之前可用)
+		for k, v := range valuer.HandshakeValues() {
+			settings[k] = v
+		}
+		this.authUser = settings[handshakeUserKey]
+		delete(settings, handshakeUserKey)
+	}
 	this.session, err = NewSessionByMap(map[string]any{
 		"IP":        addr.String(),
 		"Network":   addr.Network(),
 		"SessionId": tools.GenerateID().String(),
 		"ServerId":  this.gate.GetServerID(),
-		"Settings":  make(map[string]string),
+		"Settings":  settings,
 	})
 
 	this.session.GenTraceSpan() // 代码跟踪
 	this.connTime = time.Now()
-	this.isShaked = 1
-	this.gate.GetAgentLearner().Connect(this) //发送连接成功的事件
+	atomic.StoreInt64(&this.lastRecv, this.connTime.UnixNano())
+
+	if this.gate.Options().SecureCipher != "" {
+		if err := this.secureHandshake(); err != nil {
+			log.Warning("gate secure handshake failed, ip:%s err:%v", addr.String(), err)
+			this.lastError = err
+			return err
+		}
+	}
+
+	resumer := this.resumer()
+	if resumer == nil {
+		this.connect()
+		go this.sendLoop()     // 发送数据线程
+		return this.recvLoop() // 接收数据线程
+	}
+
+	// 开启断线重连时, 第一个包为PACK_TOPIC_RESUME则尝试接管原session
+	go this.sendLoop()
+	pack, err := this.readPack()
+	if err != nil {
+		return err
+	}
+	if pack.Topic == gate.PACK_TOPIC_RESUME {
+		err := resumer.resume(this, pack.Body)
+		if err == nil {
+			atomic.StoreInt32(&this.isShaked, 1)
+			go this.heartbeatLoop()
+			return this.recvLoop()
+		}
+		log.Warning("gate resume failed, sessionId:%s err:%v", this.session.GetSessionID(), err)
+		this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_RESUME_FAILED, Body: []byte(err.Error())})
+		pack = nil
+	}
+	this.connect()
+	resumer.register(this)
+	if pack != nil {
+		if err := this.handlePack(pack); err != nil {
+			return err
+		}
+	}
+	return this.recvLoop()
+}
+
+// secureHandshake 加密通道握手: 交换ECDH公钥并派生会话key(在发送协程启动前进行)
+// 配置了EncryptKey时混入key派生,客户端需使用相同的key,否则第一个包就会解密失败
+func (this *agentBase) secureHandshake() error {
+	kx, err := secure.NewKeyExchange()
+	if err != nil {
+		return err
+	}
+	hello := this.impl.OnWriteEncodingPack(&gate.Pack{Topic: gate.PACK_TOPIC_SECURE_HELLO, Body: kx.PublicKey()})
+	this.setWriteDeadline()
+	if _, err := this.conn.Write(hello); err != nil {
+		return err
+	}
+	pack, err := this.readPack()
+	if err != nil {
+		return err
+	}
+	if pack.Topic != gate.PACK_TOPIC_SECURE_HELLO {
+		return fmt.Errorf("expect %s but got %s", gate.PACK_TOPIC_SECURE_HELLO, pack.Topic)
+	}
+	this.channel, err = kx.Channel(this.gate.Options().SecureCipher, pack.Body, []byte(this.gate.Options().EncryptKey), true)
+	return err
+}
+
+// connect 建立连接(握手成功)
+func (this *agentBase) connect() {
+	atomic.StoreInt32(&this.isShaked, 1)
+	this.gate.GetAgentLearner().Connect(this.impl) //发送连接成功的事件
 
 	log.Info("gate create agent sessionId:%s, current gate agents num:%d", this.session.GetSessionID(), this.gate.GetDelegater().GetAgentNum())
 
-	go this.sendLoop()     // 发送数据线程
-	return this.recvLoop() // 接收数据线程
+	if this.authUser != "" {
+		if err := this.bindUser(this.authUser, nil); err != nil {
+			log.Warning("gate auth bind failed, sessionId:%s userId:%s err:%v", this.session.GetSessionID(), this.authUser, err)
+			this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH_FAILED, Body: []byte(err.Error())})
+		} else {
+			this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH, Body: []byte(this.authUser)})
+		}
+	}
+	go this.heartbeatLoop()
+}
+
+// resumer 断线重连管理(未开启时为nil)
+func (this *agentBase) resumer() *sessionResumer {
+	if g, ok := this.gate.(interface{ getResumer() *sessionResumer }); ok {
+		return g.getResumer()
+	}
+	return nil
+}
+
+// stats 网关运行统计(自定义gate未提供时为nil)
+func (this *agentBase) stats() *gateStats {
+	if g, ok := this.gate.(interface{ getStats() *gateStats }); ok {
+		return g.getStats()
+	}
+	return nil
 }
 
 // ========== 属性方法
@@ -104,7 +265,7 @@ func (this *agentBase) ConnTime() time.Time { return this.connTime }
 func (this *agentBase) IsClosed() bool { return atomic.LoadInt32(&this.isClosed) == 1 }
 
 // IsShaked 连接就绪(握手/认证...)
-func (this *agentBase) IsShaked() bool { return this.isShaked == 1 }
+func (this *agentBase) IsShaked() bool { return atomic.LoadInt32(&this.isShaked) == 1 }
 
 // RecvNum 接收消息的数量
 func (this *agentBase) RecvNum() int64 { return atomic.LoadInt64(&this.recvNum) }
@@ -112,6 +273,9 @@ func (this *agentBase) RecvNum() int64 { return atomic.LoadInt64(&this.recvNum)
 // SendNum 发送消息的数量
 func (this *agentBase) SendNum() int64 { return atomic.LoadInt64(&this.sendNum) }
 
+// RTT 最近一次心跳的往返时间
+func (this *agentBase) RTT() time.Duration { return time.Duration(atomic.LoadInt64(&this.rtt)) }
+
 // GetSession 管理的ClientSession
 func (this *agentBase) GetSession() gate.ISession { return this.session }
 
@@ -129,26 +293,105 @@ func (this *agentBase) sendLoop() {
 		if err := tools.Catch("agent.sendLoop() panic", recover()); err != nil {
 			log.Error("agent.sendLoop() panic:%v", err)
 		}
+		if this.resumable {
+			this.sendPackBuff.stop() // 未发送的包留给重连的新连接
+		} else {
+			this.sendPackBuff.clear()
+		}
 		this.Close()
 	}()
 
-	for pack := range this.sendPackChan {
-		atomic.AddInt64(&this.sendNum, 1)
-		sendData := this.impl.OnWriteEncodingPack(pack)
-		this.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
-		if _, err := this.conn.Write(sendData); err != nil {
+	for {
+		pack, control, ok := this.sendPackBuff.pop(true)
+		if !ok {
+			return
+		}
+		if this.batch <= 1 {
+			if err := this.send(pack, control, false); err != nil {
+				return
+			}
+			continue
+		}
+		// 合并写入: 队列中已有的包(最多batch个)写入缓存后一次flush
+		for n := 1; ok; n++ {
+			if err := this.send(pack, control, true); err != nil {
+				return
+			}
+			if n >= this.batch {
+				break
+			}
+			pack, control, ok = this.sendPackBuff.pop(false)
+		}
+		this.setWriteDeadline()
+		if err := this.w.Flush(); err != nil {
 			this.lastError = err
-			log.Error("sendLoop, userId:%v sessionId:%v topic:%v dataLen:%v, err:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, len(sendData), err)
-			break
-		} else {
-			log.Debug("sendLoop, userId:%v sessionId:%v topic:%v dataLen:%v ok.", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, len(sendData))
+			log.Error("sendLoop flush, userId:%v sessionId:%v err:%v", this.session.GetUserID(), this.session.GetSessionID(), err)
+			return
+		}
+	}
+}
+
+// send 编码并发送一个包(buffered时写入缓存,由调用方flush)
+func (this *agentBase) send(pack *gate.Pack, control bool, buffered bool) error {
+	atomic.AddInt64(&this.sendNum, 1)
+	sendData, next := this.encode(pack, control)
+	if next != nil { // 已被新连接接管
+		next.enqueue(pack)
+		return nil
+	}
+	if len(sendData) == 0 {
+		return nil
+	}
+	this.setWriteDeadline()
+	var err error
+	if buffered {
+		_, err = this.w.Write(sendData)
+	} else {
+		_, err = this.write(pack.Topic, sendData)
+	}
+	if err != nil {
+		this.lastError = err
+		log.Error("sendLoop, userId:%v sessionId:%v topic:%v dataLen:%v, err:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, len(sendData), err)
+		return err
+	}
+	log.Debug("sendLoop, userId:%v sessionId:%v topic:%v dataLen:%v ok.", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, len(sendData))
+	if pack.Topic == gate.PACK_TOPIC_COMPRESS {
+		if c, ok := gate.GetCompressor(string(pack.Body)); ok {
+			this.compressor.Store(c)
 		}
 	}
+	return nil
+}
+
+// encode 编码要发送的包: 开启断线重连时非控制包在这里分配发送序号
+// (control为控制队列中的包,包括补发的消息,不再分配;已被新连接接管时返回新连接)
+func (this *agentBase) encode(pack *gate.Pack, control bool) ([]byte, *agentBase) {
+	if this.resumable && !control && !gate.IsControlTopic(pack.Topic) {
+		return this.record(pack)
+	}
+	return this.impl.OnWriteEncodingPack(pack), nil
+}
+
+// setWriteDeadline 设置写入超时(WriteTimeout为0时不超时)
+func (this *agentBase) setWriteDeadline() {
+	if d := this.gate.Options().WriteTimeout; d > 0 {
+		this.conn.SetWriteDeadline(time.Now().Add(d))
+	} else {
+		this.conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// write 发送编码后的数据(连接支持多个发送通道时按topic选择)
+func (this *agentBase) write(topic string, data []byte) (int, error) {
+	if w, ok := this.conn.(network.TopicWriter); ok {
+		return w.WriteTopic(topic, data)
+	}
+	return this.conn.Write(data)
 }
 
 // SendPack 提供发送数据包的方法
 func (this *agentBase) SendPack(pack *gate.Pack) error {
-	if this.IsClosed() {
+	if this.IsClosed() && !this.resumable {
 		return nil
 	}
 
@@ -159,24 +402,147 @@ func (this *agentBase) SendPack(pack *gate.Pack) error {
 		}
 		pack.Body = bb
 	}
-	select {
-	case this.sendPackChan <- pack:
-		return nil
-	default:
-		return fmt.Errorf("too many unsent messages")
+	return this.enqueue(pack)
+}
+
+// enqueue 放入发送队列(开启断线重连时断线等待重连期间继续缓存,已被新连接接管时转给新连接)
+func (this *agentBase) enqueue(pack *gate.Pack) error {
+	var err error
+	if this.resumable {
+		// 持有replayLock放入: handover移交队列时不会漏掉正在放入的包
+		this.replayLock.Lock()
+		next := this.successor
+		if next == nil {
+			err = this.push(pack)
+		}
+		this.replayLock.Unlock()
+		if next != nil {
+			return next.enqueue(pack)
+		}
+	} else {
+		err = this.push(pack)
+	}
+	if err == errSlowConsumer {
+		log.Warning("gate disconnect slow client, userId:%v sessionId:%v topic:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic)
+		if stats := this.stats(); stats != nil {
+			stats.addSlowDisconnect()
+		}
+		if this.IsClosed() { // 等待重连期间缓存已满,不再等待
+			this.disableResume()
+		}
+		this.Close()
+	}
+	return err
+}
+
+// push 按topic的优先级放入发送队列
+func (this *agentBase) push(pack *gate.Pack) error {
+	lane := sendLaneIndex(this.gate.Options().SendQueue.Priority(pack.Topic))
+	return this.sendPackBuff.push(pack, lane, this.sendPackBuff.conf[lane].Policy)
+}
+
+// sendControl 发送gate控制包(不分配序号,不经过发送钩子,不受发送队列长度限制)
+func (this *agentBase) sendControl(pack *gate.Pack) {
+	if this.IsClosed() {
+		return
+	}
+	this.sendPackBuff.pushControl(pack)
+}
+
+// record 分配发送序号并编码,编码成功才计入序号并缓存(已被新连接接管时返回新连接)
+func (this *agentBase) record(pack *gate.Pack) ([]byte, *agentBase) {
+	this.replayLock.Lock()
+	defer this.replayLock.Unlock()
+	if this.successor != nil {
+		return nil, this.successor
+	}
+	p := *pack // 同一个包可能发送给多个连接
+	p.Seq = this.seq + 1
+	data := this.impl.OnWriteEncodingPack(&p)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	this.seq = p.Seq
+	this.replay = append(this.replay, &p)
+	if n := len(this.replay) - this.gate.Options().ResumeBuffer; n > 0 {
+		this.replay = append(this.replay[:0:0], this.replay[n:]...)
+	}
+	return data, nil
+}
+
+// handover 将session及其发送序号、缓存和未发送的包移交给新连接(已收到序号ack), 返回补发的消息数
+// 在successor可见之前放入新连接的队列: 先补发缺失的消息,再发送旧连接未发送的消息,之后的新消息排在它们后面
+func (this *agentBase) handover(next *agentBase, ack uint64) (int, error) {
+	this.replayLock.Lock()
+	defer this.replayLock.Unlock()
+	if this.successor != nil {
+		return 0, fmt.Errorf("session already resumed")
+	}
+	if ack > this.seq {
+		return 0, fmt.Errorf("resume seq %d exceeds sent seq %d", ack, this.seq)
+	}
+	if len(this.replay) > 0 && this.replay[0].Seq > ack+1 {
+		return 0, fmt.Errorf("resume seq %d too old, oldest cached seq %d", ack, this.replay[0].Seq)
+	}
+	next.session = this.session // 新连接接管原session(在放入发送队列之前)
+	next.replayLock.Lock()
+	next.seq, next.replay = this.seq, this.replay
+	next.replayLock.Unlock()
+
+	missed := 0
+	for _, pack := range this.replay {
+		if pack.Seq > ack {
+			next.sendPackBuff.pushControl(pack)
+			missed++
+		}
+	}
+	for lane, packs := range this.sendPackBuff.drain() {
+		for _, pack := range packs {
+			next.sendPackBuff.push(pack, lane, "")
+		}
+	}
+	this.successor, this.replay = next, nil
+	return missed, nil
+}
+
+// getSuccessor 接管session的新连接
+func (this *agentBase) getSuccessor() *agentBase {
+	this.replayLock.Lock()
+	defer this.replayLock.Unlock()
+	return this.successor
+}
+
+// disableResume 服务端主动关闭的连接不可重连
+func (this *agentBase) disableResume() {
+	atomic.StoreInt32(&this.noResume, 1)
+	if resumer := this.resumer(); resumer != nil {
+		resumer.drop(this)
 	}
 }
 
 // ========== 处理接收(wait)
 func (this *agentBase) recvLoop() error {
+	for {
+		pack, err := this.readPack()
+		if err != nil {
+			return err
+		}
+		if err := this.handlePack(pack); err != nil {
+			return err
+		}
+	}
+}
+
+// readPack 读取下一个数据包(带心跳超时)
+func (this *agentBase) readPack() (*gate.Pack, error) {
 	heartOverTime := this.gate.Options().HeartOverTimer
 	for {
 		nowTime := time.Now()
 		if heartOverTime > 0 {
 			_ = this.conn.SetReadDeadline(nowTime.Add(heartOverTime))
 		}
-		// this.recvWait()
 		pack, err := this.impl.OnReadDecodingPack()
+		atomic.StoreInt64(&this.lastRecv, time.Now().UnixNano())
 		if err != nil {
 			if heartOverTime > 0 && time.Since(nowTime) >= (heartOverTime) {
 				log.Error("recvLoop heartOverTime, userId:%v sessionId:%v", this.session.GetSessionID(), this.session.GetUserID())
@@ -184,36 +550,379 @@ func (this *agentBase) recvLoop() error {
 				log.Error("recvLoop OnReadDecodingPack, userId:%v sessionId:%v err:%s", this.session.GetSessionID(), this.session.GetUserID(), err.Error())
 			}
 			this.lastError = err
+			return nil, err
+		}
+		if pack != nil {
+			return pack, nil
+		}
+	}
+}
+
+// handlePack 处理接收的数据包(路由hook或转发)
+func (this *agentBase) handlePack(pack *gate.Pack) error {
+	atomic.AddInt64(&this.recvNum, 1)
+	if this.limiter != nil {
+		ok, err := this.limiter.Check(pack)
+		if err != nil {
+			log.Warning("recvLoop rate limit, userId:%v sessionId:%v err:%v", this.session.GetUserID(), this.session.GetSessionID(), err)
+			this.lastError = err
 			return err
 		}
+		if !ok {
+			log.Debug("recvLoop rate limit drop, userId:%v sessionId:%v topic:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic)
+			return nil
+		}
+	}
+	if this.handleHeartbeat(pack) || this.handleCompress(pack) || this.handleAuth(pack) {
+		return nil
+	}
+	if !this.checkAuth(pack) || !this.checkACL(pack) {
+		return nil
+	}
+	if route := this.gate.GetRouteHandler(); route != nil {
+		done, err := route.OnRoute(this.GetSession(), pack.Topic, pack.Body)
+		if err != nil {
+			this.lastError = err
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+		// 请求在模块返回(或超时)前占用一个处理中的名额
+		ok, err := this.recvWait()
+		if err != nil {
+			log.Warning("recvLoop inflight limit, userId:%v sessionId:%v err:%v", this.session.GetUserID(), this.session.GetSessionID(), err)
+			this.lastError = err
+			return err
+		}
+		if !ok {
+			log.Debug("recvLoop inflight limit drop, userId:%v sessionId:%v topic:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic)
+			this.sendControl(gate.NewResponseError(pack, gate.PACK_ERR_FAILED, "too many inflight requests"))
+			return nil
+		}
+		if this.gate.Options().OrderedDispatch == "" {
+			go this.handleRequest(ownBody(pack)) // 等待模块返回,不阻塞接收
+		} else if !this.dispatchOrdered(pack) {
+			this.recvFinish()
+			this.sendControl(gate.NewResponseError(pack, gate.PACK_ERR_FAILED, "too many pending packs"))
+		}
+		return nil
+	}
+	if this.gate.Options().OrderedDispatch != "" {
+		if !this.dispatchOrdered(pack) {
+			log.Warning("recvLoop ordered queue full drop, userId:%v sessionId:%v topic:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic)
+		}
+		return nil
+	}
+	if err := this.forward(pack); err != nil {
+		this.lastError = err
+		return err
+	}
+	return nil
+}
+
+// forward 普通包通过CallNR转发,模块不返回,不计入处理中的请求数(由RateLimit限制)
+func (this *agentBase) forward(pack *gate.Pack) error {
+	if err := this.recvHandler(this.GetSession(), pack); err != nil {
+		return err
+	}
+	log.Debug("recvLoop, userId:%v sessionId:%v topic:%v dataLen:%v ok.", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, len(pack.Body))
+	return nil
+}
+
+// dispatchOrdered 有序转发: 包按接收顺序在该连接的转发协程中依次处理,
+// 等待模块返回时不阻塞接收协程(心跳等控制包照常处理);队列满时返回false
+func (this *agentBase) dispatchOrdered(pack *gate.Pack) bool {
+	this.orderedOnce.Do(func() {
+		this.ordered = make(chan *gate.Pack, orderedQueueSize)
+		go this.orderedLoop()
+	})
+	select {
+	case this.ordered <- ownBody(pack):
+		return true
+	default:
+		return false
+	}
+}
+
+// ownBody 包交给其他协程处理前复制包体(TCP读到的包体引用读缓冲池,读取下一个包时会被覆盖)
+func ownBody(pack *gate.Pack) *gate.Pack {
+	if len(pack.Body) > 0 {
+		pack.Body = append([]byte(nil), pack.Body...)
+	}
+	return pack
+}
 
-		if pack == nil {
+// orderedLoop 有序转发协程(连接关闭后处理完已接收的包再退出)
+func (this *agentBase) orderedLoop() {
+	for pack := range this.ordered {
+		if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+			this.handleRequest(pack)
 			continue
 		}
-		atomic.AddInt64(&this.recvNum, 1)
-		if route := this.gate.GetRouteHandler(); route != nil {
-			done, err := route.OnRoute(this.GetSession(), pack.Topic, pack.Body)
-			if err != nil {
-				this.lastError = err
-				return err
+		if err := this.forward(pack); err != nil {
+			log.Warning("ordered forward, userId:%v sessionId:%v topic:%v err:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, err)
+			this.Close()
+		}
+	}
+}
+
+// handleRequest 处理请求模式的包(处理失败时下发带ReqId的错误响应,不断开连接)
+func (this *agentBase) handleRequest(pack *gate.Pack) {
+	defer func() {
+		if err := tools.Catch("agent.handleRequest() panic", recover()); err != nil {
+			log.Error("agent.handleRequest() panic:%v", err)
+		}
+		this.recvFinish()
+	}()
+	err := this.recvHandler(this.GetSession(), pack)
+	if err == nil {
+		log.Debug("recvLoop request, userId:%v sessionId:%v topic:%v reqId:%v ok.", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, pack.ReqId)
+		return
+	}
+	log.Warning("recvLoop request, userId:%v sessionId:%v topic:%v reqId:%v err:%v", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, pack.ReqId, err)
+	code := gate.PACK_ERR_FAILED
+	if errors.Is(err, gate.ErrRequestTimeout) {
+		code = gate.PACK_ERR_TIMEOUT
+	}
+	this.SendPack(gate.NewResponseError(pack, code, err.Error()))
+}
+
+// ========== 心跳
+
+// handleHeartbeat 处理心跳包(返回true表示是心跳包,不再转发)
+func (this *agentBase) handleHeartbeat(pack *gate.Pack) bool {
+	switch pack.Topic {
+	case gate.PACK_TOPIC_PING:
+		// 复制包体: pong在发送协程中发送,包体可能引用读缓冲池
+		this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_PONG, Body: append([]byte(nil), pack.Body...)})
+		return true
+	case gate.PACK_TOPIC_PONG:
+		if len(pack.Body) == 8 {
+			sendTime := int64(binary.LittleEndian.Uint64(pack.Body))
+			if rtt := time.Now().UnixNano() - sendTime; rtt >= 0 {
+				atomic.StoreInt64(&this.rtt, rtt)
 			}
-			if done {
-				continue
+		}
+		return true
+	}
+	return false
+}
+
+// heartbeatLoop 空闲时发送ping,长时间未收到数据则断开(检测半开连接),并定期调用StorageHandler.Heartbeat
+func (this *agentBase) heartbeatLoop() {
+	interval := this.gate.Options().HeartbeatInterval
+	if interval <= 0 {
+		return
+	}
+	defer func() {
+		if err := tools.Catch("agent.heartbeatLoop() panic", recover()); err != nil {
+			log.Error("agent.heartbeatLoop() panic:%v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if this.IsClosed() {
+			return
+		}
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&this.lastRecv)))
+		if idle >= 2*interval {
+			log.Warning("heartbeat timeout, userId:%v sessionId:%v idle:%v", this.session.GetUserID(), this.session.GetSessionID(), idle)
+			this.Close()
+			return
+		}
+		if idle >= interval {
+			ping := make([]byte, 8)
+			binary.LittleEndian.PutUint64(ping, uint64(time.Now().UnixNano()))
+			this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_PING, Body: ping})
+		}
+		if storager := this.gate.GetStorageHandler(); storager != nil && this.session.GetUserID() != "" {
+			storager.Heartbeat(this.session)
+		}
+	}
+}
+
+// ========== 压缩
+
+// handleCompress 处理压缩协商包(返回true表示是协商包,不再转发)
+func (this *agentBase) handleCompress(pack *gate.Pack) bool {
+	if pack.Topic != gate.PACK_TOPIC_COMPRESS {
+		return false
+	}
+	name := this.gate.Options().Compression
+	chosen := ""
+	if name != "" {
+		for _, n := range strings.Split(string(pack.Body), ",") {
+			if strings.TrimSpace(n) == name {
+				chosen = name
+				break
 			}
 		}
-		if err := this.recvHandler(this.GetSession(), pack); err != nil {
-			this.lastError = err
+	}
+	// 回复发送后才开启(见sendLoop),保证客户端收到回复前的包都不压缩
+	this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_COMPRESS, Body: []byte(chosen)})
+	return true
+}
+
+// getCompressor 协商后的压缩算法(未协商时为nil)
+func (this *agentBase) getCompressor() gate.ICompressor {
+	c, _ := this.compressor.Load().(gate.ICompressor)
+	return c
+}
+
+// compress 包体超过阈值时压缩(返回新的Pack,不修改原Pack,重连补发时不会重复压缩)
+func (this *agentBase) compress(pack *gate.Pack) *gate.Pack {
+	c := this.getCompressor()
+	if c == nil || pack.Flags&gate.PACK_FLAG_COMPRESSED != 0 || len(pack.Body) < this.gate.Options().CompressThreshold {
+		return pack
+	}
+	data, err := c.Compress(pack.Body)
+	if err != nil {
+		log.Warning("compress topic:%v err:%v", pack.Topic, err)
+		return pack
+	}
+	if len(data) >= len(pack.Body) { // 压缩无收益
+		return pack
+	}
+	p := *pack
+	p.Body = data
+	p.Flags |= gate.PACK_FLAG_COMPRESSED
+	return &p
+}
+
+// decompress 解压带压缩标记的包体
+func (this *agentBase) decompress(pack *gate.Pack) error {
+	if pack.Flags&gate.PACK_FLAG_COMPRESSED == 0 {
+		return nil
+	}
+	c := this.getCompressor()
+	if c == nil {
+		return fmt.Errorf("compressed pack without negotiated compression")
+	}
+	data, err := c.Decompress(pack.Body, this.gate.Options().MaxPackSize) // 解压后与未压缩的包同样受MaxPackSize限制
+	if err != nil {
+		return fmt.Errorf("decompress topic:%v err:%v", pack.Topic, err)
+	}
+	pack.Body = data
+	pack.Flags &^= gate.PACK_FLAG_COMPRESSED
+	return nil
+}
+
+// ========== 认证
+
+// handleAuth 处理认证包(返回true表示是认证包,不再转发)
+func (this *agentBase) handleAuth(pack *gate.Pack) bool {
+	auth := this.gate.Options().Authenticator
+	if auth == nil || pack.Topic != gate.PACK_TOPIC_AUTH {
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&this.authing, 0, 1) {
+		this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH_FAILED, Body: []byte("authentication in progress")})
+		return true
+	}
+	go this.authenticate(auth, string(pack.Body)) // 认证模块可能很慢,不阻塞接收和心跳
+	return true
+}
+
+// authenticate 验证token(超过AuthTimeout失败)并绑定userId,回复认证结果
+func (this *agentBase) authenticate(auth gate.IAuthenticator, token string) {
+	defer func() {
+		if err := tools.Catch("agent.authenticate() panic", recover()); err != nil {
+			log.Error("agent.authenticate() panic:%v", err)
+		}
+		atomic.StoreInt32(&this.authing, 0)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), this.gate.Options().AuthTimeout)
+	defer cancel()
+	userId, settings, err := auth.Authenticate(ctx, token)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = this.bindUser(userId, settings)
+	}
+	if err != nil {
+		log.Warning("gate auth failed, sessionId:%s err:%v", this.session.GetSessionID(), err)
+		this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH_FAILED, Body: []byte(err.Error())})
+		return
+	}
+	this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH, Body: []byte(userId)})
+}
+
+// bindUser 认证成功后绑定userId(按重复登录策略处理)并设置Settings
+func (this *agentBase) bindUser(userId string, settings map[string]string) error {
+	sessionId := this.session.GetSessionID()
+	if _, err := this.gate.GetDelegater().OnRpcBind(context.Background(), sessionId, userId); err != nil {
+		return err
+	}
+	if len(settings) > 0 {
+		if _, err := this.gate.GetDelegater().OnRpcPush(context.Background(), sessionId, settings); err != nil {
 			return err
 		}
-		log.Debug("recvLoop, userId:%v sessionId:%v topic:%v dataLen:%v ok.", this.session.GetUserID(), this.session.GetSessionID(), pack.Topic, len(pack.Body))
 	}
+	return nil
+}
+
+// checkAuth 开启认证时,未认证的连接只能发送公开topic(否则丢弃并回复PACK_TOPIC_AUTH_REQUIRED)
+func (this *agentBase) checkAuth(pack *gate.Pack) bool {
+	opts := this.gate.Options()
+	if opts.Authenticator == nil || !this.session.IsGuest() || gate.IsPublicTopic(opts.PublicTopics, pack.Topic) {
+		return true
+	}
+	log.Debug("recvLoop auth required, sessionId:%v topic:%v", this.session.GetSessionID(), pack.Topic)
+	if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+		this.sendControl(gate.NewResponseError(pack, gate.PACK_ERR_FORBIDDEN, "authentication required"))
+	} else {
+		this.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH_REQUIRED, Body: []byte(pack.Topic)})
+	}
+	return false
 }
-func (this *agentBase) recvWait() error {
-	// 如果ch满了则会处于阻塞，从而达到限制最大协程的功能
+
+// checkACL 检查topic访问控制(拒绝时回复PACK_TOPIC_ERROR并计数)
+func (this *agentBase) checkACL(pack *gate.Pack) bool {
+	acl := this.gate.Options().TopicACL
+	if acl == nil {
+		return true
+	}
+	err := acl.Check(this.session, pack.Topic)
+	if err == nil {
+		return true
+	}
+	log.Debug("recvLoop acl denied, userId:%v sessionId:%v err:%v", this.session.GetUserID(), this.session.GetSessionID(), err)
+	if stats := this.stats(); stats != nil {
+		stats.addACLDenied(pack.Topic)
+	}
+	if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+		this.sendControl(gate.NewResponseError(pack, gate.PACK_ERR_FORBIDDEN, err.Error()))
+	} else {
+		this.sendControl(gate.NewErrorPack(pack.Topic, gate.PACK_ERR_FORBIDDEN, err.Error()))
+	}
+	return false
+}
+
+// recvWait 占用一个处理中的请求名额(超出ConcurrentTasks时按RateLimitAction处理)
+func (this *agentBase) recvWait() (bool, error) {
+	if cap(this.ch) == 0 {
+		return true, nil
+	}
 	select {
 	case this.ch <- 1:
+		return true, nil
+	default:
 	}
-	return nil
+	switch this.gate.Options().RateLimitAction {
+	case gate.RateLimitDelay:
+		// 如果ch满了则会处于阻塞，从而达到限制最大协程的功能
+		this.ch <- 1
+		return true, nil
+	case gate.RateLimitDisconnect:
+		return false, fmt.Errorf("too many inflight requests")
+	}
+	return false, nil
 }
 func (this *agentBase) recvFinish() {
 	// 完成则从ch推出数据
@@ -225,45 +934,87 @@ func (this *agentBase) recvFinish() {
 
 // ========== Pack编码默认实现
 
-// OnWriteEncodingPack 处理Pack数据的编码用于发送
+// OnWriteEncodingPack 处理Pack数据的编码用于发送(编码失败返回nil)
 func (this *agentBase) OnWriteEncodingPack(pack *gate.Pack) []byte {
-	// [普通不加密]
-	// headLen := gate.PACK_HEAD_TOTAL_LEN_SIZE + gate.PACK_HEAD_MSG_ID_LEN_SIZE
-	// totalLen := headLen + idLen + len(pack.Body)
-	// sendData := make([]byte, headLen, totalLen)
-	// binary.LittleEndian.PutUint16(sendData, uint16(totalLen))                              // for PACK_HEAD_TOTAL_LEN_SIZE
-	// binary.LittleEndian.PutUint16(sendData[gate.PACK_HEAD_TOTAL_LEN_SIZE:], uint16(idLen)) // for PACK_HEAD_MSG_ID_LEN_SIZE
-	// sendData = append(sendData, []byte(pack.Topic)...)
-	// sendData = append(sendData, pack.Body...)
-	// [end]
-
-	idLen := len(pack.Topic)
-
-	// 需要加密的数据: PACK_HEAD_MSG_ID_LEN_SIZE + msgId + msgData
-	bodyLen := gate.PACK_HEAD_MSG_ID_LEN_SIZE + idLen + len(pack.Body)
-	bodyData := make([]byte, bodyLen)
-	binary.LittleEndian.PutUint16(bodyData, uint16(idLen))
-	copy(bodyData[gate.PACK_HEAD_MSG_ID_LEN_SIZE:], []byte(pack.Topic))
-	copy(bodyData[gate.PACK_HEAD_MSG_ID_LEN_SIZE+idLen:], []byte(pack.Body))
-
-	// 处理加密: 先base加密 + 再ecb加密
-	if this.gate.Options().EncryptKey != "" {
-		b64Data := base64.StdEncoding.EncodeToString(bodyData)
-		kl := len(this.gate.Options().EncryptKey)
-		encryptedData, err := aes.EncryContentWithAESCBC([]byte(b64Data), []byte(this.gate.Options().EncryptKey), []byte(this.gate.Options().EncryptKey)[kl-16:])
+	codec := this.codec
+	pack = this.compress(pack)
+	bodyData, err := codec.Marshal(pack)
+	if err != nil {
+		log.Error("OnWriteEncodingPack topic:%v err:%v", pack.Topic, err)
+		return nil
+	}
+	if bodyData, err = this.encrypt(bodyData); err != nil {
+		log.Error("OnWriteEncodingPack topic:%v err:%v", pack.Topic, err)
+		return nil
+	}
+	head, err := codec.WriteHead(len(bodyData))
+	if err != nil {
+		log.Error("OnWriteEncodingPack topic:%v err:%v", pack.Topic, err)
+		return nil
+	}
+	return append(head, bodyData...)
+}
+
+// decodeBody 解密包体并解码出Pack(带压缩标记时解压)
+func (this *agentBase) decodeBody(bodyData []byte) (*gate.Pack, error) {
+	bodyData, err := this.decrypt(bodyData)
+	if err != nil {
+		return nil, err
+	}
+	return this.unmarshal(bodyData)
+}
+
+// unmarshal 解码已解密的包体(带压缩标记时解压)
+func (this *agentBase) unmarshal(bodyData []byte) (*gate.Pack, error) {
+	pack, err := this.codec.Unmarshal(bodyData)
+	if err != nil {
+		return nil, err
+	}
+	if err := this.decompress(pack); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// encrypt 包体加密: 加密通道(AEAD) 或 先base64编码 + 再cbc加密
+func (this *agentBase) encrypt(bodyData []byte) ([]byte, error) {
+	if this.channel != nil {
+		return this.channel.Seal(bodyData), nil
+	}
+	key := this.gate.Options().EncryptKey
+	if key == "" {
+		return bodyData, nil
+	}
+	b64Data := base64.StdEncoding.EncodeToString(bodyData)
+	encryptedData, err := aes.EncryContentWithAESCBC([]byte(b64Data), []byte(key), []byte(key)[len(key)-16:])
+	if err != nil {
+		return nil, fmt.Errorf("encrypt cbc, err:%v", err)
+	}
+	return encryptedData, nil
+}
+
+// decrypt 包体解密
+func (this *agentBase) decrypt(bodyData []byte) ([]byte, error) {
+	if this.channel != nil {
+		plain, err := this.channel.Open(bodyData)
 		if err != nil {
-			bodyData = []byte(err.Error())
-			log.Error("AES_ECB_Encrypt err:%v", err)
+			return nil, fmt.Errorf("decrypt aead, err:%v", err)
 		}
-		bodyData = encryptedData
+		return plain, nil
 	}
-
-	// 发送数据总长度: PACK_HEAD_TOTAL_LEN_SIZE + len(bodyData)
-	totalLen := gate.PACK_HEAD_TOTAL_LEN_SIZE + len(bodyData)
-	sendData := make([]byte, totalLen)
-	binary.LittleEndian.PutUint16(sendData, uint16(totalLen))
-	copy(sendData[gate.PACK_HEAD_TOTAL_LEN_SIZE:], bodyData)
-	return sendData
+	key := this.gate.Options().EncryptKey
+	if key == "" {
+		return bodyData, nil
+	}
+	cbc, err := aes.DecryContentWithAESCBC(bodyData, []byte(key), []byte(key)[len(key)-16:])
+	if err != nil {
+		return nil, fmt.Errorf("decrypt cbc, err:%v", err)
+	}
+	b64Data, err := base64.StdEncoding.DecodeString(string(cbc))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt base64, err:%v", err)
+	}
+	return b64Data, nil
 }
 
 // OnReadDecodingPack 从连接中读取数据并解码出Pack
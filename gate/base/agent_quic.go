@@ -0,0 +1,146 @@
+package gatebase
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/network"
+	"github.com/cloudapex/river/tools/secure"
+)
+
+func NewQUICClientAgent(h gate.FunRecvPackHandler) gate.IClientAgent {
+	return &QUICClientAgent{
+		agentBase: agentBase{recvHandler: h},
+		frames:    make(chan quicFrame),
+	}
+}
+
+// quicFrame 从某个流读取到的一个数据包(未解码)
+type quicFrame struct {
+	stream *network.QUICStream
+	body   []byte
+	err    error
+}
+
+// QUICClientAgent WebTransport(quic)连接: 每个流按字节流读取数据包,
+// 客户端在其他流上发送过某模块的消息后,该模块的下行消息也通过这个流发送;
+// 开启SecureCipher时每个流单独校验接收序号(见secure.Channel.Receiver),发送序号在所有流中递增
+type QUICClientAgent struct {
+	agentBase
+	readOnce  sync.Once
+	frames    chan quicFrame
+	receivers map[*network.QUICStream]*secure.Channel // 其他流的解密通道(只在接收协程中访问)
+}
+
+// 读取数据并解码出Pack(按到达顺序合并所有流的数据包)
+func (this *QUICClientAgent) OnReadDecodingPack() (*gate.Pack, error) {
+	conn, ok := this.conn.(*network.QUICConn)
+	if !ok {
+		return nil, fmt.Errorf("QUICClientAgent requires network.QUICConn")
+	}
+	this.readOnce.Do(func() {
+		go this.readStream(conn, conn.MainStream())
+		go this.acceptStreams(conn)
+	})
+
+	var timeout <-chan time.Time
+	if deadline := conn.ReadDeadline(); !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var frame quicFrame
+	select {
+	case frame = <-this.frames:
+	case <-timeout:
+		return nil, os.ErrDeadlineExceeded
+	}
+	if frame.err != nil {
+		return nil, frame.err
+	}
+	// 在接收协程中解密解码(加密通道握手后才能解密,握手前其他流的包会使握手失败)
+	pack, err := this.decodeFrame(conn, frame)
+	if err != nil {
+		return nil, err
+	}
+	if frame.stream != conn.MainStream() {
+		conn.Route(pack.Topic, frame.stream)
+	}
+	return pack, nil
+}
+
+// decodeFrame 解密解码一个数据包(其他流使用各自的解密通道)
+func (this *QUICClientAgent) decodeFrame(conn *network.QUICConn, frame quicFrame) (*gate.Pack, error) {
+	if this.channel == nil || frame.stream == conn.MainStream() {
+		return this.decodeBody(frame.body)
+	}
+	if this.receivers == nil {
+		this.receivers = map[*network.QUICStream]*secure.Channel{}
+	}
+	rx, ok := this.receivers[frame.stream]
+	if !ok {
+		rx = this.channel.Receiver()
+		this.receivers[frame.stream] = rx
+	}
+	plain, err := rx.Open(frame.body)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt aead, err:%v", err)
+	}
+	return this.unmarshal(plain)
+}
+
+// acceptStreams 接收客户端打开的其他流
+func (this *QUICClientAgent) acceptStreams(conn *network.QUICConn) {
+	for {
+		stream, err := conn.AcceptStream()
+		if err != nil {
+			return
+		}
+		go this.readStream(conn, stream)
+	}
+}
+
+// readStream 读取流中的数据包(主流断开即连接断开,其他流断开只是不再读取)
+func (this *QUICClientAgent) readStream(conn *network.QUICConn, stream *network.QUICStream) {
+	r := bufio.NewReaderSize(stream, this.gate.Options().BufSize)
+	for {
+		body, err := this.readFrame(r)
+		if err != nil && stream != conn.MainStream() {
+			return
+		}
+		select {
+		case this.frames <- quicFrame{stream: stream, body: body, err: err}:
+		case <-conn.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readFrame 读取一个数据包的包体
+func (this *QUICClientAgent) readFrame(r io.Reader) ([]byte, error) {
+	codec := this.codec
+	headData := make([]byte, codec.HeadLen())
+	if _, err := io.ReadFull(r, headData); err != nil {
+		return nil, err
+	}
+	bodyLen, err := codec.ReadHead(headData)
+	if err != nil {
+		return nil, err
+	}
+	if codec.HeadLen()+bodyLen > this.gate.Options().MaxPackSize {
+		return nil, fmt.Errorf("package body size %d exceeds max allowed size %d", codec.HeadLen()+bodyLen, this.gate.Options().MaxPackSize)
+	}
+	bodyData := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, bodyData); err != nil {
+		return nil, err
+	}
+	return bodyData, nil
+}
@@ -0,0 +1,108 @@
+package gatebase
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/network"
+	"github.com/cloudapex/river/tools/secure"
+	"github.com/stretchr/testify/assert"
+)
+
+// quicTestAgent 把连接交给测试,等待连接关闭
+type quicTestAgent struct{ conn *network.QUICConn }
+
+func (a *quicTestAgent) Run() error {
+	<-a.conn.Done()
+	return nil
+}
+
+func (a *quicTestAgent) OnClose() error { return nil }
+
+// newTestQUICServer 返回服务端连接的chan
+func newTestQUICServer(t *testing.T) (*network.QUICServer, chan *network.QUICConn) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	conns := make(chan *network.QUICConn, 1)
+	server := &network.QUICServer{
+		Addr:        "127.0.0.1:0",
+		TLSConfig:   &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		IdleTimeout: 5 * time.Second,
+		NewAgent: func(c *network.QUICConn) network.Client {
+			conns <- c
+			return &quicTestAgent{conn: c}
+		},
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, conns
+}
+
+func TestQUICAgentSecureStreams(t *testing.T) {
+	server, conns := newTestQUICServer(t)
+	client, err := network.DialQUIC("https://"+server.LocalAddr().String()+"/", &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// 加密通道(握手过程见secureHandshake,这里直接派生)
+	skx, _ := secure.NewKeyExchange()
+	ckx, _ := secure.NewKeyExchange()
+	sch, err := skx.Channel(secure.CipherAESGCM, ckx.PublicKey(), nil, true)
+	assert.NoError(t, err)
+	cch, err := ckx.Channel(secure.CipherAESGCM, skx.PublicKey(), nil, false)
+	assert.NoError(t, err)
+
+	gt := newTestResumeGate(gate.SecureCipher(secure.CipherAESGCM))
+	codec := gt.opts.Codec
+	frame := func(topic string) []byte {
+		body, err := codec.Marshal(&gate.Pack{Topic: topic})
+		assert.NoError(t, err)
+		body = cch.Seal(body)
+		head, _ := codec.WriteHead(len(body))
+		return append(head, body...)
+	}
+
+	// 客户端依次在主流、战斗流、主流上发送
+	f1, f2, f3 := frame("chat/1"), frame("chat/2"), frame("chat/3")
+	_, err = client.Write(f1)
+	assert.NoError(t, err)
+	sc := <-conns
+	battle, err := client.OpenStream()
+	assert.NoError(t, err)
+	_, err = battle.Write(f2)
+	assert.NoError(t, err)
+	_, err = client.Write(f3)
+	assert.NoError(t, err)
+
+	a := NewQUICClientAgent(nil).(*QUICClientAgent)
+	a.impl, a.gate, a.codec, a.conn, a.channel = a, gt, codec, sc, sch
+	var topics []string
+	for i := 0; i < 3; i++ {
+		sc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		pack, err := a.OnReadDecodingPack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		topics = append(topics, pack.Topic)
+	}
+	assert.ElementsMatch(t, []string{"chat/1", "chat/2", "chat/3"}, topics)
+
+	// 下行消息发送到客户端最后使用的流上
+	_, err = sc.WriteTopic("chat/9", []byte("x"))
+	assert.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = battle.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "x", string(buf))
+}
@@ -1,14 +1,11 @@
 package gatebase
 
 import (
-	"encoding/base64"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"sync"
 
 	"github.com/cloudapex/river/gate"
-	"github.com/cloudapex/river/tools/aes"
 )
 
 func NewTCPClientAgent(h gate.FunRecvPackHandler) gate.IClientAgent {
@@ -16,7 +13,7 @@ func NewTCPClientAgent(h gate.FunRecvPackHandler) gate.IClientAgent {
 		agentBase: agentBase{recvHandler: h},
 		pkgLenDataPool: &sync.Pool{
 			New: func() interface{} {
-				return make([]byte, gate.PACK_HEAD_TOTAL_LEN_SIZE)
+				return make([]byte, 8) // 足够存放常见的长度头
 			},
 		},
 		bodyDataPool: &sync.Pool{
@@ -37,23 +34,30 @@ type TCPClientAgent struct {
 
 // 读取数据并解码出Pack
 func (this *TCPClientAgent) OnReadDecodingPack() (*gate.Pack, error) {
-	// 从缓冲池获取包长度数据缓冲区
+	codec := this.codec
+
+	// 从缓冲池获取长度头数据缓冲区
 	pkgLenData := this.pkgLenDataPool.Get().([]byte)
 	defer this.pkgLenDataPool.Put(pkgLenData)
+	headData := pkgLenData
+	if codec.HeadLen() > len(headData) {
+		headData = make([]byte, codec.HeadLen())
+	}
+	headData = headData[:codec.HeadLen()]
 
-	// 1 读取pack长度(2字节)
-	_, err := io.ReadFull(this.r, pkgLenData)
+	// 1 读取长度头
+	_, err := io.ReadFull(this.r, headData)
 	if err != nil {
 		return nil, err
 	}
-	// 1.1 解出pack长度 pkgLen
-	pkgLen := binary.LittleEndian.Uint16(pkgLenData)
-	if pkgLen > uint16(this.gate.Options().MaxPackSize) {
-		return nil, fmt.Errorf("package body size %d exceeds max allowed size %d", pkgLen, this.gate.Options().MaxPackSize)
+	// 1.1 解出包体长度 bodyLen
+	bodyLen, err := codec.ReadHead(headData)
+	if err != nil {
+		return nil, err
+	}
+	if codec.HeadLen()+bodyLen > this.gate.Options().MaxPackSize {
+		return nil, fmt.Errorf("package body size %d exceeds max allowed size %d", codec.HeadLen()+bodyLen, this.gate.Options().MaxPackSize)
 	}
-
-	// 1.2 计算需要的包体大小
-	bodyLen := int(pkgLen - gate.PACK_HEAD_TOTAL_LEN_SIZE)
 
 	var bodyData []byte
 	var needPutBack bool
@@ -81,32 +85,6 @@ func (this *TCPClientAgent) OnReadDecodingPack() (*gate.Pack, error) {
 	if err != nil {
 		return nil, err
 	}
-	if this.gate.Options().EncryptKey != "" {
-		kl := len(this.gate.Options().EncryptKey)
-		cbc, err := aes.DecryContentWithAESCBC(bodyData, []byte(this.gate.Options().EncryptKey), []byte(this.gate.Options().EncryptKey)[kl-16:])
-		if err != nil {
-			return nil, fmt.Errorf("decrypt cbc, err:%v", err)
-		}
-		b64Data, err := base64.StdEncoding.DecodeString(string(cbc))
-		if err != nil {
-			return nil, fmt.Errorf("decrypt base64, err:%v", err)
-		}
-		bodyData = b64Data
-	}
-	// 检查解密后的数据长度是否足够
-	if len(bodyData) < gate.PACK_HEAD_MSG_ID_LEN_SIZE {
-		return nil, fmt.Errorf("package len too small after decrypt")
-	}
-	// 3 从body中读取msgid长度(2个字节)
-	topicLen := binary.LittleEndian.Uint16(bodyData[0:gate.PACK_HEAD_MSG_ID_LEN_SIZE])
-
-	// 检查数据长度是否足够包含topic和body
-	if len(bodyData) < int(gate.PACK_HEAD_MSG_ID_LEN_SIZE+topicLen) {
-		return nil, fmt.Errorf("package len not enough for topic and body")
-	}
-	// 4 取得 string版msg_id 和 msg data
-	return &gate.Pack{
-		Topic: string(bodyData[gate.PACK_HEAD_MSG_ID_LEN_SIZE : gate.PACK_HEAD_MSG_ID_LEN_SIZE+topicLen]),
-		Body:  bodyData[gate.PACK_HEAD_MSG_ID_LEN_SIZE+topicLen:],
-	}, nil
+	// 3 解密并解码包体
+	return this.decodeBody(bodyData)
 }
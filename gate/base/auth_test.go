@@ -0,0 +1,68 @@
+package gatebase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowAuthenticator 等待release或ctx结束
+type slowAuthenticator struct{ release chan struct{} }
+
+func (a *slowAuthenticator) Authenticate(ctx context.Context, token string) (string, map[string]string, error) {
+	select {
+	case <-a.release:
+		return token, map[string]string{"role": "gm"}, nil
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+}
+
+// popControl 等待发送队列中的下一个控制包
+func popControl(t *testing.T, a *TCPClientAgent) *gate.Pack {
+	var pack *gate.Pack
+	assert.Eventually(t, func() bool {
+		p, control, ok := a.sendPackBuff.pop(false)
+		if ok && control {
+			pack = p
+		}
+		return ok
+	}, time.Second, time.Millisecond)
+	return pack
+}
+
+func TestHandleAuthAsync(t *testing.T) {
+	auth := &slowAuthenticator{release: make(chan struct{})}
+	opts := []gate.Option{gate.Authenticator(auth), gate.AuthTimeout(time.Minute)}
+	_, agents := newTestDelegate(t, opts, nil, "auth-s1")
+	a := agents["auth-s1"]
+
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH, Body: []byte("auth-user")}))
+	// 等待认证时接收协程不阻塞
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_PING}))
+	assert.Equal(t, gate.PACK_TOPIC_PONG, popControl(t, a).Topic)
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH, Body: []byte("other")}))
+	assert.Equal(t, gate.PACK_TOPIC_AUTH_FAILED, popControl(t, a).Topic) // 同时只能有一个认证
+
+	close(auth.release)
+	pack := popControl(t, a)
+	assert.Equal(t, gate.PACK_TOPIC_AUTH, pack.Topic)
+	assert.Equal(t, "auth-user", string(pack.Body))
+	assert.Equal(t, "auth-user", a.GetSession().GetUserID())
+	role, _ := a.GetSession().Get("role")
+	assert.Equal(t, "gm", role)
+}
+
+func TestHandleAuthTimeout(t *testing.T) {
+	auth := &slowAuthenticator{release: make(chan struct{})}
+	opts := []gate.Option{gate.Authenticator(auth), gate.AuthTimeout(20 * time.Millisecond)}
+	_, agents := newTestDelegate(t, opts, nil, "auth-s2")
+	a := agents["auth-s2"]
+
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_AUTH, Body: []byte("auth-user")}))
+	assert.Equal(t, gate.PACK_TOPIC_AUTH_FAILED, popControl(t, a).Topic)
+	assert.True(t, a.GetSession().IsGuest())
+}
@@ -0,0 +1,41 @@
+package gatebase
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentCompress(t *testing.T) {
+	gt := &GateBase{opts: gate.NewOptions(gate.Compression(gate.CompressGzip), gate.CompressThreshold(64), gate.MaxPackSize(4096))}
+	a := newTestAgent(gt, nil)
+	c, _ := gate.GetCompressor(gate.CompressGzip)
+	a.compressor.Store(c)
+
+	// 小于阈值不压缩
+	small := &gate.Pack{Topic: "chat/say", Body: []byte("hi")}
+	assert.Same(t, small, a.compress(small))
+
+	body := bytes.Repeat([]byte("x"), 1024)
+	pack := &gate.Pack{Topic: "chat/say", Body: body}
+	zipped := a.compress(pack)
+	assert.NotSame(t, pack, zipped)
+	assert.Equal(t, gate.PACK_FLAG_COMPRESSED, zipped.Flags)
+	assert.Equal(t, body, pack.Body) // 不修改原Pack
+	assert.Same(t, zipped, a.compress(zipped))
+
+	assert.NoError(t, a.decompress(zipped))
+	assert.Equal(t, body, zipped.Body)
+	assert.Zero(t, zipped.Flags)
+
+	// 解压后超过MaxPackSize
+	data, err := c.Compress(bytes.Repeat([]byte("x"), 4097))
+	assert.NoError(t, err)
+	assert.Error(t, a.decompress(&gate.Pack{Topic: "chat/say", Body: data, Flags: gate.PACK_FLAG_COMPRESSED}))
+
+	// 未协商压缩时不接受压缩的包
+	b := newTestAgent(gt, nil)
+	assert.Error(t, b.decompress(&gate.Pack{Topic: "chat/say", Body: data, Flags: gate.PACK_FLAG_COMPRESSED}))
+}
@@ -5,18 +5,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
-
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/cloudapex/river/gate"
 	"github.com/cloudapex/river/log"
 	"github.com/cloudapex/river/tools"
 )
 
+// 踢下线时延迟关闭连接的时间
+const kickCloseDelay = 500 * time.Millisecond
+
 // NewDelegate NewDelegate
 func NewDelegate(gate gate.IGate) *Delegate {
 	return &Delegate{
-		gate: gate,
+		gate:   gate,
+		groups: newGroupManager(),
 	}
 }
 
@@ -25,16 +30,21 @@ type Delegate struct {
 	gate     gate.IGate
 	sessions sync.Map //连接列表
 	lock     sync.RWMutex
-	agentNum int // session size
+	agentNum int           // session size
+	groups   *groupManager // 分组成员
 }
 
 // OnDestroy
 func (this *Delegate) OnDestroy() {
 	this.sessions.Range(func(key, value any) bool {
+		disableResume(value.(gate.IClientAgent))
 		value.(gate.IClientAgent).Close()
 		this.sessions.Delete(key)
 		return true
 	})
+	if err := gate.GetPresenceStore().RemoveServer(this.gate.GetServerID()); err != nil {
+		log.Warning("gate presence remove server failure : %v", err)
+	}
 }
 
 // GetAgent
@@ -94,6 +104,8 @@ func (this *Delegate) DisConnect(a gate.IClientAgent) {
 		}
 		if a.GetSession() != nil {
 			this.sessions.Delete(a.GetSession().GetSessionID())
+			this.groups.LeaveAll(a.GetSession().GetSessionID())
+			this.removePresence(a.GetSession())
 			// 已经建联成功的才计算
 			if a.IsShaked() { // 握手
 				this.lock.Lock()
@@ -111,6 +123,103 @@ func (this *Delegate) DisConnect(a gate.IClientAgent) {
 	}
 }
 
+// 记录session绑定用户的在线状态,并按重复登录策略处理该用户的其他连接
+// 占用和替换在在线状态存储中原子地完成,多个gate同时绑定同一用户时只有一个能成功(reject_new)或保留下来(kick_old)
+func (this *Delegate) bindPresence(ctx context.Context, sessionId string, userId string) error {
+	if userId == "" {
+		return nil
+	}
+	p := &gate.UserPresence{UserId: userId, ServerId: this.gate.GetServerID(), SessionId: sessionId}
+	switch this.gate.Options().DuplicateLogin {
+	case gate.DuplicateLoginRejectNew:
+		holders, err := gate.GetPresenceStore().AddIfAbsent(p)
+		if err != nil { // 无法确认是否重复登录时拒绝
+			return fmt.Errorf("gate presence reserve failure: %v", err)
+		}
+		if len(holders) > 0 {
+			return gate.ErrDuplicateLogin
+		}
+	case gate.DuplicateLoginKickOld:
+		replaced, err := gate.GetPresenceStore().Replace(p)
+		if err != nil {
+			log.Warning("gate presence replace failure : %v", err)
+			return nil
+		}
+		for _, old := range replaced {
+			this.kickPresence(ctx, old)
+		}
+	default: // DuplicateLoginAllow(其他值在Init时已被拒绝)
+		if err := gate.GetPresenceStore().Add(p); err != nil {
+			log.Warning("gate presence add failure : %v", err)
+		}
+	}
+	return nil
+}
+
+// 踢掉用户在本gate或其他gate上的连接(重复登录kick_old)
+func (this *Delegate) kickPresence(ctx context.Context, p *gate.UserPresence) {
+	if p.ServerId == this.gate.GetServerID() {
+		if agent, ok := this.sessions.Load(p.SessionId); ok && agent != nil {
+			this.kick(agent.(gate.IClientAgent), gate.KICK_REASON_DUPLICATE_LOGIN)
+		}
+		return
+	}
+	server, err := this.gate.GetServerByID(p.ServerId)
+	if err != nil {
+		return
+	}
+	if _, err := server.GetRPC().Call(ctx, "Kick", p.SessionId, gate.KICK_REASON_DUPLICATE_LOGIN); err != nil {
+		log.Warning("gate kick userId:%v serverId:%v sessionId:%v err:%v", p.UserId, p.ServerId, p.SessionId, err)
+	}
+}
+
+// 下发踢下线通知包后关闭连接
+func (this *Delegate) kick(agent gate.IClientAgent, reason string) {
+	if err := agent.SendPack(&gate.Pack{Topic: gate.PACK_TOPIC_KICKED, Body: []byte(reason)}); err != nil {
+		log.Warning("IAgent.SendPack error:", err.Error())
+	}
+	if learner, ok := this.gate.GetSessionLearner().(gate.IKickLearner); ok {
+		learner.OnKicked(agent.GetSession(), reason)
+	}
+	log.Info("gate kick userId:%v sessionId:%v reason:%v", agent.GetSession().GetUserID(), agent.GetSession().GetSessionID(), reason)
+	// 留出时间让通知包发送出去
+	disableResume(agent)
+	time.AfterFunc(kickCloseDelay, agent.Close)
+}
+
+// 服务端主动关闭的连接不可断线重连
+func disableResume(agent gate.IClientAgent) {
+	if a, ok := agent.(interface{ disableResume() }); ok {
+		a.disableResume()
+	}
+}
+
+// 记录session绑定用户的在线状态
+func (this *Delegate) addPresence(session gate.ISession) {
+	if session.GetUserID() == "" {
+		return
+	}
+	err := gate.GetPresenceStore().Add(&gate.UserPresence{
+		UserId:    session.GetUserID(),
+		ServerId:  this.gate.GetServerID(),
+		SessionId: session.GetSessionID(),
+	})
+	if err != nil {
+		log.Warning("gate presence add failure : %v", err)
+	}
+}
+
+// 清除session绑定用户的在线状态
+func (this *Delegate) removePresence(session gate.ISession) {
+	if session.GetUserID() == "" {
+		return
+	}
+	err := gate.GetPresenceStore().Remove(session.GetUserID(), this.gate.GetServerID(), session.GetSessionID())
+	if err != nil {
+		log.Warning("gate presence remove failure : %v", err)
+	}
+}
+
 // ========== Session相关 RPC方法回调
 
 // Load the latest session
@@ -129,7 +238,18 @@ func (this *Delegate) OnRpcBind(ctx context.Context, sessionId string, userId st
 		return nil, fmt.Errorf("No Sesssion found")
 	}
 
-	agent.(gate.IClientAgent).GetSession().SetUserID(userId)
+	oldUserId := agent.(gate.IClientAgent).GetSession().GetUserID()
+	if oldUserId != userId {
+		if err := this.bindPresence(ctx, sessionId, userId); err != nil {
+			return nil, err
+		}
+		if oldUserId != "" {
+			this.removePresence(agent.(gate.IClientAgent).GetSession())
+		}
+		agent.(gate.IClientAgent).GetSession().SetUserID(userId)
+	} else {
+		this.addPresence(agent.(gate.IClientAgent).GetSession())
+	}
 
 	storager := this.gate.GetStorageHandler()
 	if storager != nil && agent.(gate.IClientAgent).GetSession().GetUserID() != "" {
@@ -159,6 +279,7 @@ func (this *Delegate) OnRpcUnBind(ctx context.Context, sessionId string) (gate.I
 	if !ok || agent == nil {
 		return nil, fmt.Errorf("No Sesssion found")
 	}
+	this.removePresence(agent.(gate.IClientAgent).GetSession())
 	agent.(gate.IClientAgent).GetSession().SetUserID("")
 	return agent.(gate.IClientAgent).GetSession(), nil
 }
@@ -239,6 +360,23 @@ func (this *Delegate) OnRpcSend(ctx context.Context, sessionId string, topic str
 	return true, nil
 }
 
+// Send message to the sessions(sessionId之间用,分割).
+func (this *Delegate) OnRpcSendBatch(ctx context.Context, sessionIds string, topic string, body []byte) (int64, error) {
+	var count int64 = 0
+	for _, sessionId := range strings.Split(sessionIds, ",") {
+		agent, ok := this.sessions.Load(sessionId)
+		if !ok || agent == nil {
+			continue
+		}
+		if e := agent.(gate.IClientAgent).SendPack(&gate.Pack{Topic: topic, Body: body}); e != nil {
+			log.Warning("IAgent.SendPack error:", e.Error())
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
 // check connect is normal for the session
 func (this *Delegate) OnRpcConnected(ctx context.Context, sessionId string) (bool, error) {
 	agent, ok := this.sessions.Load(sessionId)
@@ -254,23 +392,83 @@ func (this *Delegate) OnRpcClose(ctx context.Context, sessionId string) (bool, e
 	if !ok || agent == nil {
 		return false, fmt.Errorf("No Sesssion found")
 	}
+	disableResume(agent.(gate.IClientAgent))
 	agent.(gate.IClientAgent).Close()
 	return true, nil
 }
 
+// kick the session(notify the client before close)
+func (this *Delegate) OnRpcKick(ctx context.Context, sessionId string, reason string) (bool, error) {
+	agent, ok := this.sessions.Load(sessionId)
+	if !ok || agent == nil {
+		return false, fmt.Errorf("No Sesssion found")
+	}
+	this.kick(agent.(gate.IClientAgent), reason)
+	return true, nil
+}
+
 // ========== Global的 RPC方法回调
 
 // broadcast message to all session of the gate
 func (this *Delegate) OnRpcBroadcast(ctx context.Context, topic string, body []byte) (int64, error) {
+	return broadcastSessions(this, topic, body, nil), nil
+}
+
+// broadcastSessions 发送给delegater上满足过滤条件的session(filters为空时发送给所有session),返回发送成功的数量
+func broadcastSessions(delegater gate.IDelegater, topic string, body []byte, filters []gate.SessionFilter) int64 {
 	var count int64 = 0
-	this.sessions.Range(func(key, agent any) bool {
-		e := agent.(gate.IClientAgent).SendPack(&gate.Pack{Topic: topic, Body: body})
-		if e != nil {
+	delegater.SessionsRange(func(key, value any) bool {
+		agent := value.(gate.IClientAgent)
+		if !gate.MatchSessionFilters(filters, agent.GetSession()) {
+			return true
+		}
+		if e := agent.SendPack(&gate.Pack{Topic: topic, Body: body}); e != nil {
 			log.Warning("IAgent.SendPack error:", e.Error())
 		} else {
 			count++
 		}
 		return true
 	})
+	return count
+}
+
+// ========== Group的 RPC方法回调
+
+// join the session to the group
+func (this *Delegate) OnRpcJoinGroup(ctx context.Context, sessionId string, group string) (bool, error) {
+	agent, ok := this.sessions.Load(sessionId)
+	if !ok || agent == nil {
+		return false, fmt.Errorf("No Sesssion found")
+	}
+	// 在分组锁内再次检查,避免与DisConnect交错时断开的session残留在分组中
+	joined, ok := this.groups.Join(group, sessionId, func() bool {
+		cur, ok := this.sessions.Load(sessionId)
+		return ok && cur == agent
+	})
+	if !ok {
+		return false, fmt.Errorf("No Sesssion found")
+	}
+	return joined, nil
+}
+
+// remove the session from the group
+func (this *Delegate) OnRpcLeaveGroup(ctx context.Context, sessionId string, group string) (bool, error) {
+	return this.groups.Leave(group, sessionId), nil
+}
+
+// send message to the members of the group on this gate
+func (this *Delegate) OnRpcGroupSend(ctx context.Context, group string, topic string, body []byte) (int64, error) {
+	var count int64 = 0
+	for _, sessionId := range this.groups.Members(group) {
+		agent, ok := this.sessions.Load(sessionId)
+		if !ok || agent == nil {
+			continue
+		}
+		if e := agent.(gate.IClientAgent).SendPack(&gate.Pack{Topic: topic, Body: body}); e != nil {
+			log.Warning("IAgent.SendPack error:", e.Error())
+			continue
+		}
+		count++
+	}
 	return count, nil
 }
@@ -0,0 +1,160 @@
+package gatebase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+// kickLearner 实现了可选的gate.IKickLearner
+type kickLearner struct{ kicked []string }
+
+func (l *kickLearner) OnConnect(a gate.ISession)    {}
+func (l *kickLearner) OnDisConnect(a gate.ISession) {}
+func (l *kickLearner) OnKicked(a gate.ISession, reason string) {
+	l.kicked = append(l.kicked, a.GetSessionID()+":"+reason)
+}
+
+// plainLearner 没有实现OnKicked的监听器
+type plainLearner struct{}
+
+func (l *plainLearner) OnConnect(a gate.ISession)    {}
+func (l *plainLearner) OnDisConnect(a gate.ISession) {}
+
+// newTestDelegate 带有已连接agent(按sessionId)的Delegate
+func newTestDelegate(t *testing.T, opts []gate.Option, learner gate.ISessionLearner, sessionIds ...string) (*Delegate, map[string]*TCPClientAgent) {
+	gt := &GateBase{opts: gate.NewOptions(opts...), sessionLearner: learner}
+	d := NewDelegate(gt)
+	gt.delegater = d
+	agents := map[string]*TCPClientAgent{}
+	for _, id := range sessionIds {
+		a := newTestAgent(gt, nil)
+		a.session, _ = NewSessionByMap(map[string]any{"SessionId": id})
+		d.sessions.Store(id, a)
+		agents[id] = a
+	}
+	t.Cleanup(func() {
+		for id, a := range agents {
+			if userId := a.GetSession().GetUserID(); userId != "" {
+				gate.GetPresenceStore().Remove(userId, gt.GetServerID(), id)
+			}
+		}
+	})
+	return d, agents
+}
+
+func TestDuplicateLoginKickOld(t *testing.T) {
+	learner := &kickLearner{}
+	d, agents := newTestDelegate(t, []gate.Option{gate.DuplicateLogin(gate.DuplicateLoginKickOld)}, learner, "dup-k1", "dup-k2")
+	_, err := d.OnRpcBind(context.TODO(), "dup-k1", "dup-kick-user")
+	assert.NoError(t, err)
+	_, err = d.OnRpcBind(context.TODO(), "dup-k2", "dup-kick-user")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"dup-k1:" + gate.KICK_REASON_DUPLICATE_LOGIN}, learner.kicked)
+	pack, _, ok := agents["dup-k1"].sendPackBuff.pop(false)
+	if assert.True(t, ok) {
+		assert.Equal(t, gate.PACK_TOPIC_KICKED, pack.Topic)
+	}
+	_, _, ok = agents["dup-k2"].sendPackBuff.pop(false)
+	assert.False(t, ok)
+	list, err := gate.GetPresenceStore().Query("dup-kick-user")
+	assert.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "dup-k2", list[0].SessionId)
+	}
+}
+
+func TestDuplicateLoginRejectNew(t *testing.T) {
+	d, _ := newTestDelegate(t, []gate.Option{gate.DuplicateLogin(gate.DuplicateLoginRejectNew)}, &plainLearner{}, "dup-r1", "dup-r2")
+	_, err := d.OnRpcBind(context.TODO(), "dup-r1", "dup-reject-user")
+	assert.NoError(t, err)
+	_, err = d.OnRpcBind(context.TODO(), "dup-r2", "dup-reject-user")
+	assert.ErrorIs(t, err, gate.ErrDuplicateLogin)
+	_, err = d.OnRpcBind(context.TODO(), "dup-r1", "dup-reject-user") // 重复绑定同一个连接
+	assert.NoError(t, err)
+}
+
+func TestDuplicateLoginRejectNewConcurrent(t *testing.T) {
+	// 两个gate同时绑定同一个用户,只有一个成功
+	opts := []gate.Option{gate.DuplicateLogin(gate.DuplicateLoginRejectNew)}
+	for i := 0; i < 20; i++ {
+		userId := fmt.Sprintf("dup-race-user-%d", i)
+		d1, _ := newTestDelegate(t, opts, &plainLearner{}, "dup-race-1")
+		d2, _ := newTestDelegate(t, opts, &plainLearner{}, "dup-race-2")
+		errs := make(chan error, 2)
+		go func() { _, err := d1.OnRpcBind(context.TODO(), "dup-race-1", userId); errs <- err }()
+		go func() { _, err := d2.OnRpcBind(context.TODO(), "dup-race-2", userId); errs <- err }()
+		err1, err2 := <-errs, <-errs
+		assert.True(t, (err1 == nil) != (err2 == nil), "%v %v", err1, err2)
+		list, _ := gate.GetPresenceStore().Query(userId)
+		assert.Len(t, list, 1)
+		for _, id := range []string{"dup-race-1", "dup-race-2"} {
+			_ = gate.GetPresenceStore().Remove(userId, "", id)
+		}
+	}
+}
+
+// failPresenceStore 占用和替换时返回错误的在线状态存储
+type failPresenceStore struct {
+	gate.IPresenceStore
+}
+
+func (failPresenceStore) AddIfAbsent(p *gate.UserPresence) ([]*gate.UserPresence, error) {
+	return nil, errors.New("store down")
+}
+
+func TestDuplicateLoginRejectNewStoreError(t *testing.T) {
+	origin := gate.GetPresenceStore()
+	gate.SetPresenceStore(failPresenceStore{IPresenceStore: origin})
+	t.Cleanup(func() { gate.SetPresenceStore(origin) })
+
+	d, agents := newTestDelegate(t, []gate.Option{gate.DuplicateLogin(gate.DuplicateLoginRejectNew)}, &plainLearner{}, "dup-e1")
+	_, err := d.OnRpcBind(context.TODO(), "dup-e1", "dup-error-user")
+	assert.Error(t, err)
+	assert.Equal(t, "", agents["dup-e1"].GetSession().GetUserID())
+}
+
+func TestDuplicateLoginAllow(t *testing.T) {
+	// 没有实现IKickLearner的监听器同样可用
+	d, agents := newTestDelegate(t, []gate.Option{gate.DuplicateLogin(gate.DuplicateLoginAllow)}, &plainLearner{}, "dup-a1", "dup-a2")
+	_, err := d.OnRpcBind(context.TODO(), "dup-a1", "dup-allow-user")
+	assert.NoError(t, err)
+	_, err = d.OnRpcBind(context.TODO(), "dup-a2", "dup-allow-user")
+	assert.NoError(t, err)
+	_, _, ok := agents["dup-a1"].sendPackBuff.pop(false)
+	assert.False(t, ok)
+	list, _ := gate.GetPresenceStore().Query("dup-allow-user")
+	assert.Len(t, list, 2)
+}
+
+func TestBroadcastSessions(t *testing.T) {
+	d, agents := newTestDelegate(t, nil, nil, "bc-1", "bc-2", "bc-3")
+	agents["bc-1"].GetSession().Set("region", "eu")
+	agents["bc-2"].GetSession().Set("region", "us")
+
+	filters, err := gate.ParseSessionFilters([]string{"region=eu"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), broadcastSessions(d, "chat/notice", []byte("eu"), filters))
+	pack, _, ok := agents["bc-1"].sendPackBuff.pop(false)
+	if assert.True(t, ok) {
+		assert.Equal(t, []byte("eu"), pack.Body)
+	}
+	for _, id := range []string{"bc-2", "bc-3"} {
+		_, _, ok = agents[id].sendPackBuff.pop(false)
+		assert.False(t, ok, id)
+	}
+
+	// 没有过滤条件时发送给所有session
+	count, err := d.OnRpcBroadcast(context.TODO(), "chat/notice", []byte("all"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	for id, a := range agents {
+		_, _, ok = a.sendPackBuff.pop(false)
+		assert.True(t, ok, id)
+	}
+}
@@ -0,0 +1,105 @@
+package gatebase
+
+import "sync"
+
+// newGroupManager 创建gate本地的分组成员管理
+func newGroupManager() *groupManager {
+	return &groupManager{
+		groups: map[string]map[string]struct{}{},
+		joined: map[string]map[string]struct{}{},
+	}
+}
+
+// groupManager gate本地的分组(房间/频道)成员管理
+type groupManager struct {
+	lock   sync.RWMutex
+	groups map[string]map[string]struct{} // group -> sessionIds
+	joined map[string]map[string]struct{} // sessionId -> groups
+}
+
+// Join 加入分组(已在分组中返回false)
+// alive在分组锁内检查session是否仍然在线(断开连接时先移除session再LeaveAll),不在线时不加入并返回ok=false
+func (g *groupManager) Join(group, sessionId string, alive func() bool) (joined bool, ok bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if alive != nil && !alive() {
+		return false, false
+	}
+	members, ok := g.groups[group]
+	if !ok {
+		members = map[string]struct{}{}
+		g.groups[group] = members
+	}
+	if _, ok := members[sessionId]; ok {
+		return false, true
+	}
+	members[sessionId] = struct{}{}
+
+	groups, ok := g.joined[sessionId]
+	if !ok {
+		groups = map[string]struct{}{}
+		g.joined[sessionId] = groups
+	}
+	groups[group] = struct{}{}
+	return true, true
+}
+
+// Leave 离开分组(不在分组中返回false)
+func (g *groupManager) Leave(group, sessionId string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.leave(group, sessionId)
+}
+
+// LeaveAll 离开所有分组(断开连接时清理)
+func (g *groupManager) LeaveAll(sessionId string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for group := range g.joined[sessionId] {
+		g.leave(group, sessionId)
+	}
+}
+
+func (g *groupManager) leave(group, sessionId string) bool {
+	members, ok := g.groups[group]
+	if !ok {
+		return false
+	}
+	if _, ok := members[sessionId]; !ok {
+		return false
+	}
+	delete(members, sessionId)
+	if len(members) == 0 {
+		delete(g.groups, group)
+	}
+	if groups, ok := g.joined[sessionId]; ok {
+		delete(groups, group)
+		if len(groups) == 0 {
+			delete(g.joined, sessionId)
+		}
+	}
+	return true
+}
+
+// Members 分组在本gate上的成员sessionId列表
+func (g *groupManager) Members(group string) []string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	members := make([]string, 0, len(g.groups[group]))
+	for sessionId := range g.groups[group] {
+		members = append(members, sessionId)
+	}
+	return members
+}
+
+// Groups session加入的分组列表
+func (g *groupManager) Groups(sessionId string) []string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	groups := make([]string, 0, len(g.joined[sessionId]))
+	for group := range g.joined[sessionId] {
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,89 @@
+package gatebase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupManager(t *testing.T) {
+	g := newGroupManager()
+	joined, ok := g.Join("room1", "s1", nil)
+	assert.True(t, joined)
+	assert.True(t, ok)
+	joined, ok = g.Join("room1", "s1", nil)
+	assert.False(t, joined) // 已在分组中
+	assert.True(t, ok)
+	g.Join("room1", "s2", nil)
+	g.Join("room2", "s1", nil)
+
+	assert.ElementsMatch(t, []string{"s1", "s2"}, g.Members("room1"))
+	assert.ElementsMatch(t, []string{"room1", "room2"}, g.Groups("s1"))
+	assert.Empty(t, g.Members("room3"))
+
+	assert.True(t, g.Leave("room1", "s2"))
+	assert.False(t, g.Leave("room1", "s2"))
+	assert.False(t, g.Leave("room3", "s1"))
+	assert.Equal(t, []string{"s1"}, g.Members("room1"))
+
+	g.LeaveAll("s1")
+	assert.Empty(t, g.Groups("s1"))
+	assert.Empty(t, g.Members("room1"))
+	// 空分组和空的session记录都被清理
+	assert.Empty(t, g.groups)
+	assert.Empty(t, g.joined)
+
+	joined, ok = g.Join("room1", "s3", func() bool { return false })
+	assert.False(t, joined)
+	assert.False(t, ok)
+	assert.Empty(t, g.groups)
+}
+
+func TestGroupJoinRPC(t *testing.T) {
+	d, agents := newTestDelegate(t, nil, nil, "grp-1", "grp-2")
+	joined, err := d.OnRpcJoinGroup(context.TODO(), "grp-1", "room")
+	assert.NoError(t, err)
+	assert.True(t, joined)
+	_, err = d.OnRpcJoinGroup(context.TODO(), "grp-2", "room")
+	assert.NoError(t, err)
+	_, err = d.OnRpcJoinGroup(context.TODO(), "grp-x", "room")
+	assert.Error(t, err)
+
+	count, err := d.OnRpcGroupSend(context.TODO(), "room", "chat/room", []byte("hi"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	left, err := d.OnRpcLeaveGroup(context.TODO(), "grp-2", "room")
+	assert.NoError(t, err)
+	assert.True(t, left)
+	d.DisConnect(agents["grp-1"])
+	assert.Empty(t, d.groups.Members("room"))
+}
+
+func TestGroupJoinDisconnectRace(t *testing.T) {
+	d, agents := newTestDelegate(t, nil, nil, "grp-race")
+	// JoinGroup已经查到session,等待分组锁时连接断开
+	d.groups.lock.Lock()
+	joinErr := make(chan error, 1)
+	go func() {
+		_, err := d.OnRpcJoinGroup(context.TODO(), "grp-race", "room")
+		joinErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go d.DisConnect(agents["grp-race"])
+	assert.Eventually(t, func() bool {
+		_, ok := d.sessions.Load("grp-race")
+		return !ok
+	}, time.Second, time.Millisecond)
+	d.groups.lock.Unlock()
+
+	assert.Error(t, <-joinErr)
+	assert.Eventually(t, func() bool {
+		d.groups.lock.RLock()
+		defer d.groups.lock.RUnlock()
+		return len(d.groups.joined) == 0
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, d.groups.Members("room"))
+}
@@ -0,0 +1,138 @@
+package gatebase
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/network"
+	"github.com/stretchr/testify/assert"
+)
+
+// heartbeatTestConn 记录是否被关闭的连接
+type heartbeatTestConn struct {
+	network.Conn
+	closed chan struct{}
+}
+
+func (c *heartbeatTestConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+// heartbeatTestStorage 记录Heartbeat调用次数
+type heartbeatTestStorage struct {
+	gate.StorageHandler
+	beats atomic.Int32
+}
+
+func (s *heartbeatTestStorage) Heartbeat(session gate.ISession) { s.beats.Add(1) }
+
+func timestampBody(t time.Time) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint64(body, uint64(t.UnixNano()))
+	return body
+}
+
+func TestHeartbeatPingPong(t *testing.T) {
+	a := newTestAgent(&GateBase{opts: gate.NewOptions()}, func(session gate.ISession, pack *gate.Pack) error {
+		t.Fatalf("heartbeat forwarded: %s", pack.Topic)
+		return nil
+	})
+	conn := newTestTCPConn(t, a)
+	first, second := timestampBody(time.Unix(1, 0)), timestampBody(time.Unix(2, 0))
+	writeTestPack(t, a, conn, &gate.Pack{Topic: gate.PACK_TOPIC_PING, Body: first})
+	writeTestPack(t, a, conn, &gate.Pack{Topic: gate.PACK_TOPIC_PING, Body: second})
+	recvTestPacks(t, a, 2)
+
+	// pong原样带回ping的时间戳(在发送协程中发送时包体不能被后续读取覆盖)
+	for _, want := range [][]byte{first, second} {
+		pack, control, ok := a.sendPackBuff.pop(false)
+		if assert.True(t, ok && control) {
+			assert.Equal(t, gate.PACK_TOPIC_PONG, pack.Topic)
+			assert.Equal(t, want, pack.Body)
+		}
+	}
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	a := newTestAgent(&GateBase{opts: gate.NewOptions()}, nil)
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_PONG, Body: timestampBody(time.Now().Add(-50 * time.Millisecond))}))
+	assert.GreaterOrEqual(t, a.RTT(), 50*time.Millisecond)
+	assert.Less(t, a.RTT(), time.Second)
+
+	// 格式错误或来自未来的时间戳不更新
+	rtt := a.RTT()
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_PONG, Body: []byte("bad")}))
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_PONG, Body: timestampBody(time.Now().Add(time.Hour))}))
+	assert.Equal(t, rtt, a.RTT())
+	_, _, ok := a.sendPackBuff.pop(false)
+	assert.False(t, ok)
+}
+
+func TestHeartbeatIdleClose(t *testing.T) {
+	interval := 50 * time.Millisecond
+	a := newTestAgent(&GateBase{opts: gate.NewOptions(gate.HeartbeatInterval(interval))}, nil)
+	conn := &heartbeatTestConn{closed: make(chan struct{})}
+	a.conn = conn
+	start := time.Now()
+	atomic.StoreInt64(&a.lastRecv, start.UnixNano())
+	done := make(chan struct{})
+	go func() {
+		a.heartbeatLoop()
+		close(done)
+	}()
+
+	// 空闲超过interval发送ping
+	pack, control, ok := a.sendPackBuff.pop(true)
+	if assert.True(t, ok && control) {
+		assert.Equal(t, gate.PACK_TOPIC_PING, pack.Topic)
+		assert.Len(t, pack.Body, 8)
+	}
+	// 超过2*interval没有收到数据则断开
+	select {
+	case <-conn.closed:
+		assert.GreaterOrEqual(t, time.Since(start), 2*interval)
+	case <-time.After(time.Second):
+		t.Fatal("idle connection not closed")
+	}
+	<-done
+}
+
+func TestHeartbeatStorage(t *testing.T) {
+	interval := 20 * time.Millisecond
+	storage := &heartbeatTestStorage{}
+	gt := &GateBase{opts: gate.NewOptions(gate.HeartbeatInterval(interval)), storager: storage}
+	a := newTestAgent(gt, nil)
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		// 一直有数据,不发ping也不断开
+		for {
+			atomic.StoreInt64(&a.lastRecv, time.Now().UnixNano())
+			select {
+			case <-stop:
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+		}
+	}()
+	go func() {
+		a.heartbeatLoop()
+		close(done)
+	}()
+
+	// 未绑定用户时不调用
+	time.Sleep(3 * interval)
+	assert.Equal(t, int32(0), storage.beats.Load())
+	a.session.SetUserID("hb-user")
+	assert.Eventually(t, func() bool { return storage.beats.Load() >= 2 }, time.Second, time.Millisecond)
+	_, _, ok := a.sendPackBuff.pop(false)
+	assert.False(t, ok)
+
+	atomic.StoreInt32(&a.isClosed, 1)
+	<-done
+	close(stop)
+}
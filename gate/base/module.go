@@ -1,16 +1,23 @@
 package gatebase
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/cloudapex/river/app"
 	"github.com/cloudapex/river/conf"
 	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/log"
 	"github.com/cloudapex/river/module"
+	"github.com/cloudapex/river/mqrpc"
 	"github.com/cloudapex/river/network"
+	"github.com/cloudapex/river/tools/iptool"
+	"github.com/cloudapex/river/tools/secure"
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var _ app.IRPCModule = &GateBase{}
@@ -24,35 +31,40 @@ type GateBase struct {
 	agentCreater func(netTyp string) gate.IClientAgent // 创建客户端连接代理接口
 	shakeHandle  func(r *http.Request) error           // 建立连接时鉴权(ws)
 
+	// 建立连接时的握手钩子(ws): 返回的值放入session的Settings
+	handshake func(r *http.Request) (map[string]string, error)
+
 	storager        gate.StorageHandler     // Session持久化接口
 	router          gate.RouteHandler       // 路由控制接口
 	sessionLearner  gate.ISessionLearner    // 客户端连接和断开的监听器(业务使用)
 	agentLearner    gate.IAgentLearner      // 客户端连接和断开的监听器(内部使用)
 	recvPackHandler gate.FunRecvPackHandler // 接收数据包处理接口
 	sendMessageHook gate.FunSendMessageHook // 发送消息时的钩子回调
+	stickyRouter    *StickyRouter           // 有状态模块的用户粘性路由
+	resumer         *sessionResumer         // 断线重连(未开启时为nil)
+	stats           gateStats               // 运行统计
 }
 
 func (this *GateBase) Init(subclass app.IRPCModule, settings *conf.ModuleSettings, opts ...gate.Option) {
 	this.ModuleBase.Init(subclass, settings, this.opts.Opts...) // 这是必须的
 
-	// 使用settings的配置覆盖opts
-	for k, v := range settings.Settings {
-		switch k {
-		case gate.SettingKeyWSAddr:
-			this.opts.WsAddr = v.(string)
-		case gate.SettingKeyTCPAddr:
-			this.opts.TcpAddr = v.(string)
-		case gate.SettingKeyTLS:
-			this.opts.TLS = v.(bool)
-		case gate.SettingKeyCertFile:
-			this.opts.CertFile = v.(string)
-		case gate.SettingKeyKeyFile:
-			this.opts.KeyFile = v.(string)
-		case gate.SettingKeyEncryptKey:
-			this.opts.EncryptKey = v.(string)
+	// 使用settings的配置覆盖opts(settings中的Option追加在代码传入的opts之后)
+	opts = append(opts, settingOptions(settings.Settings)...)
+	this.opts = gate.NewOptions(opts...)
+	if err := this.opts.Validate(); err != nil {
+		panic(err.Error())
+	}
+	if p := this.opts.DuplicateLogin; p != "" && p != gate.DuplicateLoginAllow && gate.IsMemoryPresenceStore() {
+		log.Warning("gate %s with in-memory presence store: only sessions of this process are checked, use gate.SetPresenceStore in cluster mode", gate.SettingKeyDuplicateLogin)
+	}
+	if this.opts.SecureCipher != "" {
+		if _, err := secure.NewAEAD(this.opts.SecureCipher, make([]byte, secure.KeySize)); err != nil {
+			panic(fmt.Sprintf("gate setting %s err:%v", gate.SettingKeySecureCipher, err))
+		}
+		if this.opts.EncryptKey == "" {
+			log.Warning("gate %s without %s: key exchange is not authenticated", gate.SettingKeySecureCipher, gate.SettingKeyEncryptKey)
 		}
 	}
-	this.opts = gate.NewOptions(opts...)
 
 	// for member
 	delegate := NewDelegate(this)
@@ -60,6 +72,8 @@ func (this *GateBase) Init(subclass app.IRPCModule, settings *conf.ModuleSetting
 	this.agentLearner = delegate
 	this.agentCreater = this.defaultClientAgentCreater
 	this.recvPackHandler = this.defaultRecvPackHandler
+	this.stickyRouter = NewStickyRouter(this, this.opts.StickyModules)
+	this.resumer = newSessionResumer(delegate, this.opts)
 
 	// for session
 	this.RegisterGO("Load", delegate.OnRpcLoad)
@@ -71,9 +85,157 @@ func (this *GateBase) Init(subclass app.IRPCModule, settings *conf.ModuleSetting
 	this.RegisterGO("Send", delegate.OnRpcSend)
 	this.RegisterGO("Connected", delegate.OnRpcConnected)
 	this.RegisterGO("Close", delegate.OnRpcClose)
+	this.RegisterGO("Kick", delegate.OnRpcKick)
+	this.RegisterGO("SendBatch", delegate.OnRpcSendBatch)
+	this.RegisterGO("JoinGroup", delegate.OnRpcJoinGroup)
+	this.RegisterGO("LeaveGroup", delegate.OnRpcLeaveGroup)
 	// for global
 	this.RegisterGO("Broadcast", delegate.OnRpcBroadcast)
+	this.RegisterGO("GroupSend", delegate.OnRpcGroupSend)
 }
+
+// settingOptions 把settings中的网关配置转换为Option(配置错误时panic)
+func settingOptions(settings map[string]any) []gate.Option {
+	var opts []gate.Option
+	authModule, authMethod := "", "Auth"
+	for k, v := range settings {
+		switch k {
+		case gate.SettingKeyWSAddr:
+			opts = append(opts, gate.WsAddr(v.(string)))
+		case gate.SettingKeyTCPAddr:
+			opts = append(opts, gate.TCPAddr(v.(string)))
+		case gate.SettingKeyKCPAddr:
+			opts = append(opts, gate.KCPAddr(v.(string)))
+		case gate.SettingKeyQUICAddr:
+			opts = append(opts, gate.QUICAddr(v.(string)))
+		case gate.SettingKeyQUICPath:
+			opts = append(opts, gate.QUICPath(v.(string)))
+		case gate.SettingKeyTLS:
+			opts = append(opts, gate.TLS(v.(bool)))
+		case gate.SettingKeyCertFile:
+			opts = append(opts, gate.CertFile(v.(string)))
+		case gate.SettingKeyKeyFile:
+			opts = append(opts, gate.KeyFile(v.(string)))
+		case gate.SettingKeyEncryptKey:
+			opts = append(opts, gate.EncryptKey(v.(string)))
+		case gate.SettingKeySecureCipher:
+			opts = append(opts, gate.SecureCipher(v.(string)))
+		case gate.SettingKeyTLSOptions:
+			tlsOpts, err := network.ParseTLSOptions(v)
+			if err != nil {
+				panic(fmt.Sprintf("gate setting %s err:%v", k, err))
+			}
+			opts = append(opts, gate.WithTLSOptions(tlsOpts))
+		case gate.SettingKeyProxyProtocol:
+			opts = append(opts, gate.ProxyProtocol(v.(bool)))
+		case gate.SettingKeyTrustedProxies:
+			for _, cidr := range v.([]any) {
+				opts = append(opts, gate.TrustedProxies(cidr.(string)))
+			}
+		case gate.SettingKeyCompression:
+			opts = append(opts, gate.Compression(v.(string)))
+		case gate.SettingKeyCompressThreshold:
+			opts = append(opts, gate.CompressThreshold(int(v.(float64))))
+		case gate.SettingKeyWSCompression:
+			opts = append(opts, gate.WSCompression(v.(bool)))
+		case gate.SettingKeyWSAllowedOrigins:
+			for _, origin := range v.([]any) {
+				opts = append(opts, gate.WSAllowedOrigins(origin.(string)))
+			}
+		case gate.SettingKeyWSSubprotocols:
+			for _, name := range v.([]any) {
+				opts = append(opts, gate.WSSubprotocols(name.(string)))
+			}
+		case gate.SettingKeyWSSubprotocolCodecs:
+			codecs, err := gate.ParseSubprotocolCodecs(v)
+			if err != nil {
+				panic(fmt.Sprintf("gate setting %s err:%v", k, err))
+			}
+			for name, codec := range codecs {
+				opts = append(opts, gate.SubprotocolCodec(name, codec))
+			}
+		case gate.SettingKeyWSReadBufferSize:
+			opts = append(opts, gate.WSReadBufferSize(int(v.(float64))))
+		case gate.SettingKeyWSWriteBufferSize:
+			opts = append(opts, gate.WSWriteBufferSize(int(v.(float64))))
+		case gate.SettingKeyDuplicateLogin:
+			opts = append(opts, gate.DuplicateLogin(v.(string)))
+		case gate.SettingKeyHeartbeatInterval:
+			opts = append(opts, gate.HeartbeatInterval(time.Duration(v.(float64)*float64(time.Second))))
+		case gate.SettingKeyResumeGrace:
+			opts = append(opts, gate.ResumeGrace(time.Duration(v.(float64)*float64(time.Second))))
+		case gate.SettingKeyResumeBuffer:
+			opts = append(opts, gate.ResumeBuffer(int(v.(float64))))
+		case gate.SettingKeyRateLimit:
+			opts = append(opts, gate.WithRateLimit(parseRateLimit(v)))
+		case gate.SettingKeyTopicRateLimits:
+			for topic, limit := range v.(map[string]any) {
+				opts = append(opts, gate.TopicRateLimit(topic, parseRateLimit(limit)))
+			}
+		case gate.SettingKeyRateLimitAction:
+			opts = append(opts, gate.RateLimitAction(v.(string)))
+		case gate.SettingKeyMaxConnPerIP:
+			opts = append(opts, gate.MaxConnPerIP(int(v.(float64))))
+		case gate.SettingKeyMaxConnNum:
+			opts = append(opts, gate.MaxConnNum(int(v.(float64))))
+		case gate.SettingKeyStickyModules:
+			for _, typ := range v.([]any) {
+				opts = append(opts, gate.StickyModules(typ.(string)))
+			}
+		case gate.SettingKeyAuthSecret:
+			if v.(string) == "" {
+				panic(fmt.Sprintf("gate setting %s must not be empty", k))
+			}
+			opts = append(opts, gate.Authenticator(gate.NewHMACAuthenticator(v.(string))))
+		case gate.SettingKeyAuthModule:
+			authModule = v.(string)
+		case gate.SettingKeyAuthMethod:
+			authMethod = v.(string)
+		case gate.SettingKeyAuthTokenParam:
+			opts = append(opts, gate.AuthTokenParam(v.(string)))
+		case gate.SettingKeyAuthTimeout:
+			opts = append(opts, gate.AuthTimeout(time.Duration(v.(float64)*float64(time.Second))))
+		case gate.SettingKeyPublicTopics:
+			for _, topic := range v.([]any) {
+				opts = append(opts, gate.PublicTopics(topic.(string)))
+			}
+		case gate.SettingKeyRequestTimeout:
+			opts = append(opts, gate.RequestTimeout(time.Duration(v.(float64)*float64(time.Second))))
+		case gate.SettingKeyOrderedDispatch:
+			opts = append(opts, gate.OrderedDispatch(v.(string)))
+		case gate.SettingKeyTopicACL:
+			acl, err := gate.ParseTopicACL(v)
+			if err != nil {
+				panic(fmt.Sprintf("gate setting %s err:%v", k, err))
+			}
+			opts = append(opts, gate.WithTopicACL(acl))
+		case gate.SettingKeySendQueue:
+			q, err := gate.ParseSendQueueOptions(v)
+			if err != nil {
+				panic(fmt.Sprintf("gate setting %s err:%v", k, err))
+			}
+			opts = append(opts, gate.WithSendQueue(q))
+		case gate.SettingKeyWriteTimeout:
+			opts = append(opts, gate.WriteTimeout(time.Duration(v.(float64)*float64(time.Second))))
+		case gate.SettingKeyWriteBatch:
+			opts = append(opts, gate.WriteBatch(int(v.(float64))))
+		}
+	}
+	if authModule != "" {
+		opts = append(opts, gate.Authenticator(gate.NewRPCAuthenticator(authModule, authMethod)))
+	}
+	return opts
+}
+
+// parseRateLimit 解析settings中的限流配置
+func parseRateLimit(v any) gate.RateLimit {
+	limit := gate.RateLimit{}
+	if data, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(data, &limit)
+	}
+	return limit
+}
+
 func (this *GateBase) GetType() string { return "Gate" }
 
 func (this *GateBase) Version() string { return "1.0.0" }
@@ -97,6 +259,11 @@ func (this *GateBase) OnConfChanged(settings *conf.ModuleSettings) {
 func (this *GateBase) Run(closeSig chan bool) {
 	this.StartTimer()
 
+	trustedProxies, err := iptool.NewTrustedProxies(this.opts.TrustedProxies)
+	if err != nil {
+		panic(fmt.Sprintf("gate trusted_proxies err:%v", err))
+	}
+
 	// for wss
 	var wsServer *network.WSServer
 	if this.opts.WsAddr != "" {
@@ -106,8 +273,22 @@ func (this *GateBase) Run(closeSig chan bool) {
 		wsServer.TLS = this.opts.TLS
 		wsServer.CertFile = this.opts.CertFile
 		wsServer.KeyFile = this.opts.KeyFile
+		wsServer.TLSOptions = this.opts.TLSOptions
+		wsServer.ProxyProtocol = this.opts.ProxyProtocol
+		wsServer.TrustedProxies = trustedProxies
 		wsServer.ShakeFunc = this.shakeHandle
+		if this.handshake != nil || this.opts.Authenticator != nil {
+			wsServer.HandshakeFunc = this.wsHandshake
+		}
+		wsServer.AllowedOrigins = this.opts.WSAllowedOrigins
+		wsServer.Subprotocols = this.opts.WSSubprotocols
+		wsServer.ReadBufferSize = this.opts.WSReadBufferSize
+		wsServer.WriteBufferSize = this.opts.WSWriteBufferSize
 		wsServer.MaxMsgLen = uint32(this.opts.MaxPackSize)
+		wsServer.MaxConnPerIP = this.opts.MaxConnPerIP
+		wsServer.MaxConnNum = this.opts.MaxConnNum
+		wsServer.EnableCompression = this.opts.WSCompression
+		wsServer.CompressThreshold = this.opts.CompressThreshold
 		wsServer.NewAgent = func(conn *network.WSConn) network.Client {
 			agent := this.agentCreater("ws")
 			agent.Init(agent, this, conn)
@@ -122,12 +303,60 @@ func (this *GateBase) Run(closeSig chan bool) {
 		tcpServer.TLS = this.opts.TLS
 		tcpServer.CertFile = this.opts.CertFile
 		tcpServer.KeyFile = this.opts.KeyFile
+		tcpServer.TLSOptions = this.opts.TLSOptions
+		tcpServer.ProxyProtocol = this.opts.ProxyProtocol
+		tcpServer.TrustedProxies = trustedProxies
+		tcpServer.MaxConnPerIP = this.opts.MaxConnPerIP
+		tcpServer.MaxConnNum = this.opts.MaxConnNum
 		tcpServer.NewAgent = func(conn *network.TCPConn) network.Client {
 			agent := this.agentCreater("tcp")
 			agent.Init(agent, this, conn)
 			return agent
 		}
 	}
+	// for kcp
+	var kcpServer *network.KCPServer
+	if this.opts.KcpAddr != "" {
+		kcpServer = new(network.KCPServer)
+		kcpServer.Addr = this.opts.KcpAddr
+		kcpServer.MaxConnPerIP = this.opts.MaxConnPerIP
+		kcpServer.MaxConnNum = this.opts.MaxConnNum
+		kcpServer.NewAgent = func(conn *network.KCPConn) network.Client {
+			agent := this.agentCreater("kcp")
+			agent.Init(agent, this, conn)
+			return agent
+		}
+	}
+	// for quic(WebTransport)
+	var quicServer *network.QUICServer
+	if this.opts.QuicAddr != "" {
+		quicServer = new(network.QUICServer)
+		quicServer.Addr = this.opts.QuicAddr
+		quicServer.Path = this.opts.QuicPath
+		quicServer.AllowedOrigins = this.opts.WSAllowedOrigins
+		quicServer.CertFile = this.opts.CertFile
+		quicServer.KeyFile = this.opts.KeyFile
+		quicServer.TLSOptions = this.opts.TLSOptions
+		quicServer.IdleTimeout = this.opts.HeartOverTimer
+		quicServer.MaxConnPerIP = this.opts.MaxConnPerIP
+		quicServer.MaxConnNum = this.opts.MaxConnNum
+		quicServer.NewAgent = func(conn *network.QUICConn) network.Client {
+			agent := this.agentCreater("quic")
+			agent.Init(agent, this, conn)
+			return agent
+		}
+	}
+
+	// for group(跨gate分组消息)
+	groupSub, err := app.App().Transporter().Subscribe(gate.GroupSubject(), this.onGroupMessage)
+	if err != nil {
+		log.Error("gate subscribe %s err:%v", gate.GroupSubject(), err)
+	}
+	// for broadcast(跨gate广播)
+	broadcastSub, err := app.App().Transporter().Subscribe(gate.BroadcastSubject(), this.onBroadcastMessage)
+	if err != nil {
+		log.Error("gate subscribe %s err:%v", gate.BroadcastSubject(), err)
+	}
 
 	if wsServer != nil {
 		wsServer.Start()
@@ -135,7 +364,19 @@ func (this *GateBase) Run(closeSig chan bool) {
 	if tcpServer != nil {
 		tcpServer.Start()
 	}
+	if kcpServer != nil {
+		kcpServer.Start()
+	}
+	if quicServer != nil {
+		quicServer.Start()
+	}
 	<-closeSig
+	if groupSub != nil {
+		groupSub.Unsubscribe()
+	}
+	if broadcastSub != nil {
+		broadcastSub.Unsubscribe()
+	}
 	if this.delegater != nil {
 		this.delegater.OnDestroy()
 	}
@@ -145,6 +386,45 @@ func (this *GateBase) Run(closeSig chan bool) {
 	if tcpServer != nil {
 		tcpServer.Close()
 	}
+	if kcpServer != nil {
+		kcpServer.Close()
+	}
+	if quicServer != nil {
+		quicServer.Close()
+	}
+}
+
+// onGroupMessage 处理跨gate的分组消息(发送给本gate上的分组成员)
+func (this *GateBase) onGroupMessage(m *nats.Msg) {
+	msg := &gate.GroupMessage{}
+	if err := msgpack.Unmarshal(m.Data, msg); err != nil {
+		log.Warning("gate group message unmarshal err:%v", err)
+		return
+	}
+	if _, err := this.delegater.OnRpcGroupSend(context.TODO(), msg.Group, msg.Topic, msg.Body); err != nil {
+		log.Warning("gate group send group:%v topic:%v err:%v", msg.Group, msg.Topic, err)
+	}
+}
+
+// onBroadcastMessage 处理跨gate的广播消息(发送给本gate上满足过滤条件的session,需要时回复发送数量)
+func (this *GateBase) onBroadcastMessage(m *nats.Msg) {
+	msg := &gate.BroadcastMessage{}
+	reply := &gate.BroadcastReply{ServerId: this.GetServerID()}
+	if err := msgpack.Unmarshal(m.Data, msg); err != nil {
+		reply.Error = err.Error()
+	} else if filters, err := gate.ParseSessionFilters(msg.Filters); err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.Delivered = broadcastSessions(this.delegater, msg.Topic, msg.Body, filters)
+	}
+	if reply.Error != "" {
+		log.Warning("gate broadcast topic:%v err:%v", msg.Topic, reply.Error)
+	}
+	if m.Reply != "" {
+		if data, err := msgpack.Marshal(reply); err == nil {
+			m.Respond(data)
+		}
+	}
 }
 
 // --------------- AgentCreater
@@ -159,8 +439,10 @@ func (this *GateBase) defaultClientAgentCreater(netTyp string) gate.IClientAgent
 	switch netTyp {
 	case "ws":
 		return NewWSClientAgent(this.recvPackHandler)
-	case "tcp":
+	case "tcp", "kcp": // kcp连接与tcp一样按字节流读取
 		return NewTCPClientAgent(this.recvPackHandler)
+	case "quic":
+		return NewQUICClientAgent(this.recvPackHandler)
 	}
 	return NewWSClientAgent(this.recvPackHandler) // default use ws
 }
@@ -187,6 +469,50 @@ func (this *GateBase) SetShakeHandler(handler func(r *http.Request) error) error
 // GetShakeHandler 获取建立连接时鉴权器(ws)
 func (this *GateBase) GetShakeHandler() func(r *http.Request) error { return this.shakeHandle }
 
+// SetHandshakeHandler 设置建立连接时的握手钩子(ws): 返回的值在OnConnect之前放入session的Settings,返回error拒绝连接
+func (this *GateBase) SetHandshakeHandler(handler func(r *http.Request) (map[string]string, error)) error {
+	this.handshake = handler
+	return nil
+}
+
+// GetHandshakeHandler 获取建立连接时的握手钩子(ws)
+func (this *GateBase) GetHandshakeHandler() func(r *http.Request) (map[string]string, error) {
+	return this.handshake
+}
+
+// wsHandshake ws握手: 调用握手钩子,开启认证且携带了token时验证token(失败拒绝连接)
+func (this *GateBase) wsHandshake(r *http.Request) (map[string]string, error) {
+	values := map[string]string{}
+	if this.handshake != nil {
+		v, err := this.handshake(r)
+		if err != nil {
+			return nil, err
+		}
+		for k, val := range v {
+			values[k] = val
+		}
+	}
+	auth := this.opts.Authenticator
+	if auth == nil {
+		return values, nil
+	}
+	token := gate.AuthToken(r, this.opts.AuthTokenParam)
+	if token == "" {
+		return values, nil // 连接后通过PACK_TOPIC_AUTH认证
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), this.opts.AuthTimeout)
+	defer cancel()
+	userId, settings, err := auth.Authenticate(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: %v", err)
+	}
+	for k, v := range settings {
+		values[k] = v
+	}
+	values[handshakeUserKey] = userId
+	return values, nil
+}
+
 // --------------- StorageHandler
 
 // SetStorageHandler 设置Session信息持久化接口
@@ -242,30 +568,127 @@ func (this *GateBase) SetRecvPackHandler(handler gate.FunRecvPackHandler) error
 // defaultRecvPackHandler 默认接收数据包处理接口
 func (this *GateBase) defaultRecvPackHandler(session gate.ISession, pack *gate.Pack) error {
 	// 默认是通过topic解析出路由规则
-	topic := strings.FieldsFunc(pack.Topic, func(r rune) bool {
-		return r == '/' || r == '_'
-	})
-	if len(topic) < 2 {
-		return fmt.Errorf("pack.Topic resolving faild with:%v", pack.Topic)
+	moduleTyp, msgId, err := gate.ParseTopic(pack.Topic)
+	if err != nil {
+		return err
+	}
+
+	server, err := this.routeServer(session, moduleTyp)
+	if err != nil {
+		return err
+	}
+	ctx := this.rpcContext(session)
+	if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+		return this.request(ctx, session, server, msgId, pack)
+	}
+	return server.GetRPC().CallNR(ctx, gate.RPC_CLIENT_MSG, msgId, pack.Body)
+}
+
+// rpcContext 转发客户端消息的RPC context(开启有序转发时携带顺序key)
+func (this *GateBase) rpcContext(session gate.ISession) context.Context {
+	ctx := session.GenRPCContext()
+	switch this.opts.OrderedDispatch {
+	case gate.OrderedDispatchSession:
+		return mqrpc.ContextWithOrderKey(ctx, session.GetSessionID())
+	case gate.OrderedDispatchUser:
+		if userId := session.GetUserID(); userId != "" {
+			return mqrpc.ContextWithOrderKey(ctx, "user:"+userId)
+		}
+		return mqrpc.ContextWithOrderKey(ctx, session.GetSessionID())
 	}
+	return ctx
+}
 
-	moduleTyp, msgId := topic[0], topic[1]
+// routeServer 选择处理客户端消息的模块服务
+func (this *GateBase) routeServer(session gate.ISession, moduleTyp string) (app.IModuleServerSession, error) {
+	// 有状态模块按用户粘性路由(自动分配并保存到session)
+	if this.stickyRouter.IsSticky(moduleTyp) {
+		return this.stickyRouter.Route(session, moduleTyp)
+	}
 
 	// 优先在已绑定的Module中提供服务
 	serverId, _ := session.Get(moduleTyp)
 	if serverId != "" {
-		return app.App().CallNR(session.GenRPCContext(), serverId, gate.RPC_CLIENT_MSG, msgId, pack.Body)
+		return app.App().GetRouteServer(serverId)
 	}
 
 	// 然后按照默认路由规则随机取得Module服务
 	server, err := app.App().GetRouteServer(moduleTyp)
 	if err != nil {
-		return fmt.Errorf("Service(moduleType:%s) not found", moduleTyp)
+		return nil, fmt.Errorf("Service(moduleType:%s) not found", moduleTyp)
+	}
+	return server, nil
+}
+
+// request 请求模式: 通过Call转发并把模块的返回值作为响应包下发(失败时返回error,由agent下发错误响应)
+func (this *GateBase) request(ctx context.Context, session gate.ISession, server app.IModuleServerSession, msgId string, pack *gate.Pack) error {
+	timeout := this.opts.RequestTimeout
+	if timeout <= 0 {
+		timeout = app.App().Options().RPCExpired
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := server.GetRPC().Call(ctx, gate.RPC_CLIENT_MSG, msgId, pack.Body)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return gate.ErrRequestTimeout
+		}
+		return err
+	}
+	body, err := responseBody(result)
+	if err != nil {
+		return err
+	}
+	agent, err := this.delegater.GetAgent(session.GetSessionID())
+	if err != nil {
+		return nil // 连接已断开
+	}
+	return agent.SendPack(gate.NewResponsePack(pack, body))
+}
+
+// responseBody 模块返回值转为响应包的body([]byte/string原样,其他类型编码为json)
+func responseBody(result any) ([]byte, error) {
+	switch r := result.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return r, nil
+	case string:
+		return []byte(r), nil
 	}
+	return json.Marshal(result)
+}
+
+// --------------- StickyRouter
+
+// SetStickyHandoff 设置粘性路由节点迁移时的状态交接回调
+func (this *GateBase) SetStickyHandoff(handoff gate.FunStickyHandoff) error {
+	this.stickyRouter.SetHandoff(handoff)
+	return nil
+}
 
-	return server.GetRPC().CallNR(session.GenRPCContext(), gate.RPC_CLIENT_MSG, msgId, pack.Body)
+// GetStickyRouter 获取有状态模块的用户粘性路由
+func (this *GateBase) GetStickyRouter() *StickyRouter { return this.stickyRouter }
+
+// --------------- SessionResumer
+
+// getResumer 获取断线重连管理(未开启时为nil)
+func (this *GateBase) getResumer() *sessionResumer { return this.resumer }
+
+// --------------- Stats
+
+// Stats 网关运行统计
+func (this *GateBase) Stats() gate.Stats {
+	st := this.stats.snapshot()
+	if this.delegater != nil {
+		st.Agents = this.delegater.GetAgentNum()
+	}
+	return st
 }
 
+// getStats 运行统计计数
+func (this *GateBase) getStats() *gateStats { return &this.stats }
+
 // --------------- FunSendMessageHook
 
 // SetsendMessageHook 设置发送消息时的钩子回调
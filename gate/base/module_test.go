@@ -0,0 +1,42 @@
+package gatebase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingOptionsOverride(t *testing.T) {
+	code := []gate.Option{
+		gate.WsAddr(":3653"),
+		gate.TCPAddr(":3563"),
+		gate.HeartbeatInterval(5 * time.Second),
+		gate.StickyModules("game"),
+	}
+	settings := map[string]any{
+		gate.SettingKeyWSAddr:            ":8080",
+		gate.SettingKeyHeartbeatInterval: float64(10),
+		gate.SettingKeyStickyModules:     []any{"room"},
+		"unknown":                        "ignored",
+	}
+	opts := gate.NewOptions(append(code, settingOptions(settings)...)...)
+	// settings中的配置覆盖代码中的配置,settings中没有的保留代码中的配置
+	assert.Equal(t, ":8080", opts.WsAddr)
+	assert.Equal(t, ":3563", opts.TcpAddr)
+	assert.Equal(t, 10*time.Second, opts.HeartbeatInterval)
+	// 列表类的配置追加到代码中的配置之后
+	assert.Equal(t, []string{"game", "room"}, opts.StickyModules)
+}
+
+func TestSettingOptionsInvalid(t *testing.T) {
+	cases := []map[string]any{
+		{gate.SettingKeyAuthSecret: ""},
+		{gate.SettingKeyTopicACL: "x"},
+		{gate.SettingKeyWSSubprotocolCodecs: map[string]any{"river": "protobuf"}},
+	}
+	for _, settings := range cases {
+		assert.Panics(t, func() { settingOptions(settings) }, "%v", settings)
+	}
+}
@@ -0,0 +1,125 @@
+package gatebase
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedDispatch(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+	gt := &GateBase{opts: gate.NewOptions(gate.OrderedDispatch(gate.OrderedDispatchSession))}
+	a := newTestAgent(gt, func(session gate.ISession, pack *gate.Pack) error {
+		if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+			<-release // 模块未返回
+		}
+		handled <- pack.Topic
+		return nil
+	})
+
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/ask", Flags: gate.PACK_FLAG_REQUEST, ReqId: 1}))
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/say"}))
+	// 等待模块返回时接收协程不阻塞,心跳照常回复
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: gate.PACK_TOPIC_PING}))
+	pack, control, ok := a.sendPackBuff.pop(false)
+	assert.True(t, ok && control)
+	assert.Equal(t, gate.PACK_TOPIC_PONG, pack.Topic)
+	select {
+	case topic := <-handled:
+		t.Fatalf("%s forwarded before the request returned", topic)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	assert.Equal(t, "chat/ask", <-handled)
+	assert.Equal(t, "chat/say", <-handled)
+	assert.NoError(t, a.OnClose())
+}
+
+func TestOrderedDispatchQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	gt := &GateBase{opts: gate.NewOptions(gate.OrderedDispatch(gate.OrderedDispatchSession), gate.ConcurrentTasks(orderedQueueSize+10))}
+	a := newTestAgent(gt, func(session gate.ISession, pack *gate.Pack) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+	for i := 0; i <= orderedQueueSize; i++ {
+		assert.NoError(t, a.handlePack(&gate.Pack{Topic: fmt.Sprintf("chat/%d", i), Flags: gate.PACK_FLAG_REQUEST, ReqId: uint32(i + 1)}))
+		if i == 0 {
+			<-started // 第一个包在转发协程中执行,不占队列
+		}
+	}
+	assert.Len(t, a.ordered, orderedQueueSize)
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/x", Flags: gate.PACK_FLAG_REQUEST, ReqId: 1000}))
+	pack, control, ok := a.sendPackBuff.pop(false)
+	assert.True(t, ok && control)
+	assert.Equal(t, gate.PACK_TOPIC_ERROR, pack.Topic)
+	assert.Equal(t, uint32(1000), pack.ReqId)
+	assert.Len(t, a.ch, orderedQueueSize+1) // 被拒绝的请求释放了名额
+	close(release)
+	assert.NoError(t, a.OnClose())
+}
+
+// newTestTCPConn 通过本地TCP连接向agent发送数据,返回客户端连接
+func newTestTCPConn(t *testing.T, a *TCPClientAgent) net.Conn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	server, err := ln.Accept()
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	a.r = bufio.NewReader(server)
+	return client
+}
+
+// writeTestPack 按agent的编解码写入一个包
+func writeTestPack(t *testing.T, a *TCPClientAgent, conn net.Conn, pack *gate.Pack) {
+	body, err := a.codec.Marshal(pack)
+	assert.NoError(t, err)
+	head, err := a.codec.WriteHead(len(body))
+	assert.NoError(t, err)
+	_, err = conn.Write(append(head, body...))
+	assert.NoError(t, err)
+}
+
+// recvTestPacks 读取并处理n个包
+func recvTestPacks(t *testing.T, a *TCPClientAgent, n int) {
+	for i := 0; i < n; i++ {
+		pack, err := a.OnReadDecodingPack()
+		assert.NoError(t, err)
+		assert.NoError(t, a.handlePack(pack))
+	}
+}
+
+func TestOrderedDispatchTCPBody(t *testing.T) {
+	release := make(chan struct{})
+	bodies := make(chan string, 10)
+	gt := &GateBase{opts: gate.NewOptions(gate.OrderedDispatch(gate.OrderedDispatchSession))}
+	a := newTestAgent(gt, func(session gate.ISession, pack *gate.Pack) error {
+		<-release // 两个包都读取后才转发
+		bodies <- string(pack.Body)
+		return nil
+	})
+	conn := newTestTCPConn(t, a)
+	writeTestPack(t, a, conn, &gate.Pack{Topic: "chat/say", Body: []byte("first-pack")})
+	writeTestPack(t, a, conn, &gate.Pack{Topic: "chat/say", Body: []byte("second-pk!")})
+	recvTestPacks(t, a, 2)
+
+	close(release)
+	assert.Equal(t, "first-pack", <-bodies)
+	assert.Equal(t, "second-pk!", <-bodies)
+	assert.NoError(t, a.OnClose())
+}
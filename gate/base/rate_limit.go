@@ -0,0 +1,112 @@
+package gatebase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/tools"
+)
+
+// newPackLimiter 创建单个连接的接收限流(未配置限流时返回nil)
+func newPackLimiter(opts gate.Options) *packLimiter {
+	if !opts.RateLimit.Enabled() && len(opts.TopicRateLimits) == 0 {
+		return nil
+	}
+	l := &packLimiter{
+		action: opts.RateLimitAction,
+		global: newRateBuckets(opts.RateLimit),
+		topics: map[string]*rateBuckets{},
+	}
+	for topic, limit := range opts.TopicRateLimits {
+		l.topics[topic] = newRateBuckets(limit)
+	}
+	return l
+}
+
+// packLimiter 单个连接的接收限流(只在该连接的接收协程中使用)
+type packLimiter struct {
+	action string
+	global *rateBuckets
+	topics map[string]*rateBuckets // topic或模块类型 -> 限流
+}
+
+// Check 检查数据包是否超出限流(drop返回false; delay等待后返回true; disconnect返回error)
+func (l *packLimiter) Check(pack *gate.Pack) (bool, error) {
+	buckets, ok := l.topics[pack.Topic]
+	if !ok {
+		if i := strings.IndexAny(pack.Topic, "/_"); i > 0 {
+			buckets, ok = l.topics[pack.Topic[:i]]
+		}
+	}
+	if !ok {
+		buckets = l.global
+	}
+	if buckets == nil {
+		return true, nil
+	}
+	size := float64(len(pack.Body))
+	switch l.action {
+	case gate.RateLimitDelay:
+		if wait := buckets.reserve(size); wait > 0 {
+			time.Sleep(wait)
+		}
+		return true, nil
+	case gate.RateLimitDisconnect:
+		if !buckets.allow(size) {
+			return false, fmt.Errorf("topic:%s rate limit exceeded", pack.Topic)
+		}
+		return true, nil
+	}
+	return buckets.allow(size), nil
+}
+
+func newRateBuckets(limit gate.RateLimit) *rateBuckets {
+	if !limit.Enabled() {
+		return nil
+	}
+	b := &rateBuckets{}
+	if limit.PackRate > 0 {
+		b.packs = tools.NewTokenBucket(limit.PackRate, limit.PackBurst)
+	}
+	if limit.ByteRate > 0 {
+		b.bytes = tools.NewTokenBucket(limit.ByteRate, limit.ByteBurst)
+	}
+	return b
+}
+
+// rateBuckets 包数和字节数令牌桶
+type rateBuckets struct {
+	packs *tools.TokenBucket
+	bytes *tools.TokenBucket
+}
+
+// allow 令牌足够时消耗一个包和size字节的令牌(任一不足时都不消耗)
+// 超过字节桶容量的包按桶容量计算(桶满时可以通过)
+func (b *rateBuckets) allow(size float64) bool {
+	if b.packs != nil && !b.packs.Allow(1) {
+		return false
+	}
+	if b.bytes != nil && !b.bytes.Allow(min(size, b.bytes.Burst())) {
+		if b.packs != nil {
+			b.packs.Refund(1)
+		}
+		return false
+	}
+	return true
+}
+
+// reserve 消耗一个包和size字节的令牌(可透支), 返回需要等待的时间
+func (b *rateBuckets) reserve(size float64) time.Duration {
+	var wait time.Duration
+	if b.packs != nil {
+		wait = b.packs.Reserve(1)
+	}
+	if b.bytes != nil {
+		if w := b.bytes.Reserve(size); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
@@ -0,0 +1,115 @@
+package gatebase
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAgent 未启动收发协程的连接
+func newTestAgent(gt *GateBase, h gate.FunRecvPackHandler) *TCPClientAgent {
+	a := NewTCPClientAgent(h).(*TCPClientAgent)
+	a.impl, a.gate, a.codec = a, gt, gt.opts.Codec
+	a.ch = make(chan int, gt.opts.ConcurrentTasks)
+	a.sendPackBuff = newSendQueue(gt.opts, nil)
+	a.limiter = newPackLimiter(gt.opts)
+	a.session, _ = NewSessionByMap(map[string]any{"SessionId": "s1"})
+	return a
+}
+
+func TestRateBucketsAllow(t *testing.T) {
+	b := newRateBuckets(gate.RateLimit{PackRate: 1, PackBurst: 2, ByteRate: 1, ByteBurst: 10})
+	assert.True(t, b.allow(8))
+	assert.False(t, b.allow(8)) // 字节不足,不消耗包令牌
+	assert.True(t, b.allow(2))
+	assert.False(t, b.allow(0)) // 包令牌已用完
+
+	// 超过字节桶容量的包在桶满时可以通过
+	b = newRateBuckets(gate.RateLimit{ByteRate: 1, ByteBurst: 10})
+	assert.True(t, b.allow(100))
+	assert.False(t, b.allow(1))
+	assert.False(t, b.allow(100))
+}
+
+func TestPackLimiterCheck(t *testing.T) {
+	opts := gate.NewOptions(
+		gate.WithRateLimit(gate.RateLimit{PackRate: 1, PackBurst: 1}),
+		gate.TopicRateLimit("chat", gate.RateLimit{PackRate: 1, PackBurst: 2}),
+		gate.TopicRateLimit("chat/say", gate.RateLimit{PackRate: 1, PackBurst: 3}),
+	)
+	l := newPackLimiter(opts)
+	count := func(topic string) int {
+		n := 0
+		for i := 0; i < 5; i++ {
+			if ok, _ := l.Check(&gate.Pack{Topic: topic}); ok {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 3, count("chat/say"))
+	assert.Equal(t, 2, count("chat_join")) // 按模块类型
+	assert.Equal(t, 1, count("room/join"))
+
+	opts.RateLimitAction = gate.RateLimitDisconnect
+	l = newPackLimiter(opts)
+	ok, err := l.Check(&gate.Pack{Topic: "room/join"})
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	_, err = l.Check(&gate.Pack{Topic: "room/join"})
+	assert.Error(t, err)
+
+	opts = gate.NewOptions(gate.WithRateLimit(gate.RateLimit{PackRate: 20, PackBurst: 1}), gate.RateLimitAction(gate.RateLimitDelay))
+	l = newPackLimiter(opts)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		ok, err := l.Check(&gate.Pack{Topic: "room/join"})
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+
+	assert.Nil(t, newPackLimiter(gate.NewOptions()))
+}
+
+func TestConcurrentTasks(t *testing.T) {
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+	gt := &GateBase{opts: gate.NewOptions(gate.ConcurrentTasks(1))}
+	a := newTestAgent(gt, func(session gate.ISession, pack *gate.Pack) error {
+		handled <- pack.Topic
+		if pack.Flags&gate.PACK_FLAG_REQUEST != 0 {
+			<-release // 模块未返回
+		}
+		return nil
+	})
+	request := func(reqId uint32) *gate.Pack {
+		return &gate.Pack{Topic: "chat/ask", Flags: gate.PACK_FLAG_REQUEST, ReqId: reqId}
+	}
+
+	assert.NoError(t, a.handlePack(request(1)))
+	assert.Equal(t, "chat/ask", <-handled)
+	// 普通包不占用处理中的名额
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/say"}))
+	assert.Equal(t, "chat/say", <-handled)
+
+	// 第一个请求未返回时第二个请求被拒绝
+	assert.NoError(t, a.handlePack(request(2)))
+	pack, control, ok := a.sendPackBuff.pop(false)
+	assert.True(t, ok && control)
+	assert.Equal(t, gate.PACK_TOPIC_ERROR, pack.Topic)
+	assert.Equal(t, uint32(2), pack.ReqId)
+	e := gate.PackError{}
+	assert.NoError(t, json.Unmarshal(pack.Body, &e))
+	assert.Equal(t, gate.PACK_ERR_FAILED, e.Code)
+
+	// 返回后释放名额
+	release <- struct{}{}
+	assert.Eventually(t, func() bool { return len(a.ch) == 0 }, time.Second, time.Millisecond)
+	assert.NoError(t, a.handlePack(request(3)))
+	assert.Equal(t, "chat/ask", <-handled)
+	close(release)
+}
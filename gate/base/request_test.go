@@ -0,0 +1,138 @@
+package gatebase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/app"
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/log"
+	"github.com/cloudapex/river/mqrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestTestRPC 模块的RPC客户端(只实现Call)
+type requestTestRPC struct {
+	mqrpc.IRPCClient
+	call func(ctx context.Context, body []byte) (any, error)
+}
+
+func (r *requestTestRPC) Call(ctx context.Context, _func string, params ...any) (any, error) {
+	return r.call(ctx, params[1].([]byte))
+}
+
+type requestTestServer struct {
+	app.IModuleServerSession
+	rpc *requestTestRPC
+}
+
+func (s *requestTestServer) GetRPC() mqrpc.IRPCClient { return s.rpc }
+
+// newTestRequestAgent 请求通过GateBase.request转发给call
+func newTestRequestAgent(t *testing.T, opts []gate.Option, call func(ctx context.Context, body []byte) (any, error)) *TCPClientAgent {
+	log.LogBeego() // 默认日志的延迟创建不是并发安全的,先在测试协程中创建
+	opts = append([]gate.Option{gate.RequestTimeout(time.Second)}, opts...)
+	d, agents := newTestDelegate(t, opts, nil, "req-1")
+	gt := d.gate.(*GateBase)
+	server := &requestTestServer{rpc: &requestTestRPC{call: call}}
+	a := agents["req-1"]
+	a.recvHandler = func(session gate.ISession, pack *gate.Pack) error {
+		return gt.request(context.TODO(), session, server, "ask", pack)
+	}
+	return a
+}
+
+// popResponse 等待下发的响应包
+func popResponse(t *testing.T, a *TCPClientAgent) *gate.Pack {
+	got := make(chan *gate.Pack, 1)
+	go func() {
+		pack, _, _ := a.sendPackBuff.pop(true)
+		got <- pack
+	}()
+	select {
+	case pack := <-got:
+		return pack
+	case <-time.After(time.Second):
+		t.Fatal("no response")
+		return nil
+	}
+}
+
+func responseError(t *testing.T, pack *gate.Pack) gate.PackError {
+	assert.Equal(t, gate.PACK_TOPIC_ERROR, pack.Topic)
+	e := gate.PackError{}
+	assert.NoError(t, json.Unmarshal(pack.Body, &e))
+	return e
+}
+
+func TestRequestResponse(t *testing.T) {
+	release := make(chan struct{})
+	a := newTestRequestAgent(t, nil, func(ctx context.Context, body []byte) (any, error) {
+		<-release // 两个请求都读取后模块才返回
+		return "echo:" + string(body), nil
+	})
+	conn := newTestTCPConn(t, a)
+	writeTestPack(t, a, conn, &gate.Pack{Topic: "chat/ask", Body: []byte("first-pack"), Flags: gate.PACK_FLAG_REQUEST, ReqId: 1})
+	writeTestPack(t, a, conn, &gate.Pack{Topic: "chat/ask", Body: []byte("second-pk!"), Flags: gate.PACK_FLAG_REQUEST, ReqId: 2})
+	recvTestPacks(t, a, 2)
+	close(release)
+
+	got := map[uint32]string{}
+	for i := 0; i < 2; i++ {
+		pack := popResponse(t, a)
+		assert.Equal(t, "chat/ask", pack.Topic)
+		assert.NotZero(t, pack.Flags&gate.PACK_FLAG_REQUEST)
+		got[pack.ReqId] = string(pack.Body)
+	}
+	assert.Equal(t, map[uint32]string{1: "echo:first-pack", 2: "echo:second-pk!"}, got)
+	assert.Eventually(t, func() bool { return len(a.ch) == 0 }, time.Second, time.Millisecond)
+}
+
+func TestRequestModuleError(t *testing.T) {
+	a := newTestRequestAgent(t, nil, func(ctx context.Context, body []byte) (any, error) {
+		return nil, errors.New("no such room")
+	})
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/ask", Flags: gate.PACK_FLAG_REQUEST, ReqId: 7}))
+	pack := popResponse(t, a)
+	assert.Equal(t, uint32(7), pack.ReqId)
+	e := responseError(t, pack)
+	assert.Equal(t, gate.PACK_ERR_FAILED, e.Code)
+	assert.Equal(t, "chat/ask", e.Topic)
+	assert.Contains(t, e.Msg, "no such room")
+	assert.False(t, a.IsClosed())
+}
+
+func TestRequestTimeout(t *testing.T) {
+	a := newTestRequestAgent(t, []gate.Option{gate.RequestTimeout(20 * time.Millisecond)}, func(ctx context.Context, body []byte) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/ask", Flags: gate.PACK_FLAG_REQUEST, ReqId: 8}))
+	pack := popResponse(t, a)
+	assert.Equal(t, uint32(8), pack.ReqId)
+	assert.Equal(t, gate.PACK_ERR_TIMEOUT, responseError(t, pack).Code)
+}
+
+func TestRequestInflightLimit(t *testing.T) {
+	release := make(chan struct{})
+	a := newTestRequestAgent(t, []gate.Option{gate.ConcurrentTasks(1)}, func(ctx context.Context, body []byte) (any, error) {
+		<-release
+		return nil, nil
+	})
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/ask", Flags: gate.PACK_FLAG_REQUEST, ReqId: 1}))
+	assert.NoError(t, a.handlePack(&gate.Pack{Topic: "chat/ask", Flags: gate.PACK_FLAG_REQUEST, ReqId: 2}))
+	pack := popResponse(t, a)
+	assert.Equal(t, uint32(2), pack.ReqId)
+	e := responseError(t, pack)
+	assert.Equal(t, gate.PACK_ERR_FAILED, e.Code)
+	assert.Equal(t, "too many inflight requests", e.Msg)
+
+	// 第一个请求返回后释放名额
+	close(release)
+	pack = popResponse(t, a)
+	assert.Equal(t, uint32(1), pack.ReqId)
+	assert.Eventually(t, func() bool { return len(a.ch) == 0 }, time.Second, time.Millisecond)
+}
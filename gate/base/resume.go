@@ -0,0 +1,133 @@
+package gatebase
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/log"
+)
+
+// newSessionResumer 创建断线重连管理(未开启ResumeGrace时返回nil)
+func newSessionResumer(delegate *Delegate, opts gate.Options) *sessionResumer {
+	if opts.ResumeGrace <= 0 {
+		return nil
+	}
+	return &sessionResumer{
+		delegate: delegate,
+		grace:    opts.ResumeGrace,
+		agents:   map[string]*agentBase{},
+	}
+}
+
+// sessionResumer 断线重连管理: 连接断开后保留session和发送缓存grace时间,
+// 客户端用token重连时新连接接管原session(sessionId不变,不触发DisConnect/Connect),并补发缺失的消息
+type sessionResumer struct {
+	delegate *Delegate
+	grace    time.Duration
+	lock     sync.Mutex
+	agents   map[string]*agentBase // token -> agent(在线或断线等待重连中)
+}
+
+// register 为连接分配新的重连token并下发给客户端
+func (r *sessionResumer) register(a *agentBase) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Warning("gate resume token generate err:%v", err)
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	r.lock.Lock()
+	a.token = token
+	r.agents[token] = a
+	r.lock.Unlock()
+
+	a.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_RESUME_TOKEN, Body: []byte(token)})
+}
+
+// park 连接断开时保留session等待重连(返回false表示不能重连,需按断开处理)
+func (r *sessionResumer) park(a *agentBase) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if a.getSuccessor() != nil { // 已被新连接接管
+		return true
+	}
+	if a.token == "" || atomic.LoadInt32(&a.noResume) == 1 {
+		delete(r.agents, a.token)
+		return false
+	}
+	a.parkTimer = time.AfterFunc(r.grace, func() { r.expire(a) })
+	log.Info("gate park agent sessionId:%s, wait resume %v", a.session.GetSessionID(), r.grace)
+	return true
+}
+
+// drop 服务端主动关闭的连接不再等待重连(已断线等待中的立即按断开处理)
+func (r *sessionResumer) drop(a *agentBase) {
+	r.lock.Lock()
+	timer := a.parkTimer
+	r.lock.Unlock()
+	if timer != nil && timer.Stop() {
+		r.expire(a)
+	}
+}
+
+// expire 等待重连超时,按断开处理
+func (r *sessionResumer) expire(a *agentBase) {
+	r.lock.Lock()
+	if r.agents[a.token] != a || a.getSuccessor() != nil {
+		r.lock.Unlock()
+		return
+	}
+	delete(r.agents, a.token)
+	r.lock.Unlock()
+	a.sendPackBuff.clear()
+
+	log.Info("gate resume expired sessionId:%s", a.session.GetSessionID())
+	a.gate.GetAgentLearner().DisConnect(a.impl)
+}
+
+// resume 新连接a用token接管原连接的session(body为"token:已收到的最大序号")
+func (r *sessionResumer) resume(a *agentBase, body []byte) error {
+	token, ackStr, found := strings.Cut(string(body), ":")
+	if !found {
+		return fmt.Errorf("invalid resume body")
+	}
+	ack, err := strconv.ParseUint(ackStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid resume seq:%v", err)
+	}
+
+	r.lock.Lock()
+	old, ok := r.agents[token]
+	if !ok || atomic.LoadInt32(&old.noResume) == 1 {
+		r.lock.Unlock()
+		return fmt.Errorf("resume token not found")
+	}
+	missed, err := old.handover(a, ack)
+	if err != nil {
+		r.lock.Unlock()
+		return err
+	}
+	delete(r.agents, token)
+	if old.parkTimer != nil {
+		old.parkTimer.Stop()
+	}
+	r.lock.Unlock()
+
+	// 新连接接管原session
+	r.delegate.sessions.Store(a.session.GetSessionID(), a.impl)
+	if !old.IsClosed() { // 服务端还未感知到旧连接断开
+		old.Close()
+	}
+
+	r.register(a)
+	log.Info("gate resume agent sessionId:%s, replay %d packs", a.session.GetSessionID(), missed)
+	return nil
+}
@@ -0,0 +1,138 @@
+package gatebase
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResumeGate(opts ...gate.Option) *GateBase {
+	codec := gate.NewBinaryPackCodec()
+	for i := 1; i <= 20; i++ {
+		codec.RegisterMsgID(uint32(i), fmt.Sprintf("chat/%d", i))
+	}
+	opts = append([]gate.Option{gate.ResumeGrace(time.Minute), gate.PackCodec(codec)}, opts...)
+	return &GateBase{opts: gate.NewOptions(opts...)}
+}
+
+// newTestResumeAgent 开启断线重连的连接(不启动收发协程)
+func newTestResumeAgent(gt *GateBase) *TCPClientAgent {
+	a := newTestAgent(gt, nil)
+	a.resumable = true
+	return a
+}
+
+// sendAll 模拟发送协程: 取出并编码队列中所有的包,返回客户端收到的包
+func sendAll(t *testing.T, a *agentBase) []*gate.Pack {
+	var packs []*gate.Pack
+	for {
+		pack, control, ok := a.sendPackBuff.pop(false)
+		if !ok {
+			return packs
+		}
+		data, next := a.encode(pack, control)
+		assert.Nil(t, next)
+		p, err := a.codec.Unmarshal(data[a.codec.HeadLen():])
+		assert.NoError(t, err)
+		packs = append(packs, p)
+	}
+}
+
+func enqueueTopics(t *testing.T, a *agentBase, from, to int) {
+	for i := from; i <= to; i++ {
+		assert.NoError(t, a.enqueue(&gate.Pack{Topic: fmt.Sprintf("chat/%d", i)}))
+	}
+}
+
+func TestResumeReplayOrder(t *testing.T) {
+	gt := newTestResumeGate()
+	old := newTestResumeAgent(gt)
+	enqueueTopics(t, &old.agentBase, 1, 3)
+	old.sendControl(&gate.Pack{Topic: gate.PACK_TOPIC_PONG})
+	enqueueTopics(t, &old.agentBase, 4, 5)
+	var seqs []uint64
+	for _, p := range sendAll(t, &old.agentBase) {
+		seqs = append(seqs, p.Seq)
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4, 5}, seqs) // 控制包先发送,不计入序号
+
+	// 6、7未发送时断开,等待重连期间继续缓存8
+	enqueueTopics(t, &old.agentBase, 6, 7)
+	old.sendPackBuff.stop()
+	enqueueTopics(t, &old.agentBase, 8, 8)
+
+	// 客户端已收到3: 补发4、5,然后是未发送的6、7、8,最后是接管后的新消息
+	next := newTestResumeAgent(gt)
+	missed, err := old.handover(&next.agentBase, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, missed)
+	enqueueTopics(t, &old.agentBase, 9, 9) // 发往旧连接的消息转给新连接
+	enqueueTopics(t, &next.agentBase, 10, 10)
+
+	var got []string
+	for _, p := range sendAll(t, &next.agentBase) {
+		got = append(got, fmt.Sprintf("%s#%d", p.Topic, p.Seq))
+	}
+	assert.Equal(t, []string{"chat/4#4", "chat/5#5", "chat/6#6", "chat/7#7", "chat/8#8", "chat/9#9", "chat/10#10"}, got)
+}
+
+func TestResumeAck(t *testing.T) {
+	gt := newTestResumeGate()
+	old := newTestResumeAgent(gt)
+	enqueueTopics(t, &old.agentBase, 1, 3)
+	sendAll(t, &old.agentBase)
+
+	next := newTestResumeAgent(gt)
+	_, err := old.handover(&next.agentBase, 4)
+	assert.Error(t, err) // 超过已发送的序号
+
+	missed, err := old.handover(&next.agentBase, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, missed)
+	assert.Empty(t, sendAll(t, &next.agentBase))
+
+	_, err = old.handover(&newTestResumeAgent(gt).agentBase, 3)
+	assert.Error(t, err) // 已被接管
+}
+
+func TestResumeTooOld(t *testing.T) {
+	gt := newTestResumeGate(gate.ResumeBuffer(2))
+	old := newTestResumeAgent(gt)
+	enqueueTopics(t, &old.agentBase, 1, 5)
+	sendAll(t, &old.agentBase)
+
+	_, err := old.handover(&newTestResumeAgent(gt).agentBase, 2)
+	assert.Error(t, err) // 3已不在缓存中
+
+	next := newTestResumeAgent(gt)
+	missed, err := old.handover(&next.agentBase, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, missed)
+	assert.Len(t, sendAll(t, &next.agentBase), 2)
+}
+
+func TestResumeEncodeFailed(t *testing.T) {
+	gt := newTestResumeGate()
+	a := newTestResumeAgent(gt)
+	enqueueTopics(t, &a.agentBase, 1, 1)
+	assert.NoError(t, a.enqueue(&gate.Pack{Topic: "chat/unknown"})) // 未注册msgId,编码失败
+	enqueueTopics(t, &a.agentBase, 2, 2)
+
+	var seqs []uint64
+	for {
+		pack, control, ok := a.sendPackBuff.pop(false)
+		if !ok {
+			break
+		}
+		if data, _ := a.encode(pack, control); len(data) > 0 {
+			p, err := a.codec.Unmarshal(data[a.codec.HeadLen():])
+			assert.NoError(t, err)
+			seqs = append(seqs, p.Seq)
+		}
+	}
+	assert.Equal(t, []uint64{1, 2}, seqs) // 编码失败的包不占用序号
+	assert.Len(t, a.replay, 2)
+}
@@ -0,0 +1,222 @@
+package gatebase
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cloudapex/river/gate"
+)
+
+// 发送队列的优先级(下标越小越先发送)
+var sendPriorities = [sendLanes]string{gate.SendPriorityHigh, gate.SendPriorityNormal, gate.SendPriorityLow}
+
+const (
+	sendLanes      = 3
+	sendLaneHigh   = 0
+	sendLaneNormal = 1
+)
+
+var (
+	errSendQueueFull = errors.New("too many unsent messages")
+	errSlowConsumer  = errors.New("send queue full, disconnect slow client")
+)
+
+// sendLaneIndex 优先级对应的队列下标
+func sendLaneIndex(priority string) int {
+	for i, p := range sendPriorities {
+		if p == priority {
+			return i
+		}
+	}
+	return sendLaneNormal
+}
+
+// sendQueue 连接的发送队列: 每个优先级一个队列,取出时高优先级优先;
+// 控制包(心跳回复、握手、重连补发等)单独一个不限长度的队列,先于所有优先级发送
+type sendQueue struct {
+	lock    sync.Mutex
+	control []*gate.Pack
+	lanes   [sendLanes][]*gate.Pack
+	conf    [sendLanes]gate.SendLane
+	notify  chan struct{} // 有新消息或关闭时通知发送协程
+	closed  bool
+	stopped bool       // 连接已断开: 不再取出,lane队列仍可放入(等待重连时缓存)
+	stats   *gateStats // 可为nil
+}
+
+func newSendQueue(opts gate.Options, stats *gateStats) *sendQueue {
+	q := &sendQueue{notify: make(chan struct{}, 1), stats: stats}
+	for i, p := range sendPriorities {
+		q.conf[i] = opts.SendQueue.Lane(p, max(opts.SendPackBuffSize, 1))
+	}
+	return q
+}
+
+// push 放入lane队列,队列满时按policy处理(policy为空时不限制队列长度)
+func (q *sendQueue) push(pack *gate.Pack, lane int, policy string) error {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	packs := q.lanes[lane]
+	if policy == gate.SendPolicyCoalesce {
+		for i := range packs {
+			if packs[i].Topic == pack.Topic {
+				packs[i] = pack
+				q.lock.Unlock()
+				q.dropped(lane)
+				return nil
+			}
+		}
+	}
+	if policy != "" && len(packs) >= q.conf[lane].Size {
+		switch policy {
+		case gate.SendPolicyDropOldest, gate.SendPolicyCoalesce:
+			packs[0] = nil
+			packs = packs[1:]
+			q.dropped(lane)
+		case gate.SendPolicyDisconnect:
+			q.lock.Unlock()
+			return errSlowConsumer
+		default:
+			q.lock.Unlock()
+			q.dropped(lane)
+			return errSendQueueFull
+		}
+	} else if q.stats != nil {
+		q.stats.addSendQueued(lane, 1)
+	}
+	q.lanes[lane] = append(packs, pack)
+	depth := q.depth()
+	q.lock.Unlock()
+
+	if q.stats != nil {
+		q.stats.updateSendQueuePeak(int64(depth))
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pushControl 放入控制包队列(不限长度,连接断开后丢弃)
+func (q *sendQueue) pushControl(pack *gate.Pack) {
+	q.lock.Lock()
+	if q.closed || q.stopped {
+		q.lock.Unlock()
+		return
+	}
+	q.control = append(q.control, pack)
+	q.lock.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop 取出一个待发送的包: 控制包优先,然后按优先级(control表示是否为控制包;
+// wait时等待新消息,关闭且已取完或已停止时ok为false)
+func (q *sendQueue) pop(wait bool) (pack *gate.Pack, control bool, ok bool) {
+	for {
+		q.lock.Lock()
+		if q.stopped {
+			q.lock.Unlock()
+			return nil, false, false
+		}
+		if len(q.control) > 0 {
+			pack = q.control[0]
+			q.control[0] = nil
+			q.control = q.control[1:]
+			q.lock.Unlock()
+			return pack, true, true
+		}
+		for i, packs := range q.lanes {
+			if len(packs) == 0 {
+				continue
+			}
+			pack = packs[0]
+			packs[0] = nil
+			q.lanes[i] = packs[1:]
+			q.lock.Unlock()
+			if q.stats != nil {
+				q.stats.addSendQueued(i, -1)
+			}
+			return pack, false, true
+		}
+		closed := q.closed
+		q.lock.Unlock()
+		if closed || !wait {
+			return nil, false, false
+		}
+		<-q.notify
+	}
+}
+
+// close 关闭队列(已在队列中的包仍可取出)
+func (q *sendQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// stop 连接断开时停止取出(lane队列中的包保留,等待重连的新连接接管)
+func (q *sendQueue) stop() {
+	q.lock.Lock()
+	q.stopped = true
+	q.control = nil
+	q.lock.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain 取出lane队列中所有未发送的包(移交给重连的新连接),之后放入的包被丢弃
+func (q *sendQueue) drain() [sendLanes][]*gate.Pack {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	lanes := q.lanes
+	for i, packs := range q.lanes {
+		if q.stats != nil && len(packs) > 0 {
+			q.stats.addSendQueued(i, -int64(len(packs)))
+		}
+		q.lanes[i] = nil
+	}
+	return lanes
+}
+
+// clear 丢弃所有未发送的包(发送协程退出时)
+func (q *sendQueue) clear() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	q.control = nil
+	for i, packs := range q.lanes {
+		if q.stats != nil && len(packs) > 0 {
+			q.stats.addSendQueued(i, -int64(len(packs)))
+		}
+		q.lanes[i] = nil
+	}
+}
+
+// depth 所有优先级的待发送包数(需持有锁)
+func (q *sendQueue) depth() int {
+	n := 0
+	for _, packs := range q.lanes {
+		n += len(packs)
+	}
+	return n
+}
+
+func (q *sendQueue) dropped(lane int) {
+	if q.stats != nil {
+		q.stats.addSendDropped(lane)
+	}
+}
@@ -0,0 +1,112 @@
+package gatebase
+
+import (
+	"testing"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSendQueue(policy string, size int) *sendQueue {
+	opts := gate.NewOptions(gate.WithSendQueue(gate.SendQueueOptions{
+		Lanes: map[string]gate.SendLane{gate.SendPriorityNormal: {Size: size, Policy: policy}},
+	}))
+	return newSendQueue(opts, nil)
+}
+
+// popTopics 取出队列中所有的包
+func popTopics(q *sendQueue) []string {
+	var topics []string
+	for {
+		pack, _, ok := q.pop(false)
+		if !ok {
+			return topics
+		}
+		topics = append(topics, pack.Topic)
+	}
+}
+
+func pushTopics(q *sendQueue, lane int, topics ...string) error {
+	for _, topic := range topics {
+		if err := q.push(&gate.Pack{Topic: topic}, lane, q.conf[lane].Policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSendQueuePriority(t *testing.T) {
+	q := newTestSendQueue("", 10)
+	assert.NoError(t, pushTopics(q, 2, "low/1"))
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "normal/1", "normal/2"))
+	assert.NoError(t, pushTopics(q, sendLaneHigh, "high/1"))
+	q.pushControl(&gate.Pack{Topic: gate.PACK_TOPIC_PONG})
+
+	pack, control, ok := q.pop(false)
+	assert.True(t, ok)
+	assert.True(t, control)
+	assert.Equal(t, gate.PACK_TOPIC_PONG, pack.Topic)
+	pack, control, ok = q.pop(false)
+	assert.True(t, ok)
+	assert.False(t, control)
+	assert.Equal(t, "high/1", pack.Topic)
+	assert.Equal(t, []string{"normal/1", "normal/2", "low/1"}, popTopics(q))
+}
+
+func TestSendQueuePolicy(t *testing.T) {
+	q := newTestSendQueue(gate.SendPolicyDropNewest, 2)
+	assert.Equal(t, errSendQueueFull, pushTopics(q, sendLaneNormal, "a/1", "a/2", "a/3"))
+	assert.Equal(t, []string{"a/1", "a/2"}, popTopics(q))
+
+	q = newTestSendQueue(gate.SendPolicyDropOldest, 2)
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/1", "a/2", "a/3"))
+	assert.Equal(t, []string{"a/2", "a/3"}, popTopics(q))
+
+	q = newTestSendQueue(gate.SendPolicyCoalesce, 2)
+	assert.NoError(t, q.push(&gate.Pack{Topic: "a/1", Body: []byte("old")}, sendLaneNormal, gate.SendPolicyCoalesce))
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/2"))
+	assert.NoError(t, q.push(&gate.Pack{Topic: "a/1", Body: []byte("new")}, sendLaneNormal, gate.SendPolicyCoalesce))
+	pack, _, _ := q.pop(false)
+	assert.Equal(t, "new", string(pack.Body))
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/3", "a/4"))
+	assert.Equal(t, []string{"a/3", "a/4"}, popTopics(q))
+
+	q = newTestSendQueue(gate.SendPolicyDisconnect, 1)
+	assert.Equal(t, errSlowConsumer, pushTopics(q, sendLaneNormal, "a/1", "a/2"))
+
+	// 控制包和不限长度的放入不受队列长度限制
+	q = newTestSendQueue(gate.SendPolicyDropNewest, 1)
+	for i := 0; i < 3; i++ {
+		q.pushControl(&gate.Pack{Topic: gate.PACK_TOPIC_PONG})
+		assert.NoError(t, q.push(&gate.Pack{Topic: "a/1"}, sendLaneNormal, ""))
+	}
+	assert.Len(t, popTopics(q), 6)
+}
+
+func TestSendQueueClose(t *testing.T) {
+	q := newTestSendQueue("", 10)
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/1"))
+	q.close()
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/2")) // 关闭后放入的包被丢弃
+	assert.Equal(t, []string{"a/1"}, popTopics(q))
+	_, _, ok := q.pop(true)
+	assert.False(t, ok)
+}
+
+func TestSendQueueStopDrain(t *testing.T) {
+	q := newTestSendQueue("", 10)
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/1"))
+	q.stop()
+	_, _, ok := q.pop(true)
+	assert.False(t, ok)
+
+	// 停止后lane队列继续缓存,控制包丢弃
+	q.pushControl(&gate.Pack{Topic: gate.PACK_TOPIC_PONG})
+	assert.NoError(t, pushTopics(q, sendLaneHigh, "h/1"))
+	lanes := q.drain()
+	assert.Len(t, lanes[sendLaneHigh], 1)
+	assert.Len(t, lanes[sendLaneNormal], 1)
+
+	assert.NoError(t, pushTopics(q, sendLaneNormal, "a/2"))
+	assert.Equal(t, [sendLanes][]*gate.Pack{}, q.drain())
+}
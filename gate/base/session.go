@@ -421,6 +421,50 @@ func (s *sessionAgent) ToSend(topic string, body []byte) error {
 	return server.GetRPC().CallNR(context.TODO(), "Send", s.session.SessionId, topic, body)
 }
 
+// Send batch message to the sessions(sessionId之间用,分割).
+func (s *sessionAgent) ToSendBatch(sessionids string, topic string, body []byte) (int64, error) {
+	if app.App() == nil {
+		return 0, fmt.Errorf("app.App is nil")
+	}
+	server, err := app.App().GetServerByID(s.session.ServerId)
+	if err != nil {
+		return 0, fmt.Errorf("Gate not found serverId(%s), err:%v", s.session.ServerId, err)
+	}
+	return mqrpc.Int64(server.GetRPC().Call(context.TODO(), "SendBatch", sessionids, topic, body))
+}
+
+// Join the session to the group.
+func (s *sessionAgent) ToJoinGroup(group string) error {
+	if app.App() == nil {
+		return fmt.Errorf("app.App is nil")
+	}
+	server, err := app.App().GetServerByID(s.session.ServerId)
+	if err != nil {
+		return fmt.Errorf("Gate not found serverId(%s), err:%v", s.session.ServerId, err)
+	}
+	_, err = server.GetRPC().Call(context.TODO(), "JoinGroup", s.session.SessionId, group)
+	if err != nil {
+		return fmt.Errorf("Call Gate serverId(%v) 'JoinGroup' err:%v", s.session.ServerId, err)
+	}
+	return nil
+}
+
+// Remove the session from the group.
+func (s *sessionAgent) ToLeaveGroup(group string) error {
+	if app.App() == nil {
+		return fmt.Errorf("app.App is nil")
+	}
+	server, err := app.App().GetServerByID(s.session.ServerId)
+	if err != nil {
+		return fmt.Errorf("Gate not found serverId(%s), err:%v", s.session.ServerId, err)
+	}
+	_, err = server.GetRPC().Call(context.TODO(), "LeaveGroup", s.session.SessionId, group)
+	if err != nil {
+		return fmt.Errorf("Call Gate serverId(%v) 'LeaveGroup' err:%v", s.session.ServerId, err)
+	}
+	return nil
+}
+
 // the session is connect status
 func (s *sessionAgent) ToConnected() (bool, error) {
 	if app.App() == nil {
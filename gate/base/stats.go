@@ -0,0 +1,77 @@
+package gatebase
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudapex/river/gate"
+)
+
+// statsMaxTopics 按topic统计的最大topic数量(客户端可以发送任意topic),超出后计入"*"
+const statsMaxTopics = 1024
+
+// gateStats 网关运行统计计数
+type gateStats struct {
+	aclDenied       sync.Map // topic -> *int64
+	aclDeniedTopics int32
+
+	sendQueued      [sendLanes]int64 // 按优先级
+	sendDropped     [sendLanes]int64
+	sendQueuePeak   int64
+	slowDisconnects int64
+}
+
+// addACLDenied 记录一个被访问控制拒绝的包
+func (s *gateStats) addACLDenied(topic string) {
+	n, ok := s.aclDenied.Load(topic)
+	if !ok {
+		if atomic.AddInt32(&s.aclDeniedTopics, 1) > statsMaxTopics {
+			atomic.AddInt32(&s.aclDeniedTopics, -1)
+			topic = "*"
+		}
+		var loaded bool
+		if n, loaded = s.aclDenied.LoadOrStore(topic, new(int64)); loaded && topic != "*" {
+			atomic.AddInt32(&s.aclDeniedTopics, -1)
+		}
+	}
+	atomic.AddInt64(n.(*int64), 1)
+}
+
+// addSendQueued 发送队列中的包数变化
+func (s *gateStats) addSendQueued(lane int, n int64) { atomic.AddInt64(&s.sendQueued[lane], n) }
+
+// addSendDropped 记录一个被丢弃(或合并掉)的待发送包
+func (s *gateStats) addSendDropped(lane int) { atomic.AddInt64(&s.sendDropped[lane], 1) }
+
+// addSlowDisconnect 记录一个因发送队列满被断开的连接
+func (s *gateStats) addSlowDisconnect() { atomic.AddInt64(&s.slowDisconnects, 1) }
+
+// updateSendQueuePeak 更新单个连接发送队列的最大深度
+func (s *gateStats) updateSendQueuePeak(depth int64) {
+	for {
+		peak := atomic.LoadInt64(&s.sendQueuePeak)
+		if depth <= peak || atomic.CompareAndSwapInt64(&s.sendQueuePeak, peak, depth) {
+			return
+		}
+	}
+}
+
+// snapshot 统计快照
+func (s *gateStats) snapshot() gate.Stats {
+	st := gate.Stats{
+		ACLDenied:       map[string]int64{},
+		SendQueued:      map[string]int64{},
+		SendDropped:     map[string]int64{},
+		SendQueuePeak:   atomic.LoadInt64(&s.sendQueuePeak),
+		SlowDisconnects: atomic.LoadInt64(&s.slowDisconnects),
+	}
+	for i, priority := range sendPriorities {
+		st.SendQueued[priority] = atomic.LoadInt64(&s.sendQueued[i])
+		st.SendDropped[priority] = atomic.LoadInt64(&s.sendDropped[i])
+	}
+	s.aclDenied.Range(func(k, v any) bool {
+		st.ACLDenied[k.(string)] = atomic.LoadInt64(v.(*int64))
+		return true
+	})
+	return st
+}
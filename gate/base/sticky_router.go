@@ -0,0 +1,111 @@
+package gatebase
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudapex/river/app"
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/log"
+	"github.com/cloudapex/river/registry"
+	"github.com/cloudapex/river/selector"
+)
+
+// NewStickyRouter 创建有状态模块的用户粘性路由
+func NewStickyRouter(gt gate.IGate, moduleTypes []string) *StickyRouter {
+	router := &StickyRouter{
+		gate:    gt,
+		modules: map[string]bool{},
+		services: func(moduleType string) ([]*registry.Service, error) {
+			return app.App().Options().Selector.GetService(moduleType)
+		},
+		serverByID: func(serverId string) (app.IModuleServerSession, error) {
+			return app.App().GetServerByID(serverId)
+		},
+	}
+	for _, typ := range moduleTypes {
+		router.modules[typ] = true
+	}
+	return router
+}
+
+// StickyRouter 按用户(未绑定时按session)一致性哈希分配模块节点, 分配结果保存在session的Settings[moduleType]中
+// 节点增删后在该用户的下一条消息时迁移到新节点, 迁移前回调handoff交接状态;
+// 业务手动绑定的节点(session.Set(moduleType, serverId))优先, 该节点下线后才重新分配
+type StickyRouter struct {
+	gate       gate.IGate
+	modules    map[string]bool
+	handoff    gate.FunStickyHandoff
+	rings      sync.Map                                                // moduleType -> *selector.HashRing
+	services   func(moduleType string) ([]*registry.Service, error)    // 获取模块的服务列表
+	serverByID func(serverId string) (app.IModuleServerSession, error) // 获取服务实例
+}
+
+// stickyRouteKey session中记录路由分配节点的key(与Settings[moduleType]不同时说明是手动绑定)
+func stickyRouteKey(moduleType string) string { return "sticky." + moduleType }
+
+// IsSticky 模块是否需要粘性路由
+func (this *StickyRouter) IsSticky(moduleType string) bool { return this.modules[moduleType] }
+
+// SetHandoff 设置节点迁移时的状态交接回调
+func (this *StickyRouter) SetHandoff(handoff gate.FunStickyHandoff) { this.handoff = handoff }
+
+// Route 获取session在该模块上分配的服务节点(首次或节点变化时更新分配)
+func (this *StickyRouter) Route(session gate.ISession, moduleType string) (app.IModuleServerSession, error) {
+	assigned, _ := session.Get(moduleType)
+	routed, _ := session.Get(stickyRouteKey(moduleType))
+	if assigned != "" && assigned != routed { // 手动绑定
+		if server, err := this.serverByID(assigned); err == nil {
+			return server, nil
+		}
+	}
+
+	ring, err := this.ring(moduleType)
+	if err != nil {
+		return nil, err
+	}
+	key := session.GetUserID()
+	if key == "" {
+		key = session.GetSessionID()
+	}
+	node, err := ring.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("Service(moduleType:%s) not found", moduleType)
+	}
+
+	if assigned != node.Id {
+		if assigned != "" && this.handoff != nil {
+			if err := this.handoff(session, moduleType, assigned, node.Id); err != nil {
+				return nil, fmt.Errorf("sticky handoff moduleType:%s from:%s to:%s err:%v", moduleType, assigned, node.Id, err)
+			}
+		}
+		_ = session.Set(moduleType, node.Id)
+		_ = session.Set(stickyRouteKey(moduleType), node.Id)
+		if storager := this.gate.GetStorageHandler(); storager != nil && session.GetUserID() != "" {
+			if err := storager.Storage(session); err != nil {
+				log.Warning("gate session storage failure : %v", err)
+			}
+		}
+		log.Debug("sticky route userId:%v sessionId:%v moduleType:%v from:%v to:%v", session.GetUserID(), session.GetSessionID(), moduleType, assigned, node.Id)
+	}
+	return this.serverByID(node.Id)
+}
+
+// ring 获取模块当前存活节点的哈希环(节点变化时重建)
+func (this *StickyRouter) ring(moduleType string) (*selector.HashRing, error) {
+	services, err := this.services(moduleType)
+	if err != nil {
+		return nil, fmt.Errorf("Service(moduleType:%s) not found, err:%v", moduleType, err)
+	}
+	var nodes []*registry.Node
+	for _, service := range services {
+		nodes = append(nodes, service.Nodes...)
+	}
+
+	if v, ok := this.rings.Load(moduleType); ok && v.(*selector.HashRing).Sign() == selector.NodesSign(nodes) {
+		return v.(*selector.HashRing), nil
+	}
+	ring := selector.NewHashRing(nodes, 0)
+	this.rings.Store(moduleType, ring)
+	return ring, nil
+}
@@ -0,0 +1,153 @@
+package gatebase
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudapex/river/app"
+	"github.com/cloudapex/river/gate"
+	"github.com/cloudapex/river/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+// stickyTestServer 只实现GetID的服务实例
+type stickyTestServer struct {
+	app.IModuleServerSession
+	id string
+}
+
+func (s *stickyTestServer) GetID() string { return s.id }
+
+// newTestStickyRouter 模块game的节点为nodes(可在测试中修改)
+func newTestStickyRouter(nodes *[]string) *StickyRouter {
+	router := NewStickyRouter(&GateBase{}, []string{"game"})
+	router.services = func(moduleType string) ([]*registry.Service, error) {
+		service := &registry.Service{Name: moduleType}
+		for _, id := range *nodes {
+			service.Nodes = append(service.Nodes, &registry.Node{Id: id})
+		}
+		return []*registry.Service{service}, nil
+	}
+	router.serverByID = func(serverId string) (app.IModuleServerSession, error) {
+		for _, id := range *nodes {
+			if id == serverId {
+				return &stickyTestServer{id: id}, nil
+			}
+		}
+		return nil, fmt.Errorf("server %s not found", serverId)
+	}
+	return router
+}
+
+func newStickyTestSession(t *testing.T, userId string) gate.ISession {
+	session, err := NewSessionByMap(map[string]any{"SessionId": "sid-" + userId, "UserId": userId})
+	assert.NoError(t, err)
+	return session
+}
+
+func TestStickyRouterStable(t *testing.T) {
+	nodes := []string{"game@1", "game@2", "game@3"}
+	router := newTestStickyRouter(&nodes)
+	assert.True(t, router.IsSticky("game"))
+	assert.False(t, router.IsSticky("chat"))
+
+	used := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		session := newStickyTestSession(t, fmt.Sprintf("u%d", i))
+		server, err := router.Route(session, "game")
+		assert.NoError(t, err)
+		assigned, _ := session.Get("game")
+		assert.Equal(t, server.GetID(), assigned)
+		used[assigned] = true
+		// 同一用户总是路由到同一节点
+		for j := 0; j < 3; j++ {
+			again, err := router.Route(session, "game")
+			assert.NoError(t, err)
+			assert.Equal(t, server.GetID(), again.GetID())
+		}
+	}
+	assert.Len(t, used, 3)
+
+	nodes = nil
+	_, err := router.Route(newStickyTestSession(t, "nobody"), "game")
+	assert.Error(t, err)
+}
+
+func TestStickyRouterMigrate(t *testing.T) {
+	nodes := []string{"game@1", "game@2", "game@3"}
+	router := newTestStickyRouter(&nodes)
+	var handoffs []string
+	router.SetHandoff(func(session gate.ISession, moduleType, from, to string) error {
+		handoffs = append(handoffs, from+">"+to)
+		return nil
+	})
+	session := newStickyTestSession(t, "u1")
+	server, err := router.Route(session, "game")
+	assert.NoError(t, err)
+	from := server.GetID()
+	assert.Empty(t, handoffs)
+
+	// 分配的节点下线后迁移到新节点
+	for i, id := range nodes {
+		if id == from {
+			nodes = append(nodes[:i:i], nodes[i+1:]...)
+			break
+		}
+	}
+	server, err = router.Route(session, "game")
+	assert.NoError(t, err)
+	assert.NotEqual(t, from, server.GetID())
+	assert.Equal(t, []string{from + ">" + server.GetID()}, handoffs)
+
+	// 交接失败时放弃本次路由,保留原分配
+	nodes = append(nodes, from)
+	router.SetHandoff(func(session gate.ISession, moduleType, from, to string) error {
+		return errors.New("busy")
+	})
+	assigned, _ := session.Get("game")
+	if _, err = router.Route(session, "game"); assert.Error(t, err) {
+		now, _ := session.Get("game")
+		assert.Equal(t, assigned, now)
+	}
+}
+
+func TestStickyRouterManualBinding(t *testing.T) {
+	nodes := []string{"game@1", "game@2", "game@3"}
+	router := newTestStickyRouter(&nodes)
+	handoffs := 0
+	router.SetHandoff(func(session gate.ISession, moduleType, from, to string) error {
+		handoffs++
+		return nil
+	})
+	session := newStickyTestSession(t, "u1")
+	server, err := router.Route(session, "game")
+	assert.NoError(t, err)
+
+	// 业务手动绑定到其他节点后,路由使用手动绑定的节点,不迁移
+	manual := "game@1"
+	if server.GetID() == manual {
+		manual = "game@2"
+	}
+	assert.NoError(t, session.Set("game", manual))
+	for i := 0; i < 3; i++ {
+		server, err = router.Route(session, "game")
+		assert.NoError(t, err)
+		assert.Equal(t, manual, server.GetID())
+	}
+	assigned, _ := session.Get("game")
+	assert.Equal(t, manual, assigned)
+	assert.Equal(t, 0, handoffs)
+
+	// 手动绑定的节点下线后重新分配
+	for i, id := range nodes {
+		if id == manual {
+			nodes = append(nodes[:i:i], nodes[i+1:]...)
+			break
+		}
+	}
+	server, err = router.Route(session, "game")
+	assert.NoError(t, err)
+	assert.NotEqual(t, manual, server.GetID())
+	assert.Equal(t, 1, handoffs)
+}
@@ -0,0 +1,183 @@
+// Package gate 跨gate广播
+package gate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudapex/river/app"
+	"github.com/nats-io/nats.go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// BroadcastMessage 发往所有gate的广播消息(通过nats主题发布一次)
+type BroadcastMessage struct {
+	Topic   string   `msgpack:"topic"`
+	Body    []byte   `msgpack:"body"`
+	Filters []string `msgpack:"filters"` // session设置的过滤条件(全部满足才发送,空发送给所有session)
+}
+
+// BroadcastReply gate回复的发送结果(BroadcastCount时)
+type BroadcastReply struct {
+	ServerId  string `msgpack:"server_id"`
+	Delivered int64  `msgpack:"delivered"`
+	Error     string `msgpack:"error"`
+}
+
+// BroadcastSubject 所有gate都订阅的广播消息主题(按进程分组环境隔离)
+func BroadcastSubject() string {
+	return fmt.Sprintf("river.%s.gate.broadcast", app.App().GetProcessEnv())
+}
+
+// Broadcast 广播给所有gate上满足过滤条件的session(只发布一次,无需等待结果)
+// filters为session设置的过滤条件,如"region=eu"、"level>=10"(见ParseSessionFilter)
+func Broadcast(topic string, body []byte, filters ...string) error {
+	data, err := marshalBroadcast(topic, body, filters)
+	if err != nil {
+		return err
+	}
+	return app.App().Transporter().Publish(BroadcastSubject(), data)
+}
+
+// BroadcastCount 广播并在wait时间内收集各gate的发送数量
+// 返回回复的gate数和发送成功的session数(未在wait内回复的gate不计入,结果为近似值)
+func BroadcastCount(topic string, body []byte, wait time.Duration, filters ...string) (gates int, delivered int64, err error) {
+	data, err := marshalBroadcast(topic, body, filters)
+	if err != nil {
+		return 0, 0, err
+	}
+	nc := app.App().Transporter()
+	inbox := nc.NewRespInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer sub.Unsubscribe()
+	if err := nc.PublishRequest(BroadcastSubject(), inbox, data); err != nil {
+		return 0, 0, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		m, err := sub.NextMsg(time.Until(deadline))
+		if errors.Is(err, nats.ErrTimeout) {
+			return gates, delivered, nil
+		}
+		if err != nil { // 连接断开等,返回已收集的结果
+			return gates, delivered, err
+		}
+		reply := &BroadcastReply{}
+		if err := msgpack.Unmarshal(m.Data, reply); err != nil {
+			continue
+		}
+		gates++
+		delivered += reply.Delivered
+	}
+}
+
+func marshalBroadcast(topic string, body []byte, filters []string) ([]byte, error) {
+	if _, err := ParseSessionFilters(filters); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(&BroadcastMessage{Topic: topic, Body: body, Filters: filters})
+}
+
+// ========== session过滤条件
+
+// SessionFilter session设置的过滤条件: Key Op Value
+// Op为 = != > >= < <=,两边都是数字时按数值比较,否则按字符串比较;
+// session没有该设置时只有!=满足;Value中不能包含比较符
+type SessionFilter struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// sessionFilterOps 支持的比较符(两个字符的在前)
+var sessionFilterOps = []string{"!=", ">=", "<=", "==", "=", ">", "<"}
+
+// ParseSessionFilter 解析过滤条件("region=eu"、"level>=10"、"vip!=1")
+func ParseSessionFilter(s string) (SessionFilter, error) {
+	i := strings.IndexAny(s, "=!<>")
+	if i <= 0 {
+		return SessionFilter{}, fmt.Errorf("invalid session filter %q", s)
+	}
+	f := SessionFilter{Key: strings.TrimSpace(s[:i])}
+	for _, op := range sessionFilterOps {
+		if strings.HasPrefix(s[i:], op) {
+			f.Op = op
+			break
+		}
+	}
+	if f.Op == "" {
+		return SessionFilter{}, fmt.Errorf("invalid session filter %q", s)
+	}
+	f.Value = strings.TrimSpace(s[i+len(f.Op):])
+	if f.Op == "==" {
+		f.Op = "="
+	}
+	// 值中不能再有比较符("level=>10"、"a<>b")
+	if f.Key == "" || strings.ContainsAny(f.Value, "=!<>") {
+		return SessionFilter{}, fmt.Errorf("invalid session filter %q", s)
+	}
+	return f, nil
+}
+
+// ParseSessionFilters 解析多个过滤条件
+func ParseSessionFilters(filters []string) ([]SessionFilter, error) {
+	fs := make([]SessionFilter, 0, len(filters))
+	for _, s := range filters {
+		f, err := ParseSessionFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// Match session是否满足条件
+func (f SessionFilter) Match(session ISession) bool {
+	v, ok := session.Get(f.Key)
+	if !ok {
+		return f.Op == "!="
+	}
+	cmp := strings.Compare(v, f.Value)
+	if a, err := strconv.ParseFloat(v, 64); err == nil {
+		if b, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			cmp = 0
+			if a < b {
+				cmp = -1
+			} else if a > b {
+				cmp = 1
+			}
+		}
+	}
+	switch f.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// MatchSessionFilters session是否满足所有条件
+func MatchSessionFilters(filters []SessionFilter, session ISession) bool {
+	for _, f := range filters {
+		if !f.Match(session) {
+			return false
+		}
+	}
+	return true
+}
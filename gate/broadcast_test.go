@@ -0,0 +1,74 @@
+package gate_test
+
+import (
+	"testing"
+
+	"github.com/cloudapex/river/gate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSessionFilter(t *testing.T) {
+	cases := []struct {
+		s    string
+		want gate.SessionFilter // 空表示拒绝
+	}{
+		{"region=eu", gate.SessionFilter{Key: "region", Op: "=", Value: "eu"}},
+		{"region==eu", gate.SessionFilter{Key: "region", Op: "=", Value: "eu"}},
+		{" level >= 10 ", gate.SessionFilter{Key: "level", Op: ">=", Value: "10"}},
+		{"level<=10", gate.SessionFilter{Key: "level", Op: "<=", Value: "10"}},
+		{"level>10", gate.SessionFilter{Key: "level", Op: ">", Value: "10"}},
+		{"level<10", gate.SessionFilter{Key: "level", Op: "<", Value: "10"}},
+		{"vip!=1", gate.SessionFilter{Key: "vip", Op: "!=", Value: "1"}},
+		{"tag=", gate.SessionFilter{Key: "tag", Op: "=", Value: ""}},
+		{"level=>10", gate.SessionFilter{}},
+		{"level=<10", gate.SessionFilter{}},
+		{"a<>b", gate.SessionFilter{}},
+		{"a===b", gate.SessionFilter{}},
+		{"a!b", gate.SessionFilter{}},
+		{"a>=<b", gate.SessionFilter{}},
+		{"=eu", gate.SessionFilter{}},
+		{" =eu", gate.SessionFilter{}},
+		{"region", gate.SessionFilter{}},
+		{"", gate.SessionFilter{}},
+	}
+	for _, c := range cases {
+		f, err := gate.ParseSessionFilter(c.s)
+		if c.want.Op == "" {
+			assert.Error(t, err, c.s)
+			continue
+		}
+		assert.NoError(t, err, c.s)
+		assert.Equal(t, c.want, f, c.s)
+	}
+	_, err := gate.ParseSessionFilters([]string{"region=eu", "level=>10"})
+	assert.Error(t, err)
+}
+
+func TestSessionFilterMatch(t *testing.T) {
+	session := newTestSession(t, "", map[string]string{"region": "eu", "level": "9"})
+	cases := []struct {
+		s  string
+		ok bool
+	}{
+		{"region=eu", true},
+		{"region!=eu", false},
+		{"region!=us", true},
+		{"level>=10", false}, // 按数值比较("9" > "10"按字符串)
+		{"level<10", true},
+		{"level>8.5", true},
+		{"region>ea", true}, // 非数字按字符串比较
+		{"vip=1", false},    // 没有该设置时只有!=满足
+		{"vip!=1", true},
+	}
+	for _, c := range cases {
+		f, err := gate.ParseSessionFilter(c.s)
+		assert.NoError(t, err, c.s)
+		assert.Equal(t, c.ok, f.Match(session), c.s)
+	}
+	filters, err := gate.ParseSessionFilters([]string{"region=eu", "level<10"})
+	assert.NoError(t, err)
+	assert.True(t, gate.MatchSessionFilters(filters, session))
+	filters, err = gate.ParseSessionFilters([]string{"region=eu", "level>=10"})
+	assert.NoError(t, err)
+	assert.False(t, gate.MatchSessionFilters(filters, session))
+}
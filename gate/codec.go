@@ -0,0 +1,291 @@
+// Package gate 数据包编解码
+package gate
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// IPackCodec 网关通讯协议的数据包编解码
+// 数据包格式为: [长度头][包体], 包体可整体加密(加密由agent处理,codec只负责包体结构)
+type IPackCodec interface {
+	// 长度头的字节数
+	HeadLen() int
+	// 从长度头解析出包体长度
+	ReadHead(head []byte) (bodyLen int, err error)
+	// 生成长度头
+	WriteHead(bodyLen int) ([]byte, error)
+	// 将Pack编码为包体
+	Marshal(pack *Pack) ([]byte, error)
+	// 从包体解码出Pack
+	Unmarshal(body []byte) (*Pack, error)
+}
+
+// topic长度的最高位作为压缩标记(PACK_FLAG_COMPRESSED),次高位作为请求标记(PACK_FLAG_REQUEST)
+const (
+	defaultPackCompressedBit = 0x8000
+	defaultPackRequestBit    = 0x4000
+	defaultPackTopicLenMask  = 0x3FFF
+)
+
+// NewDefaultPackCodec 默认编解码: [uint16 总长度][uint16 topic长度(最高两位为压缩和请求标记)][topic][uint32 ReqId(有请求标记时)][body](小端序)
+func NewDefaultPackCodec() IPackCodec { return defaultPackCodec{} }
+
+type defaultPackCodec struct{}
+
+func (defaultPackCodec) HeadLen() int { return PACK_HEAD_TOTAL_LEN_SIZE }
+
+func (defaultPackCodec) ReadHead(head []byte) (int, error) {
+	totalLen := int(binary.LittleEndian.Uint16(head))
+	if totalLen < PACK_HEAD_TOTAL_LEN_SIZE {
+		return 0, fmt.Errorf("package len too small")
+	}
+	return totalLen - PACK_HEAD_TOTAL_LEN_SIZE, nil
+}
+
+func (defaultPackCodec) WriteHead(bodyLen int) ([]byte, error) {
+	totalLen := PACK_HEAD_TOTAL_LEN_SIZE + bodyLen
+	if totalLen > 0xFFFF {
+		return nil, fmt.Errorf("package size %d exceeds max size %d", totalLen, 0xFFFF)
+	}
+	head := make([]byte, PACK_HEAD_TOTAL_LEN_SIZE)
+	binary.LittleEndian.PutUint16(head, uint16(totalLen))
+	return head, nil
+}
+
+func (defaultPackCodec) Marshal(pack *Pack) ([]byte, error) {
+	idLen := len(pack.Topic)
+	if idLen > defaultPackTopicLenMask {
+		return nil, fmt.Errorf("topic too long")
+	}
+	head := uint16(idLen)
+	if pack.Flags&PACK_FLAG_COMPRESSED != 0 {
+		head |= defaultPackCompressedBit
+	}
+	reqLen := 0
+	if pack.Flags&PACK_FLAG_REQUEST != 0 {
+		head |= defaultPackRequestBit
+		reqLen = 4
+	}
+	body := make([]byte, PACK_HEAD_MSG_ID_LEN_SIZE+idLen+reqLen+len(pack.Body))
+	binary.LittleEndian.PutUint16(body, head)
+	copy(body[PACK_HEAD_MSG_ID_LEN_SIZE:], pack.Topic)
+	if reqLen > 0 {
+		binary.LittleEndian.PutUint32(body[PACK_HEAD_MSG_ID_LEN_SIZE+idLen:], pack.ReqId)
+	}
+	copy(body[PACK_HEAD_MSG_ID_LEN_SIZE+idLen+reqLen:], pack.Body)
+	return body, nil
+}
+
+func (defaultPackCodec) Unmarshal(body []byte) (*Pack, error) {
+	if len(body) < PACK_HEAD_MSG_ID_LEN_SIZE {
+		return nil, fmt.Errorf("package len too small")
+	}
+	head := binary.LittleEndian.Uint16(body)
+	topicLen := int(head & defaultPackTopicLenMask)
+	reqLen := 0
+	if head&defaultPackRequestBit != 0 {
+		reqLen = 4
+	}
+	if len(body) < PACK_HEAD_MSG_ID_LEN_SIZE+topicLen+reqLen {
+		return nil, fmt.Errorf("package len not enough for topic and body")
+	}
+	pack := &Pack{
+		Topic: string(body[PACK_HEAD_MSG_ID_LEN_SIZE : PACK_HEAD_MSG_ID_LEN_SIZE+topicLen]),
+		Body:  body[PACK_HEAD_MSG_ID_LEN_SIZE+topicLen+reqLen:],
+	}
+	if head&defaultPackCompressedBit != 0 {
+		pack.Flags |= PACK_FLAG_COMPRESSED
+	}
+	if reqLen > 0 {
+		pack.Flags |= PACK_FLAG_REQUEST
+		pack.ReqId = binary.LittleEndian.Uint32(body[PACK_HEAD_MSG_ID_LEN_SIZE+topicLen:])
+	}
+	return pack, nil
+}
+
+const binaryPackBodyHeadLen = 1 + 8 + 4 // flags + seq + msgId
+
+// gate控制包保留的msgId
+var binaryPackReservedIDs = map[uint32]string{
+	0xFFFFFF01: PACK_TOPIC_PING,
+	0xFFFFFF02: PACK_TOPIC_PONG,
+	0xFFFFFF03: PACK_TOPIC_KICKED,
+	0xFFFFFF04: PACK_TOPIC_RESUME,
+	0xFFFFFF05: PACK_TOPIC_RESUME_TOKEN,
+	0xFFFFFF06: PACK_TOPIC_RESUME_FAILED,
+	0xFFFFFF07: PACK_TOPIC_SECURE_HELLO,
+	0xFFFFFF08: PACK_TOPIC_COMPRESS,
+	0xFFFFFF09: PACK_TOPIC_AUTH,
+	0xFFFFFF0A: PACK_TOPIC_AUTH_FAILED,
+	0xFFFFFF0B: PACK_TOPIC_AUTH_REQUIRED,
+	0xFFFFFF0C: PACK_TOPIC_ERROR,
+}
+
+// NewBinaryPackCodec 数字消息ID编解码: [uint32 总长度][uint8 flags][uint64 seq][uint32 msgId][uint32 ReqId(flags有PACK_FLAG_REQUEST时)][body](小端序)
+// msgId与topic的对应关系通过RegisterMsgID注册(0xFFFFFF00以上保留给gate控制包)
+func NewBinaryPackCodec() *BinaryPackCodec {
+	c := &BinaryPackCodec{
+		topics: map[uint32]string{},
+		ids:    map[string]uint32{},
+	}
+	for msgId, topic := range binaryPackReservedIDs {
+		c.RegisterMsgID(msgId, topic)
+	}
+	return c
+}
+
+// BinaryPackCodec 数字消息ID编解码(支持超过64KB的数据包)
+type BinaryPackCodec struct {
+	lock   sync.RWMutex
+	topics map[uint32]string // msgId -> topic
+	ids    map[string]uint32 // topic -> msgId
+}
+
+// RegisterMsgID 注册msgId与topic的对应关系
+func (c *BinaryPackCodec) RegisterMsgID(msgId uint32, topic string) *BinaryPackCodec {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.topics[msgId] = topic
+	c.ids[topic] = msgId
+	return c
+}
+
+func (c *BinaryPackCodec) HeadLen() int { return 4 }
+
+func (c *BinaryPackCodec) ReadHead(head []byte) (int, error) {
+	totalLen := int(binary.LittleEndian.Uint32(head))
+	if totalLen < 4+binaryPackBodyHeadLen {
+		return 0, fmt.Errorf("package len too small")
+	}
+	return totalLen - 4, nil
+}
+
+func (c *BinaryPackCodec) WriteHead(bodyLen int) ([]byte, error) {
+	head := make([]byte, 4)
+	binary.LittleEndian.PutUint32(head, uint32(4+bodyLen))
+	return head, nil
+}
+
+func (c *BinaryPackCodec) Marshal(pack *Pack) ([]byte, error) {
+	c.lock.RLock()
+	msgId, ok := c.ids[pack.Topic]
+	c.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("msgId of topic(%s) not registered", pack.Topic)
+	}
+	headLen := binaryPackBodyHeadLen
+	if pack.Flags&PACK_FLAG_REQUEST != 0 {
+		headLen += 4
+	}
+	body := make([]byte, headLen+len(pack.Body))
+	body[0] = pack.Flags
+	binary.LittleEndian.PutUint64(body[1:], pack.Seq)
+	binary.LittleEndian.PutUint32(body[9:], msgId)
+	if headLen > binaryPackBodyHeadLen {
+		binary.LittleEndian.PutUint32(body[binaryPackBodyHeadLen:], pack.ReqId)
+	}
+	copy(body[headLen:], pack.Body)
+	return body, nil
+}
+
+func (c *BinaryPackCodec) Unmarshal(body []byte) (*Pack, error) {
+	if len(body) < binaryPackBodyHeadLen {
+		return nil, fmt.Errorf("package len too small")
+	}
+	msgId := binary.LittleEndian.Uint32(body[9:])
+	c.lock.RLock()
+	topic, ok := c.topics[msgId]
+	c.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("topic of msgId(%d) not registered", msgId)
+	}
+	pack := &Pack{
+		Topic: topic,
+		Body:  body[binaryPackBodyHeadLen:],
+		Seq:   binary.LittleEndian.Uint64(body[1:]),
+		Flags: body[0],
+	}
+	if pack.Flags&PACK_FLAG_REQUEST != 0 {
+		if len(pack.Body) < 4 {
+			return nil, fmt.Errorf("package len not enough for reqId")
+		}
+		pack.ReqId = binary.LittleEndian.Uint32(pack.Body)
+		pack.Body = pack.Body[4:]
+	}
+	return pack, nil
+}
+
+// settings中可配置的编解码名称
+const (
+	PackCodecDefault = "default" // NewDefaultPackCodec(topic字符串,适合JSON包体的客户端)
+	PackCodecBinary  = "binary"  // NewBinaryPackCodec(数字msgId,通过msg_ids配置)
+)
+
+// SubprotocolCodecConfig settings中子协议的编解码配置
+type SubprotocolCodecConfig struct {
+	Codec  string            `json:"codec"`   // PackCodecXxx
+	MsgIDs map[string]string `json:"msg_ids"` // binary编解码的msgId -> topic
+}
+
+// UnmarshalJSON 支持只写编解码名称的简写
+func (c *SubprotocolCodecConfig) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &c.Codec)
+	}
+	type config SubprotocolCodecConfig
+	return json.Unmarshal(data, (*config)(c))
+}
+
+// NewCodec 按配置创建编解码
+func (c SubprotocolCodecConfig) NewCodec() (IPackCodec, error) {
+	switch c.Codec {
+	case PackCodecDefault:
+		if len(c.MsgIDs) > 0 {
+			return nil, fmt.Errorf("msg_ids only supported by codec %q", PackCodecBinary)
+		}
+		return NewDefaultPackCodec(), nil
+	case PackCodecBinary:
+		codec := NewBinaryPackCodec()
+		for id, topic := range c.MsgIDs {
+			msgId, err := strconv.ParseUint(id, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("msg id %q invalid", id)
+			}
+			if msgId >= 0xFFFFFF00 {
+				return nil, fmt.Errorf("msg id %q is reserved", id)
+			}
+			codec.RegisterMsgID(uint32(msgId), topic)
+		}
+		return codec, nil
+	default:
+		return nil, fmt.Errorf("codec %q not supported", c.Codec)
+	}
+}
+
+// ParseSubprotocolCodecs 解析settings中子协议对应的编解码(json对象: 子协议 -> 编解码名称或SubprotocolCodecConfig)
+func ParseSubprotocolCodecs(v any) (map[string]IPackCodec, error) {
+	configs := map[string]SubprotocolCodecConfig{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+	codecs := make(map[string]IPackCodec, len(configs))
+	for name, config := range configs {
+		if name == "" {
+			return nil, fmt.Errorf("subprotocol name must not be empty")
+		}
+		codec, err := config.NewCodec()
+		if err != nil {
+			return nil, fmt.Errorf("subprotocol %s: %v", name, err)
+		}
+		codecs[name] = codec
+	}
+	return codecs, nil
+}
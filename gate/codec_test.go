@@ -0,0 +1,129 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// roundTrip 编码后再解码(包括长度头)
+func roundTrip(t *testing.T, codec IPackCodec, pack *Pack) *Pack {
+	body, err := codec.Marshal(pack)
+	assert.NoError(t, err)
+	head, err := codec.WriteHead(len(body))
+	assert.NoError(t, err)
+	assert.Len(t, head, codec.HeadLen())
+	bodyLen, err := codec.ReadHead(head)
+	assert.NoError(t, err)
+	assert.Equal(t, len(body), bodyLen)
+	got, err := codec.Unmarshal(body)
+	assert.NoError(t, err)
+	return got
+}
+
+func TestDefaultPackCodec(t *testing.T) {
+	codec := NewDefaultPackCodec()
+	packs := []*Pack{
+		{Topic: "chat/say", Body: []byte("hello")},
+		{Topic: "chat/say", Body: []byte{}},
+		{Topic: "chat/say", Body: []byte("zip"), Flags: PACK_FLAG_COMPRESSED},
+		{Topic: "chat/say", Body: []byte("req"), Flags: PACK_FLAG_REQUEST, ReqId: 0xFFFFFFFE},
+		{Topic: "chat/say", Body: []byte("both"), Flags: PACK_FLAG_REQUEST | PACK_FLAG_COMPRESSED, ReqId: 7},
+		{Topic: PACK_TOPIC_PING, Body: []byte("12345678")},
+	}
+	for _, pack := range packs {
+		got := roundTrip(t, codec, pack)
+		assert.Equal(t, pack.Topic, got.Topic)
+		assert.Equal(t, string(pack.Body), string(got.Body))
+		assert.Equal(t, pack.Flags, got.Flags)
+		assert.Equal(t, pack.ReqId, got.ReqId)
+		assert.Zero(t, got.Seq) // 默认编解码不传输序号
+	}
+
+	_, err := codec.Marshal(&Pack{Topic: string(make([]byte, defaultPackTopicLenMask+1))})
+	assert.Error(t, err)
+	_, err = codec.WriteHead(0xFFFF)
+	assert.Error(t, err)
+	_, err = codec.Unmarshal([]byte{1})
+	assert.Error(t, err)
+	_, err = codec.Unmarshal([]byte{10, 0, 'a'}) // topic长度超过包体
+	assert.Error(t, err)
+	_, err = codec.Unmarshal([]byte{1, defaultPackRequestBit >> 8, 'a', 1, 2}) // 缺少ReqId
+	assert.Error(t, err)
+}
+
+func TestBinaryPackCodec(t *testing.T) {
+	codec := NewBinaryPackCodec().RegisterMsgID(1, "chat/say")
+	packs := []*Pack{
+		{Topic: "chat/say", Body: []byte("hello"), Seq: 1},
+		{Topic: "chat/say", Body: []byte("big seq"), Seq: 1<<40 + 3},
+		{Topic: "chat/say", Body: []byte("zip"), Flags: PACK_FLAG_COMPRESSED},
+		{Topic: "chat/say", Body: []byte("req"), Flags: PACK_FLAG_REQUEST, ReqId: 0xFFFFFFFE, Seq: 9},
+		{Topic: "chat/say", Flags: PACK_FLAG_REQUEST, ReqId: 1},
+	}
+	for _, pack := range packs {
+		got := roundTrip(t, codec, pack)
+		assert.Equal(t, pack.Topic, got.Topic)
+		assert.Equal(t, string(pack.Body), string(got.Body))
+		assert.Equal(t, pack.Flags, got.Flags)
+		assert.Equal(t, pack.ReqId, got.ReqId)
+		assert.Equal(t, pack.Seq, got.Seq)
+	}
+
+	// gate控制包使用保留的msgId
+	for msgId, topic := range binaryPackReservedIDs {
+		body, err := codec.Marshal(&Pack{Topic: topic, Body: []byte("x")})
+		assert.NoError(t, err)
+		assert.Equal(t, msgId, uint32(body[9])|uint32(body[10])<<8|uint32(body[11])<<16|uint32(body[12])<<24)
+		assert.Equal(t, topic, roundTrip(t, codec, &Pack{Topic: topic}).Topic)
+	}
+
+	_, err := codec.Marshal(&Pack{Topic: "chat/unknown"})
+	assert.Error(t, err)
+	_, err = codec.Unmarshal(make([]byte, binaryPackBodyHeadLen-1))
+	assert.Error(t, err)
+	_, err = codec.Unmarshal(make([]byte, binaryPackBodyHeadLen)) // msgId 0未注册
+	assert.Error(t, err)
+	_, err = codec.ReadHead([]byte{4 + binaryPackBodyHeadLen - 1, 0, 0, 0})
+	assert.Error(t, err)
+	body, _ := codec.Marshal(&Pack{Topic: "chat/say"})
+	body[0] = PACK_FLAG_REQUEST // 缺少ReqId
+	_, err = codec.Unmarshal(body)
+	assert.Error(t, err)
+}
+
+func TestParseSubprotocolCodecs(t *testing.T) {
+	codecs, err := ParseSubprotocolCodecs(map[string]any{
+		"river.json": "default",
+		"river.bin": map[string]any{
+			"codec":   "binary",
+			"msg_ids": map[string]any{"1": "chat/say"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, codecs, 2)
+	assert.Equal(t, NewDefaultPackCodec(), codecs["river.json"])
+	if assert.IsType(t, &BinaryPackCodec{}, codecs["river.bin"]) {
+		pack := &Pack{Topic: "chat/say", Body: []byte("hi")}
+		assert.Equal(t, pack.Topic, roundTrip(t, codecs["river.bin"], pack).Topic)
+	}
+
+	cases := []struct {
+		name string
+		v    any
+	}{
+		{"unknown codec", map[string]any{"river": "protobuf"}},
+		{"empty codec", map[string]any{"river": map[string]any{}}},
+		{"empty subprotocol", map[string]any{"": "default"}},
+		{"msg_ids on default", map[string]any{"river": map[string]any{"codec": "default", "msg_ids": map[string]any{"1": "chat/say"}}}},
+		{"invalid msg id", map[string]any{"river": map[string]any{"codec": "binary", "msg_ids": map[string]any{"x": "chat/say"}}}},
+		{"reserved msg id", map[string]any{"river": map[string]any{"codec": "binary", "msg_ids": map[string]any{"4294967041": "chat/say"}}}},
+		{"not an object", []any{"default"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseSubprotocolCodecs(c.v)
+			assert.Error(t, err)
+		})
+	}
+}
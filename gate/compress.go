@@ -0,0 +1,111 @@
+// Package gate 数据包压缩
+package gate
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 内置的压缩算法
+const (
+	CompressDeflate = "deflate"
+	CompressGzip    = "gzip"
+)
+
+// ICompressor 数据包body压缩算法
+type ICompressor interface {
+	Compress(data []byte) ([]byte, error)
+	// 解压(超过maxSize返回错误,防止解压炸弹)
+	Decompress(data []byte, maxSize int) ([]byte, error)
+}
+
+var compressors = sync.Map{} // name -> ICompressor
+
+func init() {
+	RegisterCompressor(CompressDeflate, flateCompressor{})
+	RegisterCompressor(CompressGzip, gzipCompressor{})
+}
+
+// RegisterCompressor 注册压缩算法
+func RegisterCompressor(name string, c ICompressor) { compressors.Store(name, c) }
+
+// GetCompressor 获取压缩算法
+func GetCompressor(name string) (ICompressor, bool) {
+	c, ok := compressors.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return c.(ICompressor), true
+}
+
+// readLimit 读取全部数据(超过maxSize返回错误)
+func readLimit(r io.Reader, maxSize int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("decompressed size exceeds %d", maxSize)
+	}
+	return data, nil
+}
+
+// 复用压缩器(创建flate压缩器需要分配几百KB内存)
+var (
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+type flateCompressor struct{}
+
+func (flateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return readLimit(r, maxSize)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, maxSize)
+}
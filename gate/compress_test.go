@@ -0,0 +1,62 @@
+package gate
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressors(t *testing.T) {
+	data := bytes.Repeat([]byte("river gate compress "), 100)
+	for _, name := range []string{CompressDeflate, CompressGzip} {
+		c, ok := GetCompressor(name)
+		assert.True(t, ok, name)
+
+		zipped, err := c.Compress(data)
+		assert.NoError(t, err)
+		assert.Less(t, len(zipped), len(data))
+		plain, err := c.Decompress(zipped, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, plain)
+
+		// 解压后超过maxSize(解压炸弹)
+		_, err = c.Decompress(zipped, len(data)-1)
+		assert.Error(t, err, name)
+
+		_, err = c.Decompress([]byte("not compressed"), len(data))
+		assert.Error(t, err, name)
+
+		empty, err := c.Compress(nil)
+		assert.NoError(t, err)
+		plain, err = c.Decompress(empty, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, plain)
+	}
+	_, ok := GetCompressor("zstd")
+	assert.False(t, ok)
+}
+
+// 复用的压缩器可以并发使用
+func TestCompressorsConcurrent(t *testing.T) {
+	for _, name := range []string{CompressDeflate, CompressGzip} {
+		c, _ := GetCompressor(name)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				data := bytes.Repeat([]byte{byte('a' + i)}, 1000+i)
+				for j := 0; j < 20; j++ {
+					zipped, err := c.Compress(data)
+					assert.NoError(t, err)
+					plain, err := c.Decompress(zipped, len(data))
+					assert.NoError(t, err)
+					assert.Equal(t, data, plain)
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
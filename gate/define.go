@@ -3,6 +3,9 @@ package gate
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/cloudapex/river/app"
@@ -22,12 +25,93 @@ const (
 	PACK_BODY_DEFAULT_SIZE_IN_POOL = 512 * 1024 // 缓存池中定义的缓存区大小
 
 	RPC_CONTEXT_KEY_SESSION = "rtx_session" // 定义需要RPC传输gate.session的ContextKey
+
+	PACK_TOPIC_KICKED           = "gate/kicked"     // 被踢下线时下发给客户端的通知包(Body为原因)
+	KICK_REASON_DUPLICATE_LOGIN = "duplicate_login" // 踢下线原因: 重复登录
+
+	// 心跳(gate内部处理,不转发给模块,不计入发送序号)
+	PACK_TOPIC_PING = "gate/ping" // 心跳请求(收到方回复PACK_TOPIC_PONG,Body原样带回)
+	PACK_TOPIC_PONG = "gate/pong" // 心跳回复(gate发起的ping的Body为8字节发送时间,用于计算RTT)
+
+	// 压缩协商(开启Options.Compression时): 客户端发送支持的算法列表(逗号分隔),gate回复选定的算法(空表示不压缩),
+	// 之后双方body超过阈值的包可压缩发送并设置PACK_FLAG_COMPRESSED
+	PACK_TOPIC_COMPRESS = "gate/compress"
+
+	PACK_FLAG_COMPRESSED uint8 = 0x01 // Pack.Flags: body已压缩(解压后不能超过Options.MaxPackSize)
+
+	// 请求模式: 客户端的包带PACK_FLAG_REQUEST和ReqId时,gate通过Call转发并把模块的返回值作为响应包下发
+	// (topic与请求相同,带PACK_FLAG_REQUEST和相同的ReqId),失败时下发同样带ReqId的PACK_TOPIC_ERROR
+	PACK_FLAG_REQUEST uint8 = 0x02
+
+	// 认证(开启Options.Authenticator时): 客户端发送token,成功时gate回复PACK_TOPIC_AUTH(Body为userId),
+	// 失败回复PACK_TOPIC_AUTH_FAILED(Body为原因);未认证时发送非公开topic的包会被丢弃并回复PACK_TOPIC_AUTH_REQUIRED(Body为topic,请求模式的包回复错误响应)
+	PACK_TOPIC_AUTH          = "gate/auth"
+	PACK_TOPIC_AUTH_FAILED   = "gate/auth_failed"
+	PACK_TOPIC_AUTH_REQUIRED = "gate/auth_required"
+
+	// 错误通知: gate拒绝或处理客户端的包失败时下发,Body为PackError的json
+	PACK_TOPIC_ERROR = "gate/error"
+
+	// 加密通道握手(开启Options.SecureCipher时): 连接建立后gate先发送自己的公钥,客户端回复自己的公钥,之后所有包体加密传输
+	// (配置了Options.EncryptKey时双方用它作为HKDF的salt派生会话key,见secure.KeyExchange.Channel)
+	PACK_TOPIC_SECURE_HELLO = "gate/secure_hello" // Body为X25519公钥(32字节)
+
+	// 断线重连(开启Options.ResumeGrace时),以下控制包不计入发送序号
+	PACK_TOPIC_RESUME        = "gate/resume"        // 客户端重连后发送的第一个包(Body为"token:已收到的最大序号")
+	PACK_TOPIC_RESUME_TOKEN  = "gate/resume_token"  // 下发给客户端的重连token(Body为token,每次连接/重连成功都会更新)
+	PACK_TOPIC_RESUME_FAILED = "gate/resume_failed" // 重连失败(token无效/已过期/缺失的消息已不在缓存中),按新连接处理
 )
 
+// IsControlTopic 是否为gate的控制包("gate/"开头的topic,不计入发送序号,重连时不补发)
+func IsControlTopic(topic string) bool {
+	return strings.HasPrefix(topic, "gate/")
+}
+
+// ErrDuplicateLogin 重复登录被拒绝(DuplicateLoginRejectNew策略)
+var ErrDuplicateLogin = errors.New("duplicate login")
+
 // Pack 消息包
 type Pack struct {
 	Topic string // "moduleTyp/msgId"
 	Body  []byte
+	Seq   uint64 // 发送序号(开启断线重连时由gate在实际发送时从1开始分配,客户端按收到的非控制包计数,见IsControlTopic)
+	Flags uint8  // 包标记(由IPackCodec决定是否传输)
+	ReqId uint32 // 客户端请求ID(带PACK_FLAG_REQUEST时有效)
+}
+
+// PackError 错误通知包(PACK_TOPIC_ERROR)的内容
+type PackError struct {
+	Topic string `json:"topic"` // 出错的客户端包的topic
+	Code  string `json:"code"`  // 错误码(PACK_ERR_XXX)
+	Msg   string `json:"msg"`
+}
+
+// 错误码
+const (
+	PACK_ERR_FORBIDDEN = "forbidden" // 被访问控制拒绝
+	PACK_ERR_TIMEOUT   = "timeout"   // 请求超时
+	PACK_ERR_FAILED    = "failed"    // 请求处理失败(模块返回错误或找不到服务)
+)
+
+// ErrRequestTimeout 请求模式的包等待模块返回超时
+var ErrRequestTimeout = errors.New("request timeout")
+
+// NewErrorPack 创建错误通知包
+func NewErrorPack(topic, code, msg string) *Pack {
+	body, _ := json.Marshal(&PackError{Topic: topic, Code: code, Msg: msg})
+	return &Pack{Topic: PACK_TOPIC_ERROR, Body: body}
+}
+
+// NewResponsePack 创建请求的响应包
+func NewResponsePack(req *Pack, body []byte) *Pack {
+	return &Pack{Topic: req.Topic, Body: body, Flags: PACK_FLAG_REQUEST, ReqId: req.ReqId}
+}
+
+// NewResponseError 创建请求的错误响应(带请求的ReqId的PACK_TOPIC_ERROR)
+func NewResponseError(req *Pack, code, msg string) *Pack {
+	pack := NewErrorPack(req.Topic, code, msg)
+	pack.Flags, pack.ReqId = PACK_FLAG_REQUEST, req.ReqId
+	return pack
 }
 
 // get session from context
@@ -82,14 +166,29 @@ type IDelegater interface {
 	// Send message to the session.
 	OnRpcSend(ctx context.Context, sessionId string, topic string, body []byte) (bool, error)
 
-	// 广播消息给网关所有在连客户端
+	// Send message to the sessions(sessionId之间用,分割).
+	OnRpcSendBatch(ctx context.Context, sessionIds string, topic string, body []byte) (int64, error)
+
+	// 广播消息给网关所有在连客户端(跨网关广播使用gate.Broadcast)
 	OnRpcBroadcast(ctx context.Context, topic string, body []byte) (int64, error)
 
+	// 加入分组(房间/频道),断开连接时自动离开所有分组
+	OnRpcJoinGroup(ctx context.Context, sessionId string, group string) (bool, error)
+
+	// 离开分组
+	OnRpcLeaveGroup(ctx context.Context, sessionId string, group string) (bool, error)
+
+	// 发送消息给分组在本网关上的成员(跨网关发送使用gate.SendGroup)
+	OnRpcGroupSend(ctx context.Context, group string, topic string, body []byte) (int64, error)
+
 	// 检查连接是否正常
 	OnRpcConnected(ctx context.Context, sessionId string) (bool, error)
 
 	// 主动关闭连接
 	OnRpcClose(ctx context.Context, sessionId string) (bool, error)
+
+	// 踢下线(先下发PACK_TOPIC_KICKED通知包再关闭连接)
+	OnRpcKick(ctx context.Context, sessionId string, reason string) (bool, error)
 }
 
 // ISession session代表一个客户端连接,不是线程安全的
@@ -155,7 +254,11 @@ type ISession interface {
 	ToSend(topic string, body []byte) error
 
 	// Send batch message to the sessions(sessionId之间用,分割).
-	//ToSendBatch(sessionids string, topic string, body []byte) (int64, error)
+	ToSendBatch(sessionids string, topic string, body []byte) (int64, error)
+	// Join the session to the group.
+	ToJoinGroup(group string) error
+	// Remove the session from the group.
+	ToLeaveGroup(group string) error
 
 	// the session is connect status
 	ToConnected() (bool, error)
@@ -176,6 +279,7 @@ type IClientAgent interface {
 	IsShaked() bool       // 连接就绪(有些协议会在连接成功后要先握手)
 	RecvNum() int64       // 接收消息的数量
 	SendNum() int64       // 发送消息的数量
+	RTT() time.Duration   // 最近一次心跳的往返时间(开启Options.HeartbeatInterval后有效)
 	GetSession() ISession // 管理的ClientSession
 
 	// 发送数据
@@ -224,6 +328,9 @@ type RouteHandler interface {
 // FunSendMessageHook 给客户端下发消息拦截器
 type FunSendMessageHook func(session ISession, topic string, msg []byte) ([]byte, error)
 
+// FunStickyHandoff 粘性路由的节点迁移回调(用于有状态模块交接用户状态,返回error则放弃本次路由)
+type FunStickyHandoff func(session ISession, moduleType, fromServerId, toServerId string) error
+
 // FunRecvPackHandler 处理接收的消息包
 type FunRecvPackHandler func(session ISession, pack *Pack) error
 
@@ -238,3 +345,8 @@ type ISessionLearner interface {
 	OnConnect(a ISession)    //当连接建立  并且协议握手成功
 	OnDisConnect(a ISession) //当连接关闭	 或者客户端主动发送DisConnect命令
 }
+
+// IKickLearner 可选接口: SessionLearner同时实现时,连接被踢下线(重复登录等)时回调,之后还会触发OnDisConnect
+type IKickLearner interface {
+	OnKicked(a ISession, reason string)
+}
@@ -0,0 +1,30 @@
+// Package gate 分组消息
+package gate
+
+import (
+	"fmt"
+
+	"github.com/cloudapex/river/app"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// GroupMessage 发往分组的消息(通过nats主题广播到所有gate)
+type GroupMessage struct {
+	Group string `msgpack:"group"`
+	Topic string `msgpack:"topic"`
+	Body  []byte `msgpack:"body"`
+}
+
+// GroupSubject 所有gate都订阅的分组消息主题(按进程分组环境隔离)
+func GroupSubject() string {
+	return fmt.Sprintf("river.%s.gate.group", app.App().GetProcessEnv())
+}
+
+// SendGroup 发送消息给分组内所有成员(跨所有gate,只发布一次,无需等待结果)
+func SendGroup(group, topic string, body []byte) error {
+	data, err := msgpack.Marshal(&GroupMessage{Group: group, Topic: topic, Body: body})
+	if err != nil {
+		return err
+	}
+	return app.App().Transporter().Publish(GroupSubject(), data)
+}
@@ -2,9 +2,11 @@
 package gate
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/cloudapex/river/module/server"
+	"github.com/cloudapex/river/network"
 )
 
 // 配置键常量定义
@@ -12,16 +14,114 @@ const (
 	// 服务器配置
 	SettingKeyWSAddr  = "ws_addr"  // WebSocket监听地址
 	SettingKeyTCPAddr = "tcp_addr" // TCP监听地址
+	SettingKeyKCPAddr = "kcp_addr" // KCP(可靠UDP)监听地址
+
+	// WebTransport(HTTP/3)监听地址(使用tls_cert_file/tls_key_file的证书)
+	SettingKeyQUICAddr = "quic_addr"
+	SettingKeyQUICPath = "quic_path" // WebTransport会话路径(空不限制)
 
 	// TLS
 	SettingKeyTLS      = "tls"           // 是否启用TLS
 	SettingKeyCertFile = "tls_cert_file" // 证书文件路径
 	SettingKeyKeyFile  = "tls_key_file"  // 私钥文件路径
 
+	// TLS高级配置(network.TLSOptions的json对象: 最低版本/加密套件/双向认证/SNI多证书/证书热更新)
+	SettingKeyTLSOptions = "tls_options"
+
+	// 负载均衡后获取客户端真实IP
+	SettingKeyProxyProtocol  = "proxy_protocol"  // tcp/ws监听是否解析PROXY protocol(v1/v2)头
+	SettingKeyTrustedProxies = "trusted_proxies" // 可信代理的网段列表(CIDR或IP)
+
 	// 通讯加密
-	SettingKeyEncryptKey = "encrypt_key" // 消息包加密key
+	SettingKeyEncryptKey   = "encrypt_key"   // 消息包加密key
+	SettingKeySecureCipher = "secure_cipher" // 加密通道算法(aes-gcm/chacha20-poly1305)
+
+	// 压缩
+	SettingKeyCompression       = "compression"        // 数据包压缩算法(deflate/gzip,需客户端协商)
+	SettingKeyCompressThreshold = "compress_threshold" // body超过该字节数才压缩
+	SettingKeyWSCompression     = "ws_compression"     // WebSocket是否开启permessage-deflate
+
+	// WebSocket握手
+	SettingKeyWSAllowedOrigins    = "ws_allowed_origins"    // 允许的Origin列表(空不限制,支持"*.example.com";同样用于WebTransport)
+	SettingKeyWSSubprotocols      = "ws_subprotocols"       // 支持的子协议列表(Sec-WebSocket-Protocol)
+	SettingKeyWSSubprotocolCodecs = "ws_subprotocol_codecs" // 子协议对应的编解码(子协议 -> "default"/"binary"或{"codec":"binary","msg_ids":{...}})
+	SettingKeyWSReadBufferSize    = "ws_read_buffer_size"   // 读缓存大小(默认5120)
+	SettingKeyWSWriteBufferSize   = "ws_write_buffer_size"  // 写缓存大小(默认5120)
+
+	// 认证
+	SettingKeyAuthSecret     = "auth_secret"      // HMAC(JWT HS256) token的密钥(配置后使用HMACAuthenticator)
+	SettingKeyAuthModule     = "auth_module"      // 验证token的认证模块类型(配置后使用RPCAuthenticator)
+	SettingKeyAuthMethod     = "auth_method"      // 认证模块的方法名(默认"Auth")
+	SettingKeyAuthTokenParam = "auth_token_param" // ws握手时携带token的url参数名(默认"token")
+	SettingKeyAuthTimeout    = "auth_timeout"     // 验证token的超时时间(秒,默认10)
+	SettingKeyPublicTopics   = "public_topics"    // 未认证也可发送的topic列表(模块类型或完整topic)
+
+	// 访问控制(TopicACL的json对象: {"allow_modules":[],"rules":[{"topic","guest","roles","settings"}],"role_key"})
+	SettingKeyTopicACL = "topic_acl"
+
+	// 请求模式(PACK_FLAG_REQUEST)
+	SettingKeyRequestTimeout = "request_timeout" // 等待模块返回的超时时间(秒,默认使用app的RPCExpired)
+
+	// 有序转发(session/user,空不开启)
+	SettingKeyOrderedDispatch = "ordered_dispatch"
+
+	// 发送(背压)
+	SettingKeySendQueue    = "send_queue"    // 按优先级的发送队列(SendQueueOptions的json对象: {"topics":{topic:priority},"lanes":{priority:{"size","policy"}}})
+	SettingKeyWriteTimeout = "write_timeout" // 单次写入超时(秒,默认30,0不超时)
+	SettingKeyWriteBatch   = "write_batch"   // tcp/kcp连接一次合并写入的最大包数(默认16,<=1不合并)
+
+	// 路由
+	SettingKeyStickyModules = "sticky_modules" // 需要按用户粘性路由的模块类型列表
+
+	// 登录
+	SettingKeyDuplicateLogin = "duplicate_login" // 重复登录策略(allow/kick_old/reject_new)
+
+	// 心跳
+	SettingKeyHeartbeatInterval = "heartbeat_interval" // 空闲连接的心跳间隔(秒,0不开启)
+
+	// 限流
+	SettingKeyRateLimit       = "rate_limit"        // 单个连接的接收限流({"pack_rate","pack_burst","byte_rate","byte_burst"})
+	SettingKeyTopicRateLimits = "topic_rate_limits" // 按topic(或模块类型)覆盖的接收限流({topic:rate_limit})
+	SettingKeyRateLimitAction = "rate_limit_action" // 超出限流时的处理(drop/delay/disconnect)
+	SettingKeyMaxConnPerIP    = "max_conn_per_ip"   // 单个IP允许的最大连接数
+	SettingKeyMaxConnNum      = "max_conn_num"      // 单个监听允许的最大连接数
+
+	// 断线重连
+	SettingKeyResumeGrace  = "resume_grace"  // 断线后保留session等待重连的时间(秒,0不开启)
+	SettingKeyResumeBuffer = "resume_buffer" // 重连时可补发的消息缓存数量
+)
+
+// 重复登录策略(同一userId在本gate或其他gate上已有绑定的连接时)
+const (
+	DuplicateLoginAllow     = "allow"      // 允许多个连接同时在线
+	DuplicateLoginKickOld   = "kick_old"   // 踢掉旧连接
+	DuplicateLoginRejectNew = "reject_new" // 拒绝新连接的绑定
+)
+
+// 有序转发: 同一个key的客户端消息在模块(RegisterGO方法)中按接收顺序依次执行
+const (
+	OrderedDispatchSession = "session" // 按连接(sessionId)保证顺序
+	OrderedDispatchUser    = "user"    // 按用户(userId,未绑定时按sessionId)保证顺序
+)
+
+// 超出限流时的处理
+const (
+	RateLimitDrop       = "drop"       // 丢弃该包
+	RateLimitDelay      = "delay"      // 延迟处理(阻塞该连接的接收)
+	RateLimitDisconnect = "disconnect" // 断开连接
 )
 
+// RateLimit 接收限流(令牌桶,0表示不限制)
+type RateLimit struct {
+	PackRate  float64 `json:"pack_rate"`  // 每秒允许的包数
+	PackBurst int     `json:"pack_burst"` // 包数突发上限(默认同PackRate)
+	ByteRate  float64 `json:"byte_rate"`  // 每秒允许的字节数
+	ByteBurst int     `json:"byte_burst"` // 字节数突发上限(默认同ByteRate)
+}
+
+// Enabled 是否开启了限流
+func (r RateLimit) Enabled() bool { return r.PackRate > 0 || r.ByteRate > 0 }
+
 // Option 网关配置项
 type Option func(*Options)
 
@@ -29,16 +129,75 @@ type Option func(*Options)
 type Options struct {
 	WsAddr           string
 	TcpAddr          string
-	ConcurrentTasks  int // 单个连接允许的同时并发协程数,控制流量(20)(目前没用)
+	KcpAddr          string
+	QuicAddr         string
+	QuicPath         string
+	ConcurrentTasks  int // 单个连接同时等待模块返回的请求(PACK_FLAG_REQUEST)数上限,超出时按RateLimitAction处理(20)
 	BufSize          int // 连接数据缓存大小(2048)(只对TCP有用)
 	MaxPackSize      int // 单个协议包数据最大值(uint16:65535)
 	SendPackBuffSize int // 发送消息的缓冲队列(100)
 	TLS              bool
 	CertFile         string
 	KeyFile          string
-	EncryptKey       string // 消息包加密key(must 16, 24 or 32 bytes)
+	EncryptKey       string // 消息包加密key(must 16, 24 or 32 bytes)(已不推荐,请使用SecureCipher)
+	SecureCipher     string // 加密通道算法(secure.CipherAESGCM/secure.CipherChaCha20,空不开启): 连接时ECDH协商会话key,优先于EncryptKey;配置了EncryptKey时混入key派生以认证双方(否则不防主动中间人)
 	//OverTime        time.Duration // 建立连接超时(10s)
 	HeartOverTimer time.Duration // 心跳超时时间(本质是读取超时)(60s)
+	StickyModules  []string      // 需要按用户粘性路由的模块类型(一致性哈希分配节点)
+	DuplicateLogin string        // 重复登录策略(DuplicateLoginAllow)
+	ResumeGrace    time.Duration // 断线后保留session等待重连的时间(0不开启;开启后客户端连接后需先发送一个包,重连时为PACK_TOPIC_RESUME)
+	ResumeBuffer   int           // 重连时可补发的消息缓存数量(128)
+
+	// 空闲连接的心跳间隔(0不开启): 空闲超过间隔时gate发送ping,超过2个间隔仍未收到任何数据则断开;
+	// 同时按间隔调用已绑定用户的StorageHandler.Heartbeat
+	HeartbeatInterval time.Duration
+
+	// 接收限流(超出时按RateLimitAction处理)
+	RateLimit       RateLimit            // 单个连接的接收限流
+	TopicRateLimits map[string]RateLimit // 按topic(或模块类型)覆盖的接收限流,匹配到的包不再使用RateLimit
+	RateLimitAction string               // 超出限流时的处理(空为RateLimitDrop)
+	MaxConnPerIP    int                  // 单个IP允许的最大连接数(0不限制)
+	MaxConnNum      int                  // 单个监听允许的最大连接数(0时tcp/ws/quic不限制,kcp为10000)
+
+	TLSOptions network.TLSOptions // 开启TLS时的配置(未配置证书时使用CertFile/KeyFile)
+
+	// 负载均衡后获取客户端真实IP(ISession.GetIP)
+	ProxyProtocol  bool     // tcp/ws监听是否解析PROXY protocol(v1/v2)头
+	TrustedProxies []string // 可信代理(CIDR或IP): 只采信来自可信代理的PROXY头和ws的X-Forwarded-For/X-Real-IP;开启ProxyProtocol且为空时所有连接都必须带PROXY头
+
+	Codec IPackCodec // 数据包编解码(默认NewDefaultPackCodec)
+
+	// 压缩
+	Compression       string // 数据包压缩算法(CompressDeflate/CompressGzip/RegisterCompressor注册的,空不开启),客户端通过PACK_TOPIC_COMPRESS协商
+	CompressThreshold int    // body超过该字节数才压缩(默认1024),同时作用于WebSocket的permessage-deflate
+	WSCompression     bool   // WebSocket是否开启permessage-deflate(客户端支持时生效)
+
+	// WebSocket握手
+	WSAllowedOrigins  []string              // 允许的Origin(空不限制;支持"*"、"https://a.com"、"*.example.com")
+	WSSubprotocols    []string              // 支持的子协议(按优先顺序协商Sec-WebSocket-Protocol)
+	SubprotocolCodecs map[string]IPackCodec // 子协议对应的编解码(协商到的子协议未配置时使用Codec)
+	WSReadBufferSize  int                   // 读缓存大小(默认5120)
+	WSWriteBufferSize int                   // 写缓存大小(默认5120)
+
+	// 认证(为nil不开启): 认证成功后自动绑定userId,未认证的连接只能发送PublicTopics
+	Authenticator  IAuthenticator
+	AuthTokenParam string        // ws握手时携带token的url参数名(默认"token")
+	AuthTimeout    time.Duration // 验证token的超时时间(默认10秒)
+	PublicTopics   []string      // 未认证也可发送的topic(模块类型"login"/"login/*"表示整个模块,否则为完整topic)
+
+	TopicACL *TopicACL // topic访问控制(为nil不检查),拒绝的包回复PACK_TOPIC_ERROR
+
+	// 请求模式(PACK_FLAG_REQUEST)的包等待模块返回的超时时间(0使用app的RPCExpired,超过RPCExpired时模块可能已丢弃请求)
+	RequestTimeout time.Duration
+
+	// 有序转发(OrderedDispatchSession/OrderedDispatchUser,空不开启): 转发时携带顺序key,模块按key依次执行,不同key之间并行;
+	// 开启后该连接的包在单独的转发协程中依次转发(请求模式的包返回后才转发下一个包),不阻塞接收和心跳
+	OrderedDispatch string
+
+	// 发送(背压): 按topic优先级分为多个发送队列,高优先级先发送,各队列满时按各自的策略处理
+	SendQueue    SendQueueOptions
+	WriteTimeout time.Duration // 单次写入超时(30s,0不超时),超时断开连接
+	WriteBatch   int           // tcp/kcp连接一次合并写入(flush)的最大包数(16,<=1不合并)
 
 	Opts []server.Option // 用来控制module server属性的
 }
@@ -54,16 +213,43 @@ func NewOptions(opts ...Option) Options {
 		//OverTime:        time.Second * 10,
 		HeartOverTimer: time.Second * 60,
 		TLS:            false,
+		DuplicateLogin: DuplicateLoginAllow,
+		ResumeBuffer:   128,
+		WriteTimeout:   time.Second * 30,
+		WriteBatch:     16,
 	}
 
 	for _, o := range opts {
 		o(&opt)
 	}
+	if opt.Codec == nil {
+		opt.Codec = NewDefaultPackCodec()
+	}
+	if opt.AuthTokenParam == "" {
+		opt.AuthTokenParam = "token"
+	}
+	if opt.AuthTimeout <= 0 {
+		opt.AuthTimeout = 10 * time.Second
+	}
+	if opt.CompressThreshold <= 0 {
+		opt.CompressThreshold = 1024
+	}
 
 	return opt
 }
 
-// ConcurrentTasks 设置单个连接允许的同时并发协程数(目前没用)
+// Validate 检查配置(拼写错误的策略不会静默地退化为其他行为)
+func (o Options) Validate() error {
+	switch o.DuplicateLogin {
+	case "", DuplicateLoginAllow, DuplicateLoginKickOld, DuplicateLoginRejectNew:
+	default:
+		return fmt.Errorf("gate %s %q is not one of %s/%s/%s", SettingKeyDuplicateLogin, o.DuplicateLogin,
+			DuplicateLoginAllow, DuplicateLoginKickOld, DuplicateLoginRejectNew)
+	}
+	return nil
+}
+
+// ConcurrentTasks 设置单个连接同时等待模块返回的请求数上限(普通包由RateLimit限制)
 func ConcurrentTasks(s int) Option {
 	return func(o *Options) {
 		o.ConcurrentTasks = s
@@ -98,6 +284,13 @@ func HeartOverTimer(s time.Duration) Option {
 	}
 }
 
+// HeartbeatInterval 空闲连接的心跳间隔
+func HeartbeatInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.HeartbeatInterval = d
+	}
+}
+
 // OverTime 超时时间
 // func OverTime(s time.Duration) Option {
 // 	return func(o *Options) {
@@ -120,6 +313,34 @@ func TcpAddr(s string) Option {
 	}
 }
 
+// TCPAddr tcp监听地址
+func TCPAddr(s string) Option {
+	return func(o *Options) {
+		o.TcpAddr = s
+	}
+}
+
+// KCPAddr 可靠UDP监听地址
+func KCPAddr(s string) Option {
+	return func(o *Options) {
+		o.KcpAddr = s
+	}
+}
+
+// QUICAddr WebTransport(HTTP/3)监听地址
+func QUICAddr(s string) Option {
+	return func(o *Options) {
+		o.QuicAddr = s
+	}
+}
+
+// QUICPath WebTransport会话路径
+func QUICPath(s string) Option {
+	return func(o *Options) {
+		o.QuicPath = s
+	}
+}
+
 // WsAddr websocket监听端口
 func WsAddr(s string) Option {
 	return func(o *Options) {
@@ -141,6 +362,27 @@ func KeyFile(s string) Option {
 	}
 }
 
+// WithTLSOptions TLS高级配置
+func WithTLSOptions(o network.TLSOptions) Option {
+	return func(opts *Options) {
+		opts.TLSOptions = o
+	}
+}
+
+// ProxyProtocol tcp/ws监听是否解析PROXY protocol头
+func ProxyProtocol(enable bool) Option {
+	return func(o *Options) {
+		o.ProxyProtocol = enable
+	}
+}
+
+// TrustedProxies 添加可信代理(CIDR或IP)
+func TrustedProxies(cidrs ...string) Option {
+	return func(o *Options) {
+		o.TrustedProxies = append(o.TrustedProxies, cidrs...)
+	}
+}
+
 // 消息包加密Key
 func EncryptKey(s string) Option {
 	return func(o *Options) {
@@ -148,6 +390,218 @@ func EncryptKey(s string) Option {
 	}
 }
 
+// SecureCipher 加密通道算法
+func SecureCipher(s string) Option {
+	return func(o *Options) {
+		o.SecureCipher = s
+	}
+}
+
+// StickyModules 需要按用户粘性路由的模块类型
+func StickyModules(s ...string) Option {
+	return func(o *Options) {
+		o.StickyModules = append(o.StickyModules, s...)
+	}
+}
+
+// DuplicateLogin 重复登录策略
+func DuplicateLogin(policy string) Option {
+	return func(o *Options) {
+		o.DuplicateLogin = policy
+	}
+}
+
+// WithRateLimit 单个连接的接收限流
+func WithRateLimit(r RateLimit) Option {
+	return func(o *Options) {
+		o.RateLimit = r
+	}
+}
+
+// TopicRateLimit 按topic(或模块类型)覆盖的接收限流
+func TopicRateLimit(topic string, r RateLimit) Option {
+	return func(o *Options) {
+		if o.TopicRateLimits == nil {
+			o.TopicRateLimits = map[string]RateLimit{}
+		}
+		o.TopicRateLimits[topic] = r
+	}
+}
+
+// RateLimitAction 超出限流时的处理
+func RateLimitAction(action string) Option {
+	return func(o *Options) {
+		o.RateLimitAction = action
+	}
+}
+
+// MaxConnPerIP 单个IP允许的最大连接数
+func MaxConnPerIP(n int) Option {
+	return func(o *Options) {
+		o.MaxConnPerIP = n
+	}
+}
+
+// MaxConnNum 单个监听允许的最大连接数
+func MaxConnNum(n int) Option {
+	return func(o *Options) {
+		o.MaxConnNum = n
+	}
+}
+
+// ResumeGrace 断线后保留session等待重连的时间(0不开启)
+func ResumeGrace(d time.Duration) Option {
+	return func(o *Options) {
+		o.ResumeGrace = d
+	}
+}
+
+// ResumeBuffer 重连时可补发的消息缓存数量
+func ResumeBuffer(n int) Option {
+	return func(o *Options) {
+		o.ResumeBuffer = n
+	}
+}
+
+// PackCodec 数据包编解码
+func PackCodec(c IPackCodec) Option {
+	return func(o *Options) {
+		o.Codec = c
+	}
+}
+
+// Compression 数据包压缩算法
+func Compression(name string) Option {
+	return func(o *Options) {
+		o.Compression = name
+	}
+}
+
+// CompressThreshold body超过该字节数才压缩
+func CompressThreshold(n int) Option {
+	return func(o *Options) {
+		o.CompressThreshold = n
+	}
+}
+
+// WSCompression WebSocket是否开启permessage-deflate
+func WSCompression(enable bool) Option {
+	return func(o *Options) {
+		o.WSCompression = enable
+	}
+}
+
+// WSAllowedOrigins 添加允许的WebSocket Origin
+func WSAllowedOrigins(origins ...string) Option {
+	return func(o *Options) {
+		o.WSAllowedOrigins = append(o.WSAllowedOrigins, origins...)
+	}
+}
+
+// WSSubprotocols 添加支持的WebSocket子协议
+func WSSubprotocols(names ...string) Option {
+	return func(o *Options) {
+		o.WSSubprotocols = append(o.WSSubprotocols, names...)
+	}
+}
+
+// SubprotocolCodec 协商到子协议name时使用codec编解码(并添加到支持的子协议)
+func SubprotocolCodec(name string, codec IPackCodec) Option {
+	return func(o *Options) {
+		if o.SubprotocolCodecs == nil {
+			o.SubprotocolCodecs = map[string]IPackCodec{}
+		}
+		if _, ok := o.SubprotocolCodecs[name]; !ok {
+			o.WSSubprotocols = append(o.WSSubprotocols, name)
+		}
+		o.SubprotocolCodecs[name] = codec
+	}
+}
+
+// WSReadBufferSize WebSocket读缓存大小
+func WSReadBufferSize(n int) Option {
+	return func(o *Options) {
+		o.WSReadBufferSize = n
+	}
+}
+
+// WSWriteBufferSize WebSocket写缓存大小
+func WSWriteBufferSize(n int) Option {
+	return func(o *Options) {
+		o.WSWriteBufferSize = n
+	}
+}
+
+// Authenticator 客户端认证器
+func Authenticator(a IAuthenticator) Option {
+	return func(o *Options) {
+		o.Authenticator = a
+	}
+}
+
+// AuthTokenParam ws握手时携带token的url参数名
+func AuthTokenParam(name string) Option {
+	return func(o *Options) {
+		o.AuthTokenParam = name
+	}
+}
+
+// AuthTimeout 验证token的超时时间
+func AuthTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.AuthTimeout = d
+	}
+}
+
+// PublicTopics 添加未认证也可发送的topic(或模块类型)
+func PublicTopics(topics ...string) Option {
+	return func(o *Options) {
+		o.PublicTopics = append(o.PublicTopics, topics...)
+	}
+}
+
+// WithTopicACL topic访问控制
+func WithTopicACL(acl *TopicACL) Option {
+	return func(o *Options) {
+		o.TopicACL = acl
+	}
+}
+
+// RequestTimeout 请求模式的包等待模块返回的超时时间
+func RequestTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.RequestTimeout = d
+	}
+}
+
+// OrderedDispatch 有序转发(按session或user)
+func OrderedDispatch(mode string) Option {
+	return func(o *Options) {
+		o.OrderedDispatch = mode
+	}
+}
+
+// WithSendQueue 按topic优先级的发送队列配置
+func WithSendQueue(q SendQueueOptions) Option {
+	return func(o *Options) {
+		o.SendQueue = q
+	}
+}
+
+// WriteTimeout 单次写入超时
+func WriteTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.WriteTimeout = d
+	}
+}
+
+// WriteBatch tcp/kcp连接一次合并写入的最大包数
+func WriteBatch(n int) Option {
+	return func(o *Options) {
+		o.WriteBatch = n
+	}
+}
+
 // ServerOpts ServerOpts
 func ServerOpts(s []server.Option) Option {
 	return func(o *Options) {
@@ -0,0 +1,16 @@
+package gate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	for _, policy := range []string{"", DuplicateLoginAllow, DuplicateLoginKickOld, DuplicateLoginRejectNew} {
+		assert.NoError(t, NewOptions(DuplicateLogin(policy)).Validate(), policy)
+	}
+	for _, policy := range []string{"kick-old", "KICK_OLD", "reject"} {
+		assert.Error(t, NewOptions(DuplicateLogin(policy)).Validate(), policy)
+	}
+}
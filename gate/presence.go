@@ -0,0 +1,240 @@
+// Package gate 用户在线状态
+package gate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudapex/river/app"
+	"github.com/cloudapex/river/log"
+)
+
+// UserPresence 用户在某个gate上的一个在线连接
+type UserPresence struct {
+	UserId    string `json:"user_id" msgpack:"user_id"`
+	ServerId  string `json:"server_id" msgpack:"server_id"`   // gate server id
+	SessionId string `json:"session_id" msgpack:"session_id"` // gate session id
+	BindTime  int64  `json:"bind_time" msgpack:"bind_time"`   // 绑定时间(unix秒)
+}
+
+// IPresenceStore 在线状态存储(集群共享,如redis;同一用户可能有多个连接)
+type IPresenceStore interface {
+	// 添加用户的在线连接(相同ServerId+SessionId覆盖)
+	Add(p *UserPresence) error
+	// 原子地占用: 用户没有其他连接(ServerId+SessionId不同)时添加p,否则不添加并返回已有的其他连接(重复登录reject_new使用)
+	AddIfAbsent(p *UserPresence) (holders []*UserPresence, err error)
+	// 原子地替换: 添加p并删除用户的其他连接,返回被删除的连接(重复登录kick_old使用)
+	Replace(p *UserPresence) (replaced []*UserPresence, err error)
+	// 删除用户的在线连接
+	Remove(userId, serverId, sessionId string) error
+	// 删除某个gate上的所有在线连接(gate退出时清理)
+	RemoveServer(serverId string) error
+	// 查询用户的所有在线连接
+	Query(userId string) ([]*UserPresence, error)
+}
+
+var (
+	presenceLock sync.RWMutex
+	presence     IPresenceStore = NewMemoryPresenceStore()
+)
+
+// SetPresenceStore 设置在线状态存储(应在app启动前设置)
+// 默认的进程内存储只能看到本进程gate上的连接: 多进程(集群)部署时所有gate和业务模块必须设置同一份共享存储(如redis),
+// 否则IsOnline/SendToUser/KickUser和重复登录策略都看不到其他进程上的连接
+func SetPresenceStore(store IPresenceStore) {
+	presenceLock.Lock()
+	defer presenceLock.Unlock()
+	presence = store
+}
+
+// GetPresenceStore 获取在线状态存储
+func GetPresenceStore() IPresenceStore {
+	presenceLock.RLock()
+	defer presenceLock.RUnlock()
+	return presence
+}
+
+// IsMemoryPresenceStore 是否在使用进程内的在线状态存储(未设置共享存储)
+func IsMemoryPresenceStore() bool {
+	_, ok := GetPresenceStore().(*memoryPresenceStore)
+	return ok
+}
+
+// IsOnline 用户是否在线
+func IsOnline(userId string) (bool, error) {
+	list, err := GetPresenceStore().Query(userId)
+	if err != nil {
+		return false, err
+	}
+	return len(list) > 0, nil
+}
+
+// SendToUser 发送消息给用户的所有在线连接(返回发送成功的连接数)
+func SendToUser(userId string, topic string, body []byte) (int, error) {
+	list, err := GetPresenceStore().Query(userId)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, p := range list {
+		server, err := presenceServer(p)
+		if err != nil {
+			log.Warning("SendToUser userId:%v err:%v", userId, err)
+			continue
+		}
+		if _, err := server.GetRPC().Call(context.TODO(), "Send", p.SessionId, topic, body); err != nil {
+			log.Warning("SendToUser userId:%v serverId:%v sessionId:%v err:%v", userId, p.ServerId, p.SessionId, err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// KickUser 关闭用户的所有在线连接
+func KickUser(userId string) error {
+	list, err := GetPresenceStore().Query(userId)
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		server, err := presenceServer(p)
+		if err != nil {
+			continue
+		}
+		if _, err := server.GetRPC().Call(context.TODO(), "Close", p.SessionId); err != nil {
+			log.Warning("KickUser userId:%v serverId:%v sessionId:%v err:%v", userId, p.ServerId, p.SessionId, err)
+		}
+		// 连接已关闭或已不存在,都不再是在线状态
+		_ = GetPresenceStore().Remove(p.UserId, p.ServerId, p.SessionId)
+	}
+	return nil
+}
+
+// presenceServer 获取在线连接所在的gate(gate已不存在时清理掉该记录)
+func presenceServer(p *UserPresence) (app.IModuleServerSession, error) {
+	if app.App() == nil {
+		return nil, fmt.Errorf("app.App is nil")
+	}
+	server, err := app.App().GetServerByID(p.ServerId)
+	if err != nil {
+		_ = GetPresenceStore().Remove(p.UserId, p.ServerId, p.SessionId)
+		return nil, fmt.Errorf("Gate not found serverId(%s), err:%v", p.ServerId, err)
+	}
+	return server, nil
+}
+
+// NewMemoryPresenceStore 进程内的在线状态存储(单进程部署或测试使用,保存的是记录的副本)
+func NewMemoryPresenceStore() IPresenceStore {
+	return &memoryPresenceStore{users: map[string][]*UserPresence{}}
+}
+
+type memoryPresenceStore struct {
+	lock  sync.RWMutex
+	users map[string][]*UserPresence
+}
+
+func (m *memoryPresenceStore) Add(p *UserPresence) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.add(p)
+	return nil
+}
+
+func (m *memoryPresenceStore) AddIfAbsent(p *UserPresence) ([]*UserPresence, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if holders := m.others(p); len(holders) > 0 {
+		return holders, nil
+	}
+	m.add(p)
+	return nil, nil
+}
+
+func (m *memoryPresenceStore) Replace(p *UserPresence) ([]*UserPresence, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	replaced := m.others(p)
+	delete(m.users, p.UserId)
+	m.add(p)
+	return replaced, nil
+}
+
+// others 用户除p以外的连接(副本)
+func (m *memoryPresenceStore) others(p *UserPresence) []*UserPresence {
+	var list []*UserPresence
+	for _, old := range m.users[p.UserId] {
+		if old.ServerId != p.ServerId || old.SessionId != p.SessionId {
+			c := *old
+			list = append(list, &c)
+		}
+	}
+	return list
+}
+
+// add 保存p的副本(相同ServerId+SessionId覆盖)
+func (m *memoryPresenceStore) add(p *UserPresence) {
+	c := *p
+	if c.BindTime == 0 {
+		c.BindTime = time.Now().Unix()
+	}
+	p = &c
+	list := m.users[p.UserId]
+	for i, old := range list {
+		if old.ServerId == p.ServerId && old.SessionId == p.SessionId {
+			list[i] = p
+			return
+		}
+	}
+	m.users[p.UserId] = append(list, p)
+}
+
+func (m *memoryPresenceStore) Remove(userId, serverId, sessionId string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	list := m.users[userId]
+	for i, old := range list {
+		if old.ServerId == serverId && old.SessionId == sessionId {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(m.users, userId)
+	} else {
+		m.users[userId] = list
+	}
+	return nil
+}
+
+func (m *memoryPresenceStore) RemoveServer(serverId string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for userId, list := range m.users {
+		keep := list[:0:0]
+		for _, old := range list {
+			if old.ServerId != serverId {
+				keep = append(keep, old)
+			}
+		}
+		if len(keep) == 0 {
+			delete(m.users, userId)
+		} else {
+			m.users[userId] = keep
+		}
+	}
+	return nil
+}
+
+func (m *memoryPresenceStore) Query(userId string) ([]*UserPresence, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	list := make([]*UserPresence, 0, len(m.users[userId]))
+	for _, p := range m.users[userId] {
+		c := *p
+		list = append(list, &c)
+	}
+	return list, nil
+}
@@ -0,0 +1,121 @@
+package gate
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPresenceStore(t *testing.T) {
+	store := NewMemoryPresenceStore()
+	p := &UserPresence{UserId: "u1", ServerId: "gate@1", SessionId: "s1"}
+	assert.NoError(t, store.Add(p))
+	assert.NoError(t, store.Add(&UserPresence{UserId: "u1", ServerId: "gate@2", SessionId: "s2"}))
+	assert.NoError(t, store.Add(&UserPresence{UserId: "u2", ServerId: "gate@1", SessionId: "s3"}))
+	assert.NoError(t, store.Add(&UserPresence{UserId: "u1", ServerId: "gate@1", SessionId: "s1", BindTime: 7})) // 覆盖
+
+	list, err := store.Query("u1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, int64(7), list[0].BindTime)
+	// 返回和保存的都是副本
+	list[0].SessionId = "changed"
+	p.SessionId = "changed"
+	list, _ = store.Query("u1")
+	assert.Equal(t, "s1", list[0].SessionId)
+
+	assert.NoError(t, store.Remove("u1", "gate@2", "s2"))
+	assert.NoError(t, store.Remove("u1", "gate@2", "s2")) // 不存在时忽略
+	list, _ = store.Query("u1")
+	assert.Len(t, list, 1)
+
+	assert.NoError(t, store.RemoveServer("gate@1"))
+	for _, userId := range []string{"u1", "u2"} {
+		list, _ = store.Query(userId)
+		assert.Empty(t, list, userId)
+	}
+}
+
+func TestMemoryPresenceStoreReserve(t *testing.T) {
+	store := NewMemoryPresenceStore()
+	p1 := &UserPresence{UserId: "u1", ServerId: "gate@1", SessionId: "s1"}
+	holders, err := store.AddIfAbsent(p1)
+	assert.NoError(t, err)
+	assert.Empty(t, holders)
+	holders, err = store.AddIfAbsent(p1) // 同一个连接再次占用
+	assert.NoError(t, err)
+	assert.Empty(t, holders)
+
+	holders, err = store.AddIfAbsent(&UserPresence{UserId: "u1", ServerId: "gate@2", SessionId: "s2"})
+	assert.NoError(t, err)
+	if assert.Len(t, holders, 1) {
+		assert.Equal(t, "s1", holders[0].SessionId)
+	}
+	list, _ := store.Query("u1")
+	assert.Len(t, list, 1)
+
+	assert.NoError(t, store.Add(&UserPresence{UserId: "u1", ServerId: "gate@1", SessionId: "s3"}))
+	replaced, err := store.Replace(&UserPresence{UserId: "u1", ServerId: "gate@2", SessionId: "s2"})
+	assert.NoError(t, err)
+	assert.Len(t, replaced, 2)
+	list, _ = store.Query("u1")
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "s2", list[0].SessionId)
+	}
+}
+
+func TestMemoryPresenceStoreReserveConcurrent(t *testing.T) {
+	store := NewMemoryPresenceStore()
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	won := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			holders, err := store.AddIfAbsent(&UserPresence{UserId: "u1", ServerId: "gate@1", SessionId: fmt.Sprint("s", i)})
+			assert.NoError(t, err)
+			if len(holders) == 0 {
+				lock.Lock()
+				won++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, won)
+	list, _ := store.Query("u1")
+	assert.Len(t, list, 1)
+}
+
+func TestPresenceStoreSwap(t *testing.T) {
+	assert.True(t, IsMemoryPresenceStore())
+	origin := GetPresenceStore()
+	defer SetPresenceStore(origin)
+
+	// 并发设置和使用(go test -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetPresenceStore(NewMemoryPresenceStore())
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = IsOnline("u1")
+		}()
+	}
+	wg.Wait()
+
+	store := NewMemoryPresenceStore()
+	SetPresenceStore(store)
+	assert.NoError(t, store.Add(&UserPresence{UserId: "u1", ServerId: "gate@1", SessionId: "s1"}))
+	online, err := IsOnline("u1")
+	assert.NoError(t, err)
+	assert.True(t, online)
+	online, _ = IsOnline("u2")
+	assert.False(t, online)
+}
@@ -0,0 +1,101 @@
+// Package gate 发送队列(背压)配置
+package gate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// 发送优先级: 每个优先级一个发送队列,发送时高优先级的队列先发送完
+const (
+	SendPriorityHigh   = "high"   // 关键消息(gate的控制包固定为high)
+	SendPriorityNormal = "normal" // 默认
+	SendPriorityLow    = "low"    // 可延迟/丢弃的消息(如观战广播)
+)
+
+// 发送队列满(客户端接收慢)时的处理策略
+const (
+	SendPolicyDropNewest = "drop_newest" // 丢弃新消息,SendPack返回错误(默认)
+	SendPolicyDropOldest = "drop_oldest" // 丢弃队列中最早的消息
+	SendPolicyCoalesce   = "coalesce"    // 队列中已有同一topic的消息时替换为新消息(不论是否已满),没有时丢弃最早的消息
+	SendPolicyDisconnect = "disconnect"  // 断开连接(慢客户端)
+)
+
+// SendLane 一个优先级的发送队列配置
+type SendLane struct {
+	Size   int    `json:"size"`   // 队列长度(默认Options.SendPackBuffSize)
+	Policy string `json:"policy"` // 队列满时的处理策略(SendPolicyXxx,默认SendPolicyDropNewest)
+}
+
+// SendQueueOptions 发送队列配置
+type SendQueueOptions struct {
+	Topics map[string]string   `json:"topics"` // topic的优先级: 完整topic、模块类型("chat"或"chat/*")或"*" -> SendPriorityXxx(默认normal)
+	Lanes  map[string]SendLane `json:"lanes"`  // 各优先级的队列配置
+}
+
+// ParseSendQueueOptions 解析settings中的发送队列配置(json对象)
+func ParseSendQueueOptions(v any) (SendQueueOptions, error) {
+	o := SendQueueOptions{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return o, err
+	}
+	if err = json.Unmarshal(data, &o); err != nil {
+		return o, err
+	}
+	return o, o.Validate()
+}
+
+// Validate 检查优先级和策略名称
+func (o SendQueueOptions) Validate() error {
+	for topic, priority := range o.Topics {
+		if !validSendPriority(priority) {
+			return fmt.Errorf("send priority %q of topic %s not supported", priority, topic)
+		}
+	}
+	for priority, lane := range o.Lanes {
+		if !validSendPriority(priority) {
+			return fmt.Errorf("send priority %q not supported", priority)
+		}
+		switch lane.Policy {
+		case "", SendPolicyDropNewest, SendPolicyDropOldest, SendPolicyCoalesce, SendPolicyDisconnect:
+		default:
+			return fmt.Errorf("send policy %q not supported", lane.Policy)
+		}
+	}
+	return nil
+}
+
+// Priority topic的发送优先级(完整topic > 模块类型 > "*")
+func (o SendQueueOptions) Priority(topic string) string {
+	if p, ok := o.Topics[topic]; ok {
+		return p
+	}
+	moduleTyp := topicModule(topic)
+	if p, ok := o.Topics[moduleTyp]; ok {
+		return p
+	}
+	if p, ok := o.Topics[moduleTyp+"/*"]; ok {
+		return p
+	}
+	if p, ok := o.Topics["*"]; ok {
+		return p
+	}
+	return SendPriorityNormal
+}
+
+// Lane 优先级的队列配置(未配置的使用默认值)
+func (o SendQueueOptions) Lane(priority string, defSize int) SendLane {
+	lane := o.Lanes[priority]
+	if lane.Size <= 0 {
+		lane.Size = defSize
+	}
+	if lane.Policy == "" {
+		lane.Policy = SendPolicyDropNewest
+	}
+	return lane
+}
+
+func validSendPriority(p string) bool {
+	return p == SendPriorityHigh || p == SendPriorityNormal || p == SendPriorityLow
+}
@@ -0,0 +1,14 @@
+// Package gate 网关运行统计
+package gate
+
+// Stats 网关运行统计(快照)
+type Stats struct {
+	Agents    int              // 在线连接数
+	ACLDenied map[string]int64 // 被访问控制拒绝的包数(按topic)
+
+	// 发送队列(按优先级)
+	SendQueued      map[string]int64 // 当前等待发送的包数(所有连接)
+	SendDropped     map[string]int64 // 队列满时被丢弃或合并掉的包数
+	SendQueuePeak   int64            // 单个连接发送队列(所有优先级)出现过的最大深度
+	SlowDisconnects int64            // 因发送队列满被断开的连接数
+}
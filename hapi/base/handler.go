@@ -1,22 +1,43 @@
 package hapibase
 
 import (
+	"crypto/cipher"
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/cloudapex/river/hapi"
+	"github.com/cloudapex/river/log"
 	"github.com/cloudapex/river/tools/aes"
+	"github.com/cloudapex/river/tools/secure"
 )
 
+// 加密消息允许的时间偏差(防重放窗口)
+const replayWindow = 5 * time.Minute
+
 // NewHandler 创建常规http handler
 func NewHandler(opts hapi.Options) *HttpHandler {
-	return &HttpHandler{Opts: opts}
+	h := &HttpHandler{Opts: opts}
+	if opts.Cipher != "" && opts.EncryptKey != "" {
+		key, err := secure.DeriveKey([]byte(opts.EncryptKey), "river hapi")
+		if err == nil {
+			h.aead, err = secure.NewAEAD(opts.Cipher, key)
+		}
+		if err != nil {
+			log.Error("hapi cipher(%s) init err:%v", opts.Cipher, err)
+		}
+		h.replay = secure.NewReplayFilter(replayWindow, 0)
+	}
+	return h
 }
 
 // HttpHandler 网关handler
 type HttpHandler struct {
 	Opts hapi.Options
+
+	aead   cipher.AEAD          // 开启Cipher时的AEAD
+	replay *secure.ReplayFilter // 开启Cipher时的防重放
 }
 
 // API handler is the default handler which takes api.Request and returns api.Response
@@ -93,10 +114,14 @@ func (h *HttpHandler) decryptRequest(req *hapi.Request) error {
 		debugKey = pair.Values[0]
 	}
 
-	if h.Opts.EncryptKey == "" || debugKey == h.Opts.DebugKey {
+	if h.Opts.EncryptKey == "" || (h.Opts.DebugKey != "" && debugKey == h.Opts.DebugKey) {
 		return nil
 	}
 
+	if h.Opts.Cipher != "" {
+		return h.openRequest(req)
+	}
+
 	// 解密 Body 字段
 	if req.Body != "" {
 		// 先进行 base64 解码
@@ -122,10 +147,14 @@ func (h *HttpHandler) encryptResponse(req *hapi.Request, rsp *hapi.Response) err
 		debugKey = pair.Values[0]
 	}
 
-	if h.Opts.EncryptKey == "" || debugKey == h.Opts.DebugKey {
+	if h.Opts.EncryptKey == "" || (h.Opts.DebugKey != "" && debugKey == h.Opts.DebugKey) {
 		return nil
 	}
 
+	if h.Opts.Cipher != "" {
+		return h.sealResponse(rsp)
+	}
+
 	// 加密 Body 字段
 	if rsp.Body != "" {
 		kl := len(h.Opts.EncryptKey)
@@ -138,3 +167,38 @@ func (h *HttpHandler) encryptResponse(req *hapi.Request, rsp *hapi.Response) err
 
 	return nil
 }
+
+// openRequest AEAD解密请求(Body为二进制密文,不再base64)
+func (h *HttpHandler) openRequest(req *hapi.Request) error {
+	if h.aead == nil {
+		return fmt.Errorf("cipher %s not available", h.Opts.Cipher)
+	}
+	if req.Body == "" {
+		return nil
+	}
+	plain, nonce, ts, err := secure.OpenMessage(h.aead, []byte(req.Body))
+	if err != nil {
+		return fmt.Errorf("decrypt request body failed: %v", err)
+	}
+	if err := h.replay.Check(nonce, ts); err != nil {
+		return err
+	}
+	req.Body = string(plain)
+	return nil
+}
+
+// sealResponse AEAD加密应答
+func (h *HttpHandler) sealResponse(rsp *hapi.Response) error {
+	if h.aead == nil {
+		return fmt.Errorf("cipher %s not available", h.Opts.Cipher)
+	}
+	if rsp.Body == "" {
+		return nil
+	}
+	data, err := secure.SealMessage(h.aead, []byte(rsp.Body))
+	if err != nil {
+		return fmt.Errorf("encrypt response body failed: %v", err)
+	}
+	rsp.Body = string(data)
+	return nil
+}
@@ -0,0 +1,41 @@
+package hapibase
+
+import (
+	"testing"
+
+	"github.com/cloudapex/river/hapi"
+	"github.com/cloudapex/river/tools/secure"
+)
+
+func TestHandlerCipher(t *testing.T) {
+	h := NewHandler(hapi.NewOptions(hapi.EncryptKey("0123456789abcdef"), hapi.Cipher(secure.CipherChaCha20)))
+
+	data, err := secure.SealMessage(h.aead, []byte(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &hapi.Request{Body: string(data)}
+	if err := h.decryptRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Body != `{"a":1}` {
+		t.Fatalf("Expected body %s got %s", `{"a":1}`, req.Body)
+	}
+
+	// 重放的请求被拒绝
+	if err := h.decryptRequest(&hapi.Request{Body: string(data)}); err == nil {
+		t.Fatal("Expected replay error")
+	}
+
+	rsp := &hapi.Response{Body: "ok"}
+	if err := h.encryptResponse(req, rsp); err != nil {
+		t.Fatal(err)
+	}
+	plain, _, _, err := secure.OpenMessage(h.aead, []byte(rsp.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "ok" {
+		t.Fatalf("Expected body ok got %s", plain)
+	}
+}
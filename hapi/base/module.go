@@ -2,6 +2,7 @@ package hapibase
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/cloudapex/river/hapi"
 	"github.com/cloudapex/river/log"
 	"github.com/cloudapex/river/module"
+	"github.com/cloudapex/river/network"
 	"github.com/gin-gonic/gin"
 )
 
@@ -37,6 +39,12 @@ func (this *HApiBase) Init(subclass app.IRPCModule, settings *conf.ModuleSetting
 			opts = append(opts, hapi.CertFile(v.(string)))
 		case hapi.SettingKeyKeyFile:
 			opts = append(opts, hapi.KeyFile(v.(string)))
+		case hapi.SettingKeyTLSOptions:
+			tlsOpts, err := network.ParseTLSOptions(v)
+			if err != nil {
+				panic(fmt.Sprintf("hapi setting %s err:%v", k, err))
+			}
+			opts = append(opts, hapi.WithTLSOptions(tlsOpts))
 		case hapi.SettingKeyReadTimeout:
 			opts = append(opts, hapi.ReadTimeout(time.Duration(v.(int))))
 		case hapi.SettingKeyWriteTimeout:
@@ -49,9 +57,14 @@ func (this *HApiBase) Init(subclass app.IRPCModule, settings *conf.ModuleSetting
 			opts = append(opts, hapi.DebugKey(v.(string)))
 		case hapi.SettingKeyEncryptKey:
 			opts = append(opts, hapi.EncryptKey(v.(string)))
+		case hapi.SettingKeyCipher:
+			opts = append(opts, hapi.Cipher(v.(string)))
 		}
 	}
 	this.opts = hapi.NewOptions(opts...)
+	if err := this.opts.Validate(); err != nil {
+		panic(fmt.Sprintf("hapi setting err:%v", err))
+	}
 
 	// 创建路由
 	gin.SetMode(gin.ReleaseMode)
@@ -109,12 +122,21 @@ func (this *HApiBase) startHttpServer() *http.Server {
 		MaxHeaderBytes: this.opts.MaxHeaderBytes,
 	}
 
+	if this.opts.TLS {
+		tlsConf, err := network.NewTLSConfig(this.opts.TLSOptions.WithDefaultCert(this.opts.CertFile, this.opts.KeyFile))
+		if err != nil { // 不能退化为明文
+			log.Error("hapi tls :%v", err)
+			panic(fmt.Sprintf("HApiBase.startHttpServer.TLS err:%v", err))
+		}
+		srv.TLSConfig = tlsConf
+	}
+
 	go func() {
 		var err error
 		if this.opts.TLS {
-			// TLS配置存在，使用HTTPS
+			// TLS配置存在，使用HTTPS(证书由TLSConfig提供)
 			log.Info("Starting HTTPS server on %s with cert %s and key %s", this.opts.Addr, this.opts.CertFile, this.opts.KeyFile)
-			err = srv.ListenAndServeTLS(this.opts.CertFile, this.opts.KeyFile)
+			err = srv.ListenAndServeTLS("", "")
 		} else {
 			// 没有TLS配置，使用HTTP
 			log.Info("Starting HTTP server on %s", this.opts.Addr)
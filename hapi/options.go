@@ -1,9 +1,12 @@
 package hapi
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/cloudapex/river/module/server"
+	"github.com/cloudapex/river/network"
+	"github.com/cloudapex/river/tools/secure"
 )
 
 // 配置Setting键常量定义
@@ -16,6 +19,9 @@ const (
 	SettingKeyCertFile = "tls_cert_file" // 证书文件路径
 	SettingKeyKeyFile  = "tls_key_file"  // 私钥文件路径
 
+	// TLS高级配置(network.TLSOptions的json对象: 最低版本/加密套件/双向认证/SNI多证书/证书热更新)
+	SettingKeyTLSOptions = "tls_options"
+
 	SettingKeyReadTimeout    = "read_timeout"     // 读取超时（秒）
 	SettingKeyWriteTimeout   = "write_timeout"    // 写入超时（秒）
 	SettingKeyIdleTimeout    = "idle_timeout"     // 空闲超时（秒）
@@ -24,6 +30,7 @@ const (
 	// 安全配置
 	SettingKeyDebugKey   = "debug_key"   // 调试密钥
 	SettingKeyEncryptKey = "encrypt_key" // 加密密钥
+	SettingKeyCipher     = "cipher"      // 加密算法(aes-gcm/chacha20-poly1305,空为aes-cbc)
 )
 
 // Option 配置
@@ -43,6 +50,9 @@ type Options struct {
 	MaxHeaderBytes int
 	DebugKey       string // 调试用(可不用加密调试)(Settings["DebugKey"])
 	EncryptKey     string // 消息包加密key(Settings["EncryptKey"])(must 16, 24 or 32 bytes)
+	Cipher         string // 加密算法(secure.CipherAESGCM/secure.CipherChaCha20): 由EncryptKey派生key,每条消息随机nonce并防重放(空为旧的aes-cbc)
+
+	TLSOptions network.TLSOptions // 开启TLS时的配置(未配置证书时使用CertFile/KeyFile)
 
 	Opts []server.Option // 用来控制Module属性的
 }
@@ -116,6 +126,13 @@ func KeyFile(keyFile string) Option {
 	}
 }
 
+// WithTLSOptions 设置TLS高级配置
+func WithTLSOptions(o network.TLSOptions) Option {
+	return func(opts *Options) {
+		opts.TLSOptions = o
+	}
+}
+
 // ReadTimeout 设置读取超时
 func ReadTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
@@ -157,3 +174,22 @@ func EncryptKey(key string) Option {
 		o.EncryptKey = key
 	}
 }
+
+// Cipher 设置加密算法
+func Cipher(name string) Option {
+	return func(o *Options) {
+		o.Cipher = name
+	}
+}
+
+// Validate 检查加密配置(Cipher必须配置EncryptKey,否则会静默地不加密)
+func (o Options) Validate() error {
+	if o.Cipher == "" {
+		return nil
+	}
+	if o.EncryptKey == "" {
+		return fmt.Errorf("hapi %s %s requires %s", SettingKeyCipher, o.Cipher, SettingKeyEncryptKey)
+	}
+	_, err := secure.NewAEAD(o.Cipher, make([]byte, secure.KeySize))
+	return err
+}
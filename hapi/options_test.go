@@ -0,0 +1,24 @@
+package hapi
+
+import (
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testData := []struct {
+		opts  Options
+		valid bool
+	}{
+		{NewOptions(), true},
+		{NewOptions(EncryptKey("0123456789abcdef")), true},
+		{NewOptions(EncryptKey("0123456789abcdef"), Cipher("aes-gcm")), true},
+		{NewOptions(Cipher("aes-gcm")), false}, // 没有EncryptKey时不能静默地不加密
+		{NewOptions(EncryptKey("0123456789abcdef"), Cipher("rc4")), false},
+	}
+
+	for _, d := range testData {
+		if err := d.opts.Validate(); (err == nil) != d.valid {
+			t.Fatalf("Expected valid %v for cipher %q key %q got %v", d.valid, d.opts.Cipher, d.opts.EncryptKey, err)
+		}
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"github.com/cloudapex/river/tools"
 )
 
+var _ app.IActorModule = &ModuleBase{}
+
 // ModuleBase 默认的RPCModule实现
 type ModuleBase struct {
 	//context.Context
@@ -155,6 +157,11 @@ func (this *ModuleBase) SetListener(listener mqrpc.IRPCListener) {
 	this.listener = listener
 }
 
+// AddInterceptor 添加本模块的RPC服务方拦截器(在app级拦截器之后执行)
+func (this *ModuleBase) AddInterceptor(interceptors ...mqrpc.ServerInterceptor) {
+	this.GetServer().AddInterceptor(interceptors...)
+}
+
 // OnConfChanged 当配置变更时调用(目前没用)
 func (this *ModuleBase) OnConfChanged(settings *conf.ModuleSettings) {}
 
@@ -180,6 +187,25 @@ func (this *ModuleBase) RegisterGO(msg string, f interface{}) {
 	this.GetServer().RegisterGO(msg, f)
 }
 
+// RegisterActor 注册rpc消息(actor: 同一actor key的消息依次执行,不同key并行)
+func (this *ModuleBase) RegisterActor(msg string, f interface{}) {
+	this.actorServer().RegisterActor(msg, f)
+}
+
+// SetActorOptions 设置actor的key、邮箱大小、空闲回收时间和生命周期回调(在RegisterActor之前调用)
+func (this *ModuleBase) SetActorOptions(opts mqrpc.ActorOptions) {
+	this.actorServer().SetActorOptions(opts)
+}
+
+// actorServer Server需要实现server.ActorServer
+func (this *ModuleBase) actorServer() server.ActorServer {
+	s, ok := this.GetServer().(server.ActorServer)
+	if !ok {
+		panic(fmt.Sprintf("server %T does not support actor", this.GetServer()))
+	}
+	return s
+}
+
 // GetRouteServer 获取服务实例(通过服务ID|服务类型,可设置选择器过滤)
 func (this *ModuleBase) GetRouteServer(service string, opts ...selector.SelectOption) (s app.IModuleServerSession, err error) {
 	return app.App().GetRouteServer(service, opts...)
@@ -21,6 +21,7 @@ type Server interface {
 	Register(id string, f any)   // 注册RPC方法
 	RegisterGO(id string, f any) // 注册RPC方法
 	SetListener(listener mqrpc.IRPCListener)
+	AddInterceptor(interceptors ...mqrpc.ServerInterceptor)
 	ServiceRegister() error   // 向Registry注册自己
 	ServiceDeregister() error // 向Registry注销自己
 
@@ -30,6 +31,12 @@ type Server interface {
 	String() string
 }
 
+// ActorServer 支持actor执行方式的Server(可选实现,通过类型断言使用)
+type ActorServer interface {
+	RegisterActor(id string, f any)
+	SetActorOptions(opts mqrpc.ActorOptions)
+}
+
 // Message RPC消息头
 type Message interface {
 	Topic() string
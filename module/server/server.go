@@ -23,6 +23,8 @@ func newServer(opts ...Option) Server {
 	}
 }
 
+var _ ActorServer = &server{}
+
 type server struct {
 	exit chan chan error
 
@@ -66,6 +68,9 @@ func (s *server) OnDestroy() error {
 	return s.Stop()
 }
 func (s *server) SetListener(listener mqrpc.IRPCListener) { s.server.SetListener(listener) }
+func (s *server) AddInterceptor(interceptors ...mqrpc.ServerInterceptor) {
+	s.server.AddInterceptor(interceptors...)
+}
 
 func (s *server) Register(id string, f any) {
 	if s.server == nil {
@@ -81,6 +86,26 @@ func (s *server) RegisterGO(id string, f any) {
 	s.server.RegisterGO(id, f)
 }
 
+func (s *server) RegisterActor(id string, f any) {
+	s.actorServer().RegisterActor(id, f)
+}
+
+func (s *server) SetActorOptions(opts mqrpc.ActorOptions) {
+	s.actorServer().SetActorOptions(opts)
+}
+
+// actorServer RPCServer需要实现mqrpc.IActorServer
+func (s *server) actorServer() mqrpc.IActorServer {
+	if s.server == nil {
+		panic("invalid RPCServer")
+	}
+	as, ok := s.server.(mqrpc.IActorServer)
+	if !ok {
+		panic(fmt.Sprintf("RPCServer %T does not support actor", s.server))
+	}
+	return as
+}
+
 // ServiceRegister 向Registry注册自己
 func (s *server) ServiceRegister() error {
 	// parse address for host, port
@@ -0,0 +1,39 @@
+package mqrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrActorKeyNotFound = errors.New("mqrpc: actor key not found")
+	ErrActorMailboxFull = errors.New("mqrpc: actor mailbox full")
+	ErrActorStopped     = errors.New("mqrpc: actor system stopped")
+)
+
+// ActorOptions actor执行方式(RegisterActor)的配置
+// 每个key(如userId、roomId)对应一个actor: 同一key的消息在actor的协程中按到达顺序依次执行,不同key并行,
+// 同一个模块中所有RegisterActor注册的方法共享这些actor
+type ActorOptions struct {
+	Key         func(ctx context.Context) string // 从ctx中获取actor key(默认为调用方ContextWithOrderKey设置的key)
+	MailboxSize int                              // 每个actor的邮箱大小(默认1024,满时拒绝新消息)
+	IdleTimeout time.Duration                    // actor空闲多久后回收(默认1分钟)
+	OnStart     func(key string)                 // actor创建时调用(在actor协程中,先于第一条消息执行)
+	OnStop      func(key string)                 // actor回收或服务关闭时调用(在actor协程中,之后不再有该actor的消息)
+}
+
+// ActorKeyValue 使用ctx中的值(ContextWithValue设置)作为actor key
+func ActorKeyValue(name string) func(ctx context.Context) string {
+	return func(ctx context.Context) string {
+		v := ctx.Value(name)
+		if v == nil {
+			return ""
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	}
+}
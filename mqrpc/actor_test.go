@@ -0,0 +1,22 @@
+package mqrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActorKeyValue(t *testing.T) {
+	key := ActorKeyValue("roomId")
+	assert.Equal(t, "", key(context.TODO()))
+	assert.Equal(t, "r1", key(ContextWithValue(context.TODO(), "roomId", "r1")))
+	assert.Equal(t, "1001", key(ContextWithValue(context.TODO(), "roomId", 1001)))
+
+	// 经过RPC传输后的ctx
+	argType, data, err := ArgToData(ContextWithValue(context.TODO(), "roomId", "r2"))
+	assert.NoError(t, err)
+	ctx, err := DataToArg(argType, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "r2", key(ctx.(context.Context)))
+}
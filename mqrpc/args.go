@@ -21,21 +21,24 @@ import (
 
 	"github.com/cloudapex/river/tools"
 	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
-	NULL    = "null"    // nil null
-	BOOL    = "bool"    // bool
-	INT     = "int"     // int
-	LONG    = "long"    // int64
-	FLOAT   = "float"   // float32
-	DOUBLE  = "double"  // float64
-	BYTES   = "bytes"   // []byte
-	STRING  = "string"  // string
-	JSMAP   = "map"     // map[string]any
-	CONTEXT = "context" // context
-	MARSHAL = "marshal" // mqrpc.Marshaler
-	MSGPACK = "msgpack" // msgpack
+	NULL     = "null"     // nil null
+	BOOL     = "bool"     // bool
+	INT      = "int"      // int
+	LONG     = "long"     // int64
+	FLOAT    = "float"    // float32
+	DOUBLE   = "double"   // float64
+	BYTES    = "bytes"    // []byte
+	STRING   = "string"   // string
+	JSMAP    = "map"      // map[string]any
+	CONTEXT  = "context"  // context
+	MARSHAL  = "marshal"  // mqrpc.Marshaler
+	MSGPACK  = "msgpack"  // msgpack
+	PROTOBUF = "protobuf" // proto.Message
+	JSON     = "json"     // json(通过NewJSONSerialize注册)
 )
 
 func ArgToData(arg any) (string, []byte, error) {
@@ -84,20 +87,25 @@ func ArgToData(arg any) (string, []byte, error) {
 		bytes, err := tools.MapToBytes(maps)
 		return CONTEXT, bytes, err
 	default:
+		// 0 自定义序列化器(RegSerialize)
+		if ptype, b, ok, err := serializeArg(arg); ok {
+			if err != nil {
+				return "", nil, fmt.Errorf("args [%s] serialize error %v", reflect.TypeOf(arg), err)
+			}
+			return ptype, b, nil
+		}
 
-		// 下面必须是struct
 		rv := reflect.ValueOf(arg)
-		if rv.Kind() != reflect.Ptr {
-			return "", nil, fmt.Errorf("ArgToData [%v] not pointer type", reflect.TypeOf(arg))
-		}
-		if rv.IsNil() { //如果是nil则直接返回
-			return NULL, nil, nil
-		}
-		if rv.Elem().Kind() != reflect.Struct {
-			return "", nil, fmt.Errorf("ArgToData [%v] not struct type", reflect.TypeOf(arg))
+		switch rv.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			if rv.IsNil() { //如果是nil则直接返回
+				return NULL, nil, nil
+			}
+		case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+			return "", nil, fmt.Errorf("ArgToData [%v] unsupported type", reflect.TypeOf(arg))
 		}
 
-		// 1 struct for mqrpc.Marshaler
+		// 1 for mqrpc.Marshaler
 		if v2, ok := arg.(IMarshaler); ok {
 			b, err := v2.Marshal()
 			if err != nil {
@@ -105,7 +113,15 @@ func ArgToData(arg any) (string, []byte, error) {
 			}
 			return fmt.Sprintf("%v@%v", MARSHAL, reflect.TypeOf(arg)), b, nil
 		}
-		// 2 struct for msgpack (default)
+		// 2 for protobuf
+		if v2, ok := arg.(proto.Message); ok {
+			b, err := proto.Marshal(v2)
+			if err != nil {
+				return "", nil, fmt.Errorf("args [%s] proto marshal error %v", reflect.TypeOf(arg), err)
+			}
+			return fmt.Sprintf("%v@%v", PROTOBUF, reflect.TypeOf(arg)), b, nil
+		}
+		// 3 for msgpack (default: struct,slice,map,其他数值类型...)
 		b, err := msgpack.Marshal(arg)
 		if err != nil {
 			return "", nil, fmt.Errorf("args [%s] msgpack encode(default) error %v", reflect.TypeOf(arg), err)
@@ -162,6 +178,12 @@ func DataToArg(argType string, argData []byte) (any, error) {
 
 	case strings.HasPrefix(argType, MSGPACK): // 不能直接解出对象, 让外面解析
 		return argData, nil
+
+	case strings.HasPrefix(argType, PROTOBUF): // 不能直接解出对象, 让外面解析
+		return argData, nil
+	}
+	if s := getSerialize(argType); s != nil { // 自定义序列化器能直接解出对象
+		return s.Deserialize(argType, argData)
 	}
 	return nil, fmt.Errorf("DataToArg [%s] unsupported argType", argType)
 }
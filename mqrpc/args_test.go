@@ -12,6 +12,7 @@ import (
 	"github.com/cloudapex/river/mqrpc/core"
 	"github.com/cloudapex/river/tools"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 )
 
 var functions = map[string]*MethodInfo{}
@@ -20,6 +21,7 @@ func init() {
 	registerFun("rpc", onRPCFunc)
 	registerFun("rpc2", onRPCFunc2)
 	registerFun("rpc3", onRPCFunc3)
+	registerFun("rpc_values", onRPCValues)
 
 }
 func onRPCFunc(b bool, x int32, nn int64, f float32, ff float64, bt []byte, s string) (string, error) {
@@ -46,6 +48,39 @@ func onRPCFunc3(ctx context.Context, u *user, m map[string]string) (*out, error)
 	fmt.Println("onRPCFunc3 成功调用,请检查参数:", ctx, u, m)
 	return nil, nil
 }
+func onRPCValues(ctx context.Context, ids []int64, scores map[string]int, n uint32, i int, u user) ([]string, error) {
+	rs := []string{}
+	for _, id := range ids {
+		rs = append(rs, fmt.Sprintf("%v:%v", id, scores[fmt.Sprint(id)]))
+	}
+	rs = append(rs, fmt.Sprintf("%v %v %v", n, i, u.S))
+	return rs, nil
+}
+
+func TestValueTypes(t *testing.T) {
+	for _, arg := range []any{[]int64{1}, map[string]int{"a": 1}, uint32(1), 1, user{S: "s"}} {
+		argType, _, err := ArgToData(arg)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(argType, MSGPACK), argType)
+	}
+	argType, _, err := ArgToData([]int64(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, NULL, argType)
+	_, _, err = ArgToData(make(chan int))
+	assert.Error(t, err)
+
+	rs, err := Value[[]string](call(context.TODO(), "rpc_values", context.Background(),
+		[]int64{1, 2}, map[string]int{"1": 10, "2": 20}, uint32(7), int32(8), user{S: "str"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1:10", "2:20", "7 8 str"}, rs)
+
+	n, err := Value[int](int32(3), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	_, err = Value[int](nil, nil)
+	assert.Equal(t, ErrNil, err)
+}
+
 func TestBytes(t *testing.T) {
 	var c = context.Context(nil)
 	var i any = c
@@ -210,12 +245,18 @@ func _runFunc(callInfo *CallInfo) {
 				} else {
 					in[k] = elemp.Elem() // 接收 值变量
 				}
+			case strings.HasPrefix(v, PROTOBUF):
+				if err := Proto(elemp.Interface(), RpcResult(ret, nil)); err != nil {
+					panic(err)
+				}
+				if isPtr {
+					in[k] = reflect.ValueOf(elemp.Interface()) //接收 指针变量
+				} else {
+					in[k] = elemp.Elem() // 接收 值变量
+				}
 			default: // 其他的当做值类型处理
-				switch ret.(type) {
-				case nil:
-					in[k] = reflect.Zero(rv)
-				default:
-					in[k] = reflect.ValueOf(ret)
+				if in[k], err = AdaptArgValue(ret, rv); err != nil {
+					panic(err)
 				}
 			}
 			input[k] = in[k].Interface()
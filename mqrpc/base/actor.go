@@ -0,0 +1,126 @@
+package rpcbase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cloudapex/river/log"
+	"github.com/cloudapex/river/mqrpc"
+)
+
+const (
+	defaultActorMailboxSize = 1024
+	defaultActorIdleTimeout = time.Minute
+)
+
+// actorSystem 按key分配actor,每个actor一个邮箱和一个协程
+type actorSystem struct {
+	opts   mqrpc.ActorOptions
+	lock   sync.Mutex
+	actors map[string]*actor
+	closed bool
+	wg     sync.WaitGroup // 运行中的actor
+}
+
+type actor struct {
+	key     string
+	mailbox chan func()
+}
+
+func newActorSystem(opts mqrpc.ActorOptions) *actorSystem {
+	if opts.MailboxSize <= 0 {
+		opts.MailboxSize = defaultActorMailboxSize
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultActorIdleTimeout
+	}
+	return &actorSystem{opts: opts, actors: map[string]*actor{}}
+}
+
+// key 从ctx中获取actor key
+func (sys *actorSystem) key(ctx context.Context) string {
+	if sys.opts.Key != nil {
+		return sys.opts.Key(ctx)
+	}
+	return mqrpc.OrderKey(ctx)
+}
+
+// post 投递消息到key的邮箱(actor不存在时创建)
+func (sys *actorSystem) post(key string, f func()) error {
+	sys.lock.Lock()
+	defer sys.lock.Unlock()
+	if sys.closed {
+		return mqrpc.ErrActorStopped
+	}
+	a, ok := sys.actors[key]
+	if !ok {
+		a = &actor{key: key, mailbox: make(chan func(), sys.opts.MailboxSize)}
+		sys.actors[key] = a
+		sys.wg.Add(1)
+		go sys.run(a)
+	}
+	select {
+	case a.mailbox <- f:
+		return nil
+	default:
+		return mqrpc.ErrActorMailboxFull
+	}
+}
+
+// run actor协程: 依次执行邮箱中的消息,空闲超时后回收
+func (sys *actorSystem) run(a *actor) {
+	defer sys.wg.Done()
+	sys.hook("OnStart", sys.opts.OnStart, a.key)
+	defer sys.hook("OnStop", sys.opts.OnStop, a.key)
+
+	idle := time.NewTimer(sys.opts.IdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case f, ok := <-a.mailbox:
+			if !ok {
+				return // 服务关闭(邮箱中剩余的消息已执行完)
+			}
+			f()
+			idle.Reset(sys.opts.IdleTimeout)
+		case <-idle.C:
+			sys.lock.Lock()
+			if len(a.mailbox) > 0 || sys.closed {
+				sys.lock.Unlock()
+				idle.Reset(sys.opts.IdleTimeout)
+				continue
+			}
+			delete(sys.actors, a.key)
+			sys.lock.Unlock()
+			return
+		}
+	}
+}
+
+// hook 执行生命周期回调(不影响actor运行)
+func (sys *actorSystem) hook(name string, f func(key string), key string) {
+	if f == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("actor %s %s panic: %v", key, name, r)
+		}
+	}()
+	f(key)
+}
+
+// stop 关闭所有actor(执行完邮箱中剩余的消息),等待OnStop完成
+func (sys *actorSystem) stop() {
+	sys.lock.Lock()
+	if !sys.closed {
+		sys.closed = true
+		for _, a := range sys.actors {
+			close(a.mailbox)
+		}
+		sys.actors = map[string]*actor{}
+	}
+	sys.lock.Unlock()
+	sys.wg.Wait()
+}
@@ -0,0 +1,186 @@
+package rpcbase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/mqrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActorOrder(t *testing.T) {
+	sys := newActorSystem(mqrpc.ActorOptions{})
+	var lock sync.Mutex
+	got := map[string][]int{}
+	for i := 0; i < 100; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			assert.NoError(t, sys.post(key, func() {
+				lock.Lock()
+				got[key] = append(got[key], i)
+				lock.Unlock()
+			}))
+		}
+	}
+	sys.stop()
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Len(t, got[key], 100)
+		for i, v := range got[key] {
+			assert.Equal(t, i, v, key)
+		}
+	}
+}
+
+func TestActorParallel(t *testing.T) {
+	sys := newActorSystem(mqrpc.ActorOptions{})
+	defer sys.stop()
+	release := make(chan struct{})
+	started := make(chan string, 10)
+	for _, key := range []string{"a", "b"} {
+		assert.NoError(t, sys.post(key, func() {
+			started <- key
+			<-release
+		}))
+	}
+	// 不同key同时执行,同一key排队
+	got := []string{<-started, <-started}
+	assert.ElementsMatch(t, []string{"a", "b"}, got)
+	assert.NoError(t, sys.post("a", func() { started <- "a2" }))
+	select {
+	case k := <-started:
+		t.Fatalf("%s started before a finished", k)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(t, "a2", <-started)
+}
+
+func TestActorMailboxFull(t *testing.T) {
+	sys := newActorSystem(mqrpc.ActorOptions{MailboxSize: 2})
+	defer sys.stop()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	assert.NoError(t, sys.post("a", func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	assert.NoError(t, sys.post("a", func() {}))
+	assert.NoError(t, sys.post("a", func() {}))
+	assert.ErrorIs(t, sys.post("a", func() {}), mqrpc.ErrActorMailboxFull)
+	// 其他key不受影响
+	assert.NoError(t, sys.post("b", func() {}))
+	close(release)
+}
+
+func TestActorIdleEvictRace(t *testing.T) {
+	var starts, stops, running atomic.Int32
+	sys := newActorSystem(mqrpc.ActorOptions{
+		IdleTimeout: time.Millisecond,
+		OnStart: func(key string) {
+			starts.Add(1)
+			assert.Equal(t, int32(1), running.Add(1), "two actors for one key")
+		},
+		OnStop: func(key string) {
+			stops.Add(1)
+			running.Add(-1)
+		},
+	})
+	// 投递间隔在空闲超时附近,回收和投递交错时消息不能丢失
+	var executed atomic.Int32
+	const n = 500
+	for i := 0; i < n; i++ {
+		assert.NoError(t, sys.post("a", func() { executed.Add(1) }))
+		time.Sleep(time.Duration(i%3) * 500 * time.Microsecond)
+	}
+	sys.stop()
+	assert.Equal(t, int32(n), executed.Load())
+	assert.Greater(t, starts.Load(), int32(1))
+	assert.Equal(t, starts.Load(), stops.Load())
+}
+
+func TestActorLifecycle(t *testing.T) {
+	var lock sync.Mutex
+	var events []string
+	record := func(e string) {
+		lock.Lock()
+		events = append(events, e)
+		lock.Unlock()
+	}
+	sys := newActorSystem(mqrpc.ActorOptions{
+		IdleTimeout: 20 * time.Millisecond,
+		OnStart:     func(key string) { record("start:" + key) },
+		OnStop:      func(key string) { record("stop:" + key) },
+	})
+	assert.NoError(t, sys.post("a", func() { record("msg1") }))
+	assert.NoError(t, sys.post("a", func() { record("msg2") }))
+	// 空闲回收后再次投递会创建新的actor
+	assert.Eventually(t, func() bool {
+		sys.lock.Lock()
+		defer sys.lock.Unlock()
+		return len(sys.actors) == 0
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, sys.post("a", func() { record("msg3") }))
+	sys.stop()
+	assert.Equal(t, []string{"start:a", "msg1", "msg2", "stop:a", "start:a", "msg3", "stop:a"}, events)
+}
+
+func TestActorHookPanic(t *testing.T) {
+	sys := newActorSystem(mqrpc.ActorOptions{
+		OnStart: func(key string) { panic("start") },
+		OnStop:  func(key string) { panic("stop") },
+	})
+	done := make(chan struct{})
+	assert.NoError(t, sys.post("a", func() { close(done) }))
+	<-done
+	sys.stop()
+}
+
+func TestActorStopDrain(t *testing.T) {
+	var stopped atomic.Int32
+	sys := newActorSystem(mqrpc.ActorOptions{OnStop: func(key string) { stopped.Add(1) }})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	assert.NoError(t, sys.post("a", func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	var executed atomic.Int32
+	for _, key := range []string{"a", "a", "b", "c"} {
+		assert.NoError(t, sys.post(key, func() { executed.Add(1) }))
+	}
+
+	// stop等待邮箱中剩余的消息执行完和OnStop完成
+	done := make(chan struct{})
+	go func() {
+		sys.stop()
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		sys.lock.Lock()
+		defer sys.lock.Unlock()
+		return sys.closed
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, sys.post("d", func() {}), mqrpc.ErrActorStopped)
+	select {
+	case <-done:
+		t.Fatal("stop returned before mailbox drained")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	assert.Equal(t, int32(4), executed.Load())
+	assert.Equal(t, int32(3), stopped.Load())
+	sys.stop() // 重复调用
+}
+
+func TestActorKey(t *testing.T) {
+	sys := newActorSystem(mqrpc.ActorOptions{})
+	assert.Equal(t, "", sys.key(context.TODO()))
+	assert.Equal(t, "k1", sys.key(mqrpc.ContextWithOrderKey(context.TODO(), "k1")))
+	sys = newActorSystem(mqrpc.ActorOptions{Key: mqrpc.ActorKeyValue("roomId")})
+	assert.Equal(t, "r1", sys.key(mqrpc.ContextWithValue(context.TODO(), "roomId", "r1")))
+}
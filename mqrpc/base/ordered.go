@@ -0,0 +1,69 @@
+package rpcbase
+
+import (
+	"sync"
+
+	"github.com/cloudapex/river/mqrpc"
+)
+
+const (
+	defaultOrderedQueueSize = 1024  // 每个key等待执行的任务数上限
+	defaultOrderedMaxKeys   = 65536 // 同时有任务的key数上限
+)
+
+// orderedExecutor 按key顺序执行: 同一key的任务按提交顺序依次在一个协程中执行,不同key并行
+type orderedExecutor struct {
+	lock      sync.Mutex
+	queues    map[string][]func() // 正在执行的key -> 等待执行的任务
+	queueSize int                 // 每个key等待执行的任务数上限(0为defaultOrderedQueueSize)
+	maxKeys   int                 // 同时有任务的key数上限(0为defaultOrderedMaxKeys)
+}
+
+// Go 提交任务(该key的队列已满或key太多时拒绝)
+func (e *orderedExecutor) Go(key string, f func()) error {
+	e.lock.Lock()
+	if q, ok := e.queues[key]; ok {
+		if len(q) >= e.limit(e.queueSize, defaultOrderedQueueSize) {
+			e.lock.Unlock()
+			return mqrpc.ErrOrderedQueueFull
+		}
+		e.queues[key] = append(q, f)
+		e.lock.Unlock()
+		return nil
+	}
+	if e.queues == nil {
+		e.queues = map[string][]func(){}
+	}
+	if len(e.queues) >= e.limit(e.maxKeys, defaultOrderedMaxKeys) {
+		e.lock.Unlock()
+		return mqrpc.ErrOrderedTooManyKeys
+	}
+	e.queues[key] = nil
+	e.lock.Unlock()
+	go e.run(key, f)
+	return nil
+}
+
+func (e *orderedExecutor) limit(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// run 执行该key的任务直到队列为空
+func (e *orderedExecutor) run(key string, f func()) {
+	for f != nil {
+		f()
+		e.lock.Lock()
+		q := e.queues[key]
+		if len(q) == 0 {
+			delete(e.queues, key)
+			f = nil
+		} else {
+			f, q[0] = q[0], nil
+			e.queues[key] = q[1:]
+		}
+		e.lock.Unlock()
+	}
+}
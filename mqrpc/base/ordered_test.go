@@ -0,0 +1,80 @@
+package rpcbase
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudapex/river/mqrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedExecutorOrder(t *testing.T) {
+	e := &orderedExecutor{}
+	var lock sync.Mutex
+	got := map[string][]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			wg.Add(1)
+			assert.NoError(t, e.Go(key, func() {
+				defer wg.Done()
+				lock.Lock()
+				got[key] = append(got[key], i)
+				lock.Unlock()
+			}))
+		}
+	}
+	wg.Wait()
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Len(t, got[key], 100)
+		for i, v := range got[key] {
+			assert.Equal(t, i, v, key)
+		}
+	}
+	assert.Eventually(t, func() bool {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		return len(e.queues) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestOrderedExecutorParallel(t *testing.T) {
+	e := &orderedExecutor{}
+	release := make(chan struct{})
+	started := make(chan string, 10)
+	for _, key := range []string{"a", "b"} {
+		assert.NoError(t, e.Go(key, func() {
+			started <- key
+			<-release
+		}))
+	}
+	// 不同key同时执行,同一key排队
+	got := []string{<-started, <-started}
+	assert.ElementsMatch(t, []string{"a", "b"}, got)
+	assert.NoError(t, e.Go("a", func() { started <- "a2" }))
+	select {
+	case k := <-started:
+		t.Fatalf("%s started before a finished", k)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	assert.Equal(t, "a2", <-started)
+}
+
+func TestOrderedExecutorLimit(t *testing.T) {
+	e := &orderedExecutor{queueSize: 2, maxKeys: 2}
+	release := make(chan struct{})
+	block := func() { <-release }
+	assert.NoError(t, e.Go("a", block)) // 执行中
+	assert.NoError(t, e.Go("a", block))
+	assert.NoError(t, e.Go("a", block))
+	assert.ErrorIs(t, e.Go("a", block), mqrpc.ErrOrderedQueueFull)
+
+	assert.NoError(t, e.Go("b", block))
+	assert.ErrorIs(t, e.Go("c", block), mqrpc.ErrOrderedTooManyKeys)
+	assert.NoError(t, e.Go("b", block)) // 已有的key不受key数限制
+	close(release)
+
+	assert.Eventually(t, func() bool { return e.Go("c", func() {}) == nil }, time.Second, time.Millisecond)
+}
@@ -60,7 +60,7 @@ func (c *RPCClient) Call(ctx context.Context, _func string, params ...any) (any,
 	}
 
 	// CallArgs
-	return c.CallArgs(ctx, _func, argTypes, argDatas)
+	return c.CallArgs(_ctx, _func, argTypes, argDatas)
 }
 func (c *RPCClient) CallArgs(ctx context.Context, _func string, argTypes []string, argDatas [][]byte) (any, error) {
 	var err error
@@ -85,6 +85,7 @@ func (c *RPCClient) CallArgs(ctx context.Context, _func string, argTypes []strin
 		ArgsType: argTypes,
 		Caller:   caller,
 		Hostname: caller,
+		OrderKey: mqrpc.OrderKey(ctx),
 	}
 
 	defer func() { // 全局监控(调用方)
@@ -98,12 +99,21 @@ func (c *RPCClient) CallArgs(ctx context.Context, _func string, argTypes []strin
 		}
 	}()
 
-	// call
+	// 拦截器链
+	invoker := func(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+		return c.invokeCall(ctx, rpcInfo, &result_info)
+	}
+	result, err = chainClientInvoker(ctx, app.App().Options().ClientInterceptors, invoker)(ctx, rpcInfo)
+	return result, err
+}
+
+// invokeCall 发送请求并等待结果
+func (c *RPCClient) invokeCall(ctx context.Context, rpcInfo *core.RPCInfo, result_info *core.ResultInfo) (any, error) {
 	callInfo := &mqrpc.CallInfo{
 		RPCInfo: rpcInfo,
 	}
 	callback := make(chan *core.ResultInfo, 1)
-	err = c.nats_client.Call(callInfo, callback)
+	err := c.nats_client.Call(callInfo, callback)
 	if err != nil {
 		// 发送失败时立即清理 channel
 		c.close_callback_chan(callback)
@@ -122,8 +132,8 @@ func (c *RPCClient) CallArgs(ctx context.Context, _func string, argTypes []strin
 		if !ok {
 			return nil, fmt.Errorf("client closed")
 		}
-		result_info = *resultInfo
-		result, err = mqrpc.DataToArg(resultInfo.ResultType, resultInfo.Result)
+		*result_info = *resultInfo
+		result, err := mqrpc.DataToArg(resultInfo.ResultType, resultInfo.Result)
 		if err != nil {
 			return nil, err
 		}
@@ -164,7 +174,7 @@ func (c *RPCClient) CallNR(ctx context.Context, _func string, params ...any) err
 	}
 
 	// CallNRArgs
-	return c.CallNRArgs(ctx, _func, argTypes, argDatas)
+	return c.CallNRArgs(_ctx, _func, argTypes, argDatas)
 }
 func (c *RPCClient) CallNRArgs(ctx context.Context, _func string, argTypes []string, argDatas [][]byte) error {
 	var err error
@@ -185,9 +195,7 @@ func (c *RPCClient) CallNRArgs(ctx context.Context, _func string, argTypes []str
 		ArgsType: argTypes,
 		Caller:   caller,
 		Hostname: caller,
-	}
-	callInfo := &mqrpc.CallInfo{
-		RPCInfo: rpcInfo,
+		OrderKey: mqrpc.OrderKey(ctx),
 	}
 
 	defer func() { // 全局监控(调用方)
@@ -200,10 +208,34 @@ func (c *RPCClient) CallNRArgs(ctx context.Context, _func string, argTypes []str
 			handle(*c.nats_client.session.GetNode(), rpcInfo, nil, err, 0)
 		}
 	}()
-	err = c.nats_client.CallNR(callInfo)
+	// 拦截器链
+	_, err = chainClientInvoker(ctx, app.App().Options().ClientInterceptors, c.invokeCallNR)(ctx, rpcInfo)
 	return err
 }
 
+// chainClientInvoker 串联拦截器, 拦截器修改了ctx时发送前按最终的ctx重新编码首位的context参数
+func chainClientInvoker(origin context.Context, interceptors []mqrpc.ClientInterceptor, invoker mqrpc.ClientInvoker) mqrpc.ClientInvoker {
+	if len(interceptors) == 0 {
+		return invoker
+	}
+	return mqrpc.ChainClientInterceptors(interceptors, func(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+		if ctx != origin && len(rpcInfo.ArgsType) > 0 && rpcInfo.ArgsType[0] == mqrpc.CONTEXT {
+			_, data, err := mqrpc.ArgToData(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("args[0] error %s", err.Error())
+			}
+			rpcInfo.Args = append([][]byte{data}, rpcInfo.Args[1:]...) // 不修改调用方的参数
+			rpcInfo.OrderKey = mqrpc.OrderKey(ctx)
+		}
+		return invoker(ctx, rpcInfo)
+	})
+}
+
+// invokeCallNR 发送请求(无需等待结果)
+func (c *RPCClient) invokeCallNR(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+	return nil, c.nats_client.CallNR(&mqrpc.CallInfo{RPCInfo: rpcInfo})
+}
+
 func (c *RPCClient) close_callback_chan(ch chan *core.ResultInfo) {
 	defer func() {
 		if recover() != nil {
@@ -0,0 +1,53 @@
+package rpcbase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudapex/river/mqrpc"
+	"github.com/cloudapex/river/mqrpc/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainClientInvokerContext(t *testing.T) {
+	ctx := mqrpc.ContextWithValue(context.Background(), "trace", "t1")
+	argType, argData, err := mqrpc.ArgToData(ctx)
+	assert.NoError(t, err)
+	args := [][]byte{argData, []byte("body")}
+	rpcInfo := &core.RPCInfo{Fn: "fn", ArgsType: []string{argType, mqrpc.BYTES}, Args: args}
+
+	tenant := func(ctx context.Context, rpcInfo *core.RPCInfo, invoker mqrpc.ClientInvoker) (any, error) {
+		ctx = mqrpc.ContextWithValue(ctx, "tenant", "eu")
+		return invoker(mqrpc.ContextWithOrderKey(ctx, "user:1"), rpcInfo)
+	}
+	// 模拟服务方: 从发送的参数中解码ctx
+	var server context.Context
+	invoker := chainClientInvoker(ctx, []mqrpc.ClientInterceptor{tenant}, func(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+		arg, err := mqrpc.DataToArg(rpcInfo.ArgsType[0], rpcInfo.Args[0])
+		server, _ = arg.(context.Context)
+		return nil, err
+	})
+	_, err = invoker(ctx, rpcInfo)
+	assert.NoError(t, err)
+	if assert.NotNil(t, server) {
+		assert.Equal(t, "eu", server.Value("tenant"))
+		assert.Equal(t, "t1", server.Value("trace"))
+	}
+	assert.Equal(t, "user:1", rpcInfo.OrderKey)
+	assert.Equal(t, argData, args[0]) // 不修改调用方的参数
+	assert.Equal(t, "body", string(rpcInfo.Args[1]))
+}
+
+func TestChainClientInvokerUnchanged(t *testing.T) {
+	ctx := mqrpc.ContextWithValue(context.Background(), "trace", "t1")
+	rpcInfo := &core.RPCInfo{Fn: "fn", ArgsType: []string{mqrpc.CONTEXT}, Args: [][]byte{[]byte("origin")}}
+	pass := func(ctx context.Context, rpcInfo *core.RPCInfo, invoker mqrpc.ClientInvoker) (any, error) {
+		return invoker(ctx, rpcInfo)
+	}
+	invoker := chainClientInvoker(ctx, []mqrpc.ClientInterceptor{pass}, func(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+		return string(rpcInfo.Args[0]), nil
+	})
+	result, err := invoker(ctx, rpcInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "origin", result) // ctx未修改时不重新编码
+}
@@ -1,6 +1,7 @@
 package rpcbase
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -15,6 +16,8 @@ import (
 	"github.com/cloudapex/river/mqrpc/core"
 )
 
+var _ mqrpc.IActorServer = &RPCServer{}
+
 type RPCServer struct {
 	module         app.IModule
 	methods        map[string]*mqrpc.MethodInfo
@@ -25,6 +28,10 @@ type RPCServer struct {
 	listener       mqrpc.IRPCListener
 	control        mqrpc.IGoroutineControl //控制模块可同时开启的最大协程数
 	executing      int64                   //正在执行的goroutine数量
+	ordered        orderedExecutor         //按OrderKey顺序执行
+	actors         *actorSystem            //RegisterActor注册的方法
+
+	localInterceptors []mqrpc.ServerInterceptor // 本服务的拦截器
 }
 
 func NewRPCServer(module app.IModule) (mqrpc.IRPCServer, error) {
@@ -33,6 +40,7 @@ func NewRPCServer(module app.IModule) (mqrpc.IRPCServer, error) {
 	rpc_server.call_chan_done = make(chan error)
 	rpc_server.methods = make(map[string]*mqrpc.MethodInfo)
 	rpc_server.mq_chan = make(chan mqrpc.CallInfo)
+	rpc_server.actors = newActorSystem(mqrpc.ActorOptions{})
 
 	nats_server, err := NewNatsServer(rpc_server)
 	if err != nil {
@@ -59,6 +67,11 @@ func (s *RPCServer) SetGoroutineControl(control mqrpc.IGoroutineControl) {
 	s.control = control
 }
 
+// you must call the method before calling Open and Go
+func (s *RPCServer) AddInterceptor(interceptors ...mqrpc.ServerInterceptor) {
+	s.localInterceptors = append(s.localInterceptors, interceptors...)
+}
+
 /*
 *
 获取当前正在执行的goroutine 数量
@@ -109,11 +122,38 @@ func (s *RPCServer) RegisterGO(id string, f any) {
 	s.methods[id] = finfo
 }
 
+// you must call the method before calling Open and Go
+func (s *RPCServer) RegisterActor(id string, f any) {
+
+	if _, ok := s.methods[id]; ok {
+		panic(fmt.Sprintf("method id %v: already registered", id))
+	}
+
+	finfo := &mqrpc.MethodInfo{
+		Function: reflect.ValueOf(f),
+		FuncType: reflect.ValueOf(f).Type(),
+		Actor:    true,
+	}
+
+	finfo.InType = []reflect.Type{}
+	for i := 0; i < finfo.FuncType.NumIn(); i++ {
+		rv := finfo.FuncType.In(i)
+		finfo.InType = append(finfo.InType, rv)
+	}
+	s.methods[id] = finfo
+}
+
+// you must call the method before calling Open and Go
+func (s *RPCServer) SetActorOptions(opts mqrpc.ActorOptions) {
+	s.actors = newActorSystem(opts)
+}
+
 func (s *RPCServer) Done() (err error) {
 	//等待正在执行的请求完成
 	//close(s.mq_chan)   //关闭mq_chan通道
 	//<-s.call_chan_done //mq_chan通道的信息都已处理完
 	s.wg.Wait()
+	s.actors.stop()
 	//s.call_chan_done <- nil
 	//关闭队列链接
 	if s.nats_server != nil {
@@ -259,12 +299,10 @@ func (s *RPCServer) _runFunc(start time.Time, methodInfo *mqrpc.MethodInfo, call
 			}
 
 			switch {
-			default: // 基本类型直接赋值
-				switch ret.(type) {
-				case nil:
-					in[k] = reflect.Zero(rv)
-				default:
-					in[k] = reflect.ValueOf(ret)
+			default: // 基本类型及自定义序列化器解出的对象直接赋值
+				if in[k], err = mqrpc.AdaptArgValue(ret, rv); err != nil {
+					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("args[%d] %v", k, err))
+					return
 				}
 
 			case strings.HasPrefix(v, mqrpc.MARSHAL):
@@ -288,6 +326,17 @@ func (s *RPCServer) _runFunc(start time.Time, methodInfo *mqrpc.MethodInfo, call
 				} else {
 					in[k] = elemp.Elem() // 接收 值变量
 				}
+
+			case strings.HasPrefix(v, mqrpc.PROTOBUF):
+				if err := mqrpc.Proto(elemp.Interface(), mqrpc.RpcResult(ret, nil)); err != nil {
+					s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
+					return
+				}
+				if isPtr {
+					in[k] = reflect.ValueOf(elemp.Interface()) //接收 指针变量
+				} else {
+					in[k] = elemp.Elem() // 接收 值变量
+				}
 			}
 			input[k] = in[k].Interface()
 		}
@@ -301,35 +350,28 @@ func (s *RPCServer) _runFunc(start time.Time, methodInfo *mqrpc.MethodInfo, call
 		}
 	}
 
-	out := f.Call(in)
-	var rs []any
-	if len(out) != 2 {
+	if fType.NumOut() != 2 || !isErrorType(fType.Out(1)) {
 		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("%s rpc func(%s) return error %s\n", s.module.GetType(), callInfo.RPCInfo.Fn, "func(....)(result any, err error)"))
 		return
 	}
-	if len(out) > 0 { // prepare out paras
-		rs = make([]any, len(out), len(out))
-		for i, v := range out {
-			rs[i] = v.Interface()
+
+	// 拦截器链(最内层执行方法)
+	ctx := context.Background()
+	if len(input) > 0 {
+		if c, ok := input[0].(context.Context); ok {
+			ctx = c
 		}
 	}
-	// if handler := app.Default().Options().RpcCompleteHook; handler != nil {
-	// 	handler(s.module, callInfo, input, rs, time.Since(start))
-	// }
+	handler := func(ctx context.Context, callInfo *mqrpc.CallInfo, args []any) (any, error) {
+		return s.invoke(methodInfo, ctx, args)
+	}
+	result, rerror := mqrpc.ChainServerInterceptors(s.interceptors(), handler)(ctx, callInfo, input)
+
 	var rerr string
-	switch e := rs[1].(type) {
-	case string:
-		rerr = e
-		break
-	case error:
-		rerr = e.Error()
-	case nil:
-		rerr = ""
-	default:
-		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("%s rpc func(%s) return error %s\n", s.module.GetType(), callInfo.RPCInfo.Fn, "func(....)(result any, err error)"))
-		return
+	if rerror != nil {
+		rerr = rerror.Error()
 	}
-	argType, argData, err := mqrpc.ArgToData(rs[0])
+	argType, argData, err := mqrpc.ArgToData(result)
 	if err != nil {
 		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, err.Error())
 		return
@@ -345,13 +387,59 @@ func (s *RPCServer) _runFunc(start time.Time, methodInfo *mqrpc.MethodInfo, call
 	callInfo.ExecTime = time.Since(start).Nanoseconds()
 	s.doCallback(callInfo)
 	if app.App().Config().RpcLog {
-		log.TInfo(nil, "rpc Exec ModuleType = %v, Func = %v, Elapsed = %v, Result = <%T-len:%v>, Error = %v", s.module.GetType(), callInfo.RPCInfo.Fn, time.Since(start), rs[0], len(resultInfo.Result), rs[1])
+		log.TInfo(nil, "rpc Exec ModuleType = %v, Func = %v, Elapsed = %v, Result = <%T-len:%v>, Error = %v", s.module.GetType(), callInfo.RPCInfo.Fn, time.Since(start), result, len(resultInfo.Result), rerror)
 	}
 	if s.listener != nil {
 		s.listener.OnComplete(callInfo.RPCInfo.Fn, callInfo, resultInfo, time.Since(start).Nanoseconds())
 	}
 }
 
+// invoke 执行RPC方法(args可能已被拦截器修改)
+func (s *RPCServer) invoke(methodInfo *mqrpc.MethodInfo, ctx context.Context, args []any) (any, error) {
+	in := make([]reflect.Value, len(args))
+	for k, arg := range args {
+		rv := methodInfo.InType[k]
+		if k == 0 && rv == contextType {
+			arg = ctx // 拦截器可能替换了ctx
+		}
+		v, err := mqrpc.AdaptArgValue(arg, rv)
+		if err != nil {
+			return nil, fmt.Errorf("args[%d] %v", k, err)
+		}
+		in[k] = v
+	}
+
+	out := methodInfo.Function.Call(in)
+	switch e := out[1].Interface().(type) {
+	case string:
+		if e != "" {
+			return out[0].Interface(), errors.New(e)
+		}
+	case error:
+		return out[0].Interface(), e
+	}
+	return out[0].Interface(), nil
+}
+
+// interceptors 服务方拦截器(app级在前)
+func (s *RPCServer) interceptors() []mqrpc.ServerInterceptor {
+	global := app.App().Options().ServerInterceptors
+	if len(global) == 0 {
+		return s.localInterceptors
+	}
+	return append(append([]mqrpc.ServerInterceptor{}, global...), s.localInterceptors...)
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// isErrorType 方法的第二个返回值必须是error或string
+func isErrorType(rt reflect.Type) bool {
+	return rt.Implements(errorType) || rt.Kind() == reflect.String
+}
+
 // ---------------------------------if _func is not a function or para num and type not match,it will cause panic
 func (s *RPCServer) runFunc(callInfo *mqrpc.CallInfo) {
 	start := time.Now()
@@ -369,10 +457,6 @@ func (s *RPCServer) runFunc(callInfo *mqrpc.CallInfo) {
 		}
 	}()
 
-	if s.control != nil {
-		//协程数量达到最大限制
-		s.control.Wait()
-	}
 	methodInfo, ok := s.methods[callInfo.RPCInfo.Fn]
 	if !ok {
 		if s.listener != nil {
@@ -384,9 +468,77 @@ func (s *RPCServer) runFunc(callInfo *mqrpc.CallInfo) {
 			methodInfo = fInfo
 		}
 	}
+	if key := callInfo.RPCInfo.OrderKey; key != "" && methodInfo.Goroutine && !methodInfo.Actor {
+		s.runOrdered(start, key, methodInfo, callInfo)
+		return
+	}
+	if methodInfo.Actor {
+		s.runActor(start, methodInfo, callInfo)
+		return
+	}
+	if s.control != nil {
+		//协程数量达到最大限制
+		s.control.Wait()
+	}
 	if methodInfo.Goroutine {
 		go s._runFunc(start, methodInfo, callInfo)
 	} else {
 		s._runFunc(start, methodInfo, callInfo)
 	}
 }
+
+// runOrdered 按OrderKey排队执行(在该key的协程中等待协程名额,排队的调用不阻塞接收协程)
+func (s *RPCServer) runOrdered(start time.Time, key string, methodInfo *mqrpc.MethodInfo, callInfo *mqrpc.CallInfo) {
+	s.wg.Add(1)
+	err := s.ordered.Go(key, func() {
+		defer s.wg.Done()
+		if s.control != nil {
+			s.control.Wait()
+		}
+		s._runFunc(start, methodInfo, callInfo)
+	})
+	if err != nil {
+		s.wg.Done()
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("%s rpc func(%s) %v", s.module.GetType(), callInfo.RPCInfo.Fn, err))
+	}
+}
+
+// runActor 投递到actor key对应的邮箱中执行(在actor协程中等待协程名额,邮箱中排队的消息不占用名额)
+func (s *RPCServer) runActor(start time.Time, methodInfo *mqrpc.MethodInfo, callInfo *mqrpc.CallInfo) {
+	key, err := s.actorKey(callInfo)
+	if err == nil && key == "" {
+		err = mqrpc.ErrActorKeyNotFound
+	}
+	if err == nil {
+		s.wg.Add(1)
+		err = s.actors.post(key, func() {
+			defer s.wg.Done()
+			if s.control != nil {
+				s.control.Wait()
+			}
+			s._runFunc(start, methodInfo, callInfo)
+		})
+		if err != nil {
+			s.wg.Done()
+		}
+	}
+	if err != nil {
+		s._errorCallback(start, callInfo, callInfo.RPCInfo.Cid, fmt.Sprintf("%s rpc func(%s) %v", s.module.GetType(), callInfo.RPCInfo.Fn, err))
+	}
+}
+
+// actorKey 从请求的ctx参数中获取actor key
+func (s *RPCServer) actorKey(callInfo *mqrpc.CallInfo) (string, error) {
+	ctx := context.Background()
+	if argsType := callInfo.RPCInfo.ArgsType; len(argsType) > 0 && argsType[0] == mqrpc.CONTEXT {
+		arg, err := mqrpc.DataToArg(argsType[0], callInfo.RPCInfo.Args[0])
+		if err != nil {
+			return "", err
+		}
+		ctx = arg.(context.Context)
+	}
+	if key := callInfo.RPCInfo.OrderKey; key != "" {
+		ctx = mqrpc.ContextWithOrderKey(ctx, key)
+	}
+	return s.actors.key(ctx), nil
+}
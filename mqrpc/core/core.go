@@ -11,6 +11,9 @@ type RPCInfo struct {
 	Args     [][]byte `msgpack:"args" json:"args"`                             // 参数数据
 	Caller   string   `msgpack:"caller,omitempty" json:"caller,omitempty"`     // 调用者
 	Hostname string   `msgpack:"hostname,omitempty" json:"hostname,omitempty"` // 主机名
+
+	// 顺序执行的key(非空时服务方按到达顺序依次执行同一key的RegisterGO方法)
+	OrderKey string `msgpack:"order_key,omitempty" json:"order_key,omitempty"`
 }
 
 type ResultInfo struct {
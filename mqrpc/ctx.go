@@ -2,6 +2,7 @@ package mqrpc
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/cloudapex/river/log"
@@ -65,3 +66,25 @@ func getTranslatableCtxValMakeFun(key string) FunMakeCtxValue {
 	defer contextKeysMutex.RUnlock()
 	return translatableCtxKeys[key]
 }
+
+var (
+	ErrOrderedQueueFull   = errors.New("mqrpc: ordered queue full")    // 该OrderKey等待执行的调用太多
+	ErrOrderedTooManyKeys = errors.New("mqrpc: too many ordered keys") // 同时等待执行的OrderKey太多
+)
+
+// orderKeyCtx 顺序执行key的Context key(通过RPCInfo.OrderKey传输)
+type orderKeyCtx struct{}
+
+// ContextWithOrderKey 同一个key的RPC调用在服务方按到达顺序依次执行(只对RegisterGO注册的方法生效,不同key之间仍然并行)
+func ContextWithOrderKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, orderKeyCtx{}, key)
+}
+
+// OrderKey 获取ctx中的顺序执行key
+func OrderKey(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	key, _ := ctx.Value(orderKeyCtx{}).(string)
+	return key
+}
@@ -0,0 +1,41 @@
+package mqrpc
+
+import (
+	"context"
+
+	"github.com/cloudapex/river/mqrpc/core"
+)
+
+// ClientInvoker 调用方执行RPC请求(CallNR时result始终为nil)
+type ClientInvoker func(ctx context.Context, rpcInfo *core.RPCInfo) (result any, err error)
+
+// ClientInterceptor 调用方拦截器(可读取修改ctx/rpcInfo/结果, 不调用invoker则直接短路返回)
+type ClientInterceptor func(ctx context.Context, rpcInfo *core.RPCInfo, invoker ClientInvoker) (result any, err error)
+
+// ServerHandler 服务方执行RPC方法(args为解码后的方法参数, ctx为args中的context.Context)
+type ServerHandler func(ctx context.Context, callInfo *CallInfo, args []any) (result any, err error)
+
+// ServerInterceptor 服务方拦截器(可读取修改ctx/args/结果, 不调用handler则直接拒绝本次调用)
+type ServerInterceptor func(ctx context.Context, callInfo *CallInfo, args []any, handler ServerHandler) (result any, err error)
+
+// ChainClientInterceptors 将拦截器按顺序串联(第一个拦截器在最外层)
+func ChainClientInterceptors(interceptors []ClientInterceptor, invoker ClientInvoker) ClientInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+			return interceptor(ctx, rpcInfo, next)
+		}
+	}
+	return invoker
+}
+
+// ChainServerInterceptors 将拦截器按顺序串联(第一个拦截器在最外层)
+func ChainServerInterceptors(interceptors []ServerInterceptor, handler ServerHandler) ServerHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, callInfo *CallInfo, args []any) (any, error) {
+			return interceptor(ctx, callInfo, args, next)
+		}
+	}
+	return handler
+}
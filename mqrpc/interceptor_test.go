@@ -0,0 +1,54 @@
+package mqrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudapex/river/mqrpc/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainClientInterceptors(t *testing.T) {
+	var trace []string
+	mark := func(name string) ClientInterceptor {
+		return func(ctx context.Context, rpcInfo *core.RPCInfo, invoker ClientInvoker) (any, error) {
+			trace = append(trace, name+">")
+			result, err := invoker(ctx, rpcInfo)
+			trace = append(trace, "<"+name)
+			return result, err
+		}
+	}
+	invoker := ChainClientInterceptors([]ClientInterceptor{mark("a"), mark("b")}, func(ctx context.Context, rpcInfo *core.RPCInfo) (any, error) {
+		trace = append(trace, rpcInfo.Fn)
+		return "ok", nil
+	})
+	result, err := invoker(context.TODO(), &core.RPCInfo{Fn: "fn"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result)
+	assert.Equal(t, []string{"a>", "b>", "fn", "<b", "<a"}, trace)
+}
+
+func TestChainServerInterceptors(t *testing.T) {
+	errDenied := errors.New("denied")
+	deny := func(ctx context.Context, callInfo *CallInfo, args []any, handler ServerHandler) (any, error) {
+		if callInfo.RPCInfo.Caller == "" {
+			return nil, errDenied
+		}
+		return handler(ctx, callInfo, args)
+	}
+	double := func(ctx context.Context, callInfo *CallInfo, args []any, handler ServerHandler) (any, error) {
+		args[1] = args[1].(int64) * 2
+		return handler(ctx, callInfo, args)
+	}
+	handler := ChainServerInterceptors([]ServerInterceptor{deny, double}, func(ctx context.Context, callInfo *CallInfo, args []any) (any, error) {
+		return args[1], nil
+	})
+
+	_, err := handler(context.TODO(), &CallInfo{RPCInfo: &core.RPCInfo{}}, []any{context.TODO(), int64(2)})
+	assert.Equal(t, errDenied, err)
+
+	result, err := handler(context.TODO(), &CallInfo{RPCInfo: &core.RPCInfo{Caller: "c"}}, []any{context.TODO(), int64(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), result)
+}
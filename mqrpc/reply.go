@@ -9,6 +9,7 @@ import (
 
 	"github.com/cloudapex/river/tools"
 	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
 )
 
 // ErrNil ErrNil
@@ -202,7 +203,7 @@ func MsgPack(pObj any, ret callResult) error {
 
 	rv := reflect.ValueOf(pObj)
 	if rv.Kind() != reflect.Ptr { //不是指针报错
-		return fmt.Errorf("pObj [%v] not struct pointer type", rv.Type())
+		return fmt.Errorf("pObj [%v] not pointer type", rv.Type())
 	}
 
 	switch r := ret.Reply.(type) {
@@ -217,6 +218,54 @@ func MsgPack(pObj any, ret callResult) error {
 	return fmt.Errorf("mqrpc: unexpected type want MsgPack([]byte), got type %T", reflect.ValueOf(ret.Reply).Type())
 }
 
+// Proto Proto
+func Proto(pObj any, ret callResult) error {
+	if ret.Error != nil {
+		return ret.Error
+	}
+
+	v2, ok := pObj.(proto.Message)
+	if !ok {
+		return fmt.Errorf("pObj [%v] not proto.Message type", reflect.TypeOf(pObj))
+	}
+
+	switch r := ret.Reply.(type) {
+	case []byte:
+		if err := proto.Unmarshal(r, v2); err != nil {
+			return fmt.Errorf("proto unmarshal error: %v", err)
+		}
+		return nil
+	case nil:
+		return ErrNil
+	}
+	return fmt.Errorf("mqrpc: unexpected type want Proto([]byte), got type %T", ret.Reply)
+}
+
+// Value 将返回值解析为类型T(基本类型直接转换, msgpack编码的slice/map/struct等解码到T)
+func Value[T any](reply any, err error) (T, error) {
+	var val T
+	if err != nil {
+		return val, err
+	}
+
+	switch r := reply.(type) {
+	case T:
+		return r, nil
+	case nil:
+		return val, ErrNil
+	case []byte:
+		if err := msgpack.Unmarshal(r, &val); err != nil {
+			return val, fmt.Errorf("msgpack unmarshal error: %v", err)
+		}
+		return val, nil
+	}
+	rv, err := AdaptArgValue(reply, reflect.TypeOf(&val).Elem())
+	if err != nil {
+		return val, fmt.Errorf("mqrpc: unexpected type want %T, got type %T", val, reply)
+	}
+	return rv.Interface().(T), nil
+}
+
 // MsgJson MsgJson
 func MsgJson(reply any, err error) (string, error) {
 	if err != nil {
@@ -14,6 +14,7 @@ type MethodInfo struct {
 	FuncType  reflect.Type
 	InType    []reflect.Type
 	Goroutine bool
+	Actor     bool
 }
 
 // CallInfo RPC的请求信息
@@ -59,12 +60,19 @@ type IRPCServer interface {
 	Addr() string
 	SetListener(listener IRPCListener) // 设置监听器
 	SetGoroutineControl(control IGoroutineControl)
+	AddInterceptor(interceptors ...ServerInterceptor) // 添加服务方拦截器(在app级拦截器之后执行)
 	GetExecuting() int64
 	Register(id string, f any)   // 注册RPC方法,f第一个参数必须为context.Context(单线程)
 	RegisterGO(id string, f any) // 注册RPC方法,f第一个参数必须为context.Context(多线程)
 	Done() (err error)
 }
 
+// IActorServer 支持actor执行方式的服务(可选实现,通过类型断言使用)
+type IActorServer interface {
+	RegisterActor(id string, f any)    // 注册RPC方法,f第一个参数必须为context.Context(按actor key顺序执行)
+	SetActorOptions(opts ActorOptions) // 设置actor配置(在Register之前调用)
+}
+
 // IRPCClient 客户端定义
 type IRPCClient interface {
 	Done() (err error)
@@ -82,7 +90,7 @@ type IMarshaler interface {
 	String() string
 }
 
-// IRPCSerialize 自定义参数序列化接口
+// IRPCSerialize 自定义参数序列化接口(通过RegSerialize注册)
 type IRPCSerialize interface {
 	/**
 	序列化 结构体-->[]byte
@@ -0,0 +1,191 @@
+package mqrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// 已注册的自定义参数序列化器
+var (
+	serializesMutex sync.RWMutex
+	serializes      []IRPCSerialize              // 按注册顺序尝试序列化
+	serializeTypes  = map[string]IRPCSerialize{} // ptype -> 序列化器(反序列化时使用)
+)
+
+// RegSerialize 注册自定义参数序列化器(需在RPC调用之前注册,调用方和服务方都需要注册)
+func RegSerialize(s IRPCSerialize) {
+	serializesMutex.Lock()
+	defer serializesMutex.Unlock()
+
+	for _, ptype := range s.GetTypes() {
+		if _, ok := serializeTypes[ptype]; ok {
+			panic(fmt.Sprintf("mqrpc serialize type %v: already registered", ptype))
+		}
+		serializeTypes[ptype] = s
+	}
+	serializes = append(serializes, s)
+}
+
+// serializeArg 尝试用已注册的序列化器序列化参数(ok=false表示没有序列化器能处理该参数)
+func serializeArg(arg any) (ptype string, data []byte, ok bool, err error) {
+	serializesMutex.RLock()
+	defer serializesMutex.RUnlock()
+
+	for _, s := range serializes {
+		ptype, data, err = s.Serialize(arg)
+		if ptype == "" { // 不能处理这个类型
+			continue
+		}
+		if _, registered := serializeTypes[ptype]; !registered {
+			return "", nil, true, fmt.Errorf("mqrpc serialize type %v not in GetTypes()", ptype)
+		}
+		return ptype, data, true, err
+	}
+	return "", nil, false, nil
+}
+
+// getSerialize 根据ptype获取对应的序列化器
+func getSerialize(ptype string) IRPCSerialize {
+	serializesMutex.RLock()
+	defer serializesMutex.RUnlock()
+	return serializeTypes[ptype]
+}
+
+// NewJSONSerialize 创建使用JSON编码指定类型的序列化器(samples为需要JSON编码的类型样例,如&User{})
+func NewJSONSerialize(samples ...any) IRPCSerialize {
+	s := &jsonSerialize{types: map[reflect.Type]string{}, ptypes: map[string]reflect.Type{}}
+	for _, sample := range samples {
+		rt := reflect.TypeOf(sample)
+		ptype := fmt.Sprintf("%v@%v", JSON, rt)
+		s.types[rt] = ptype
+		s.ptypes[ptype] = rt
+	}
+	return s
+}
+
+// jsonSerialize 按类型注册的JSON序列化器
+type jsonSerialize struct {
+	types  map[reflect.Type]string
+	ptypes map[string]reflect.Type
+}
+
+func (s *jsonSerialize) Serialize(param any) (string, []byte, error) {
+	ptype, ok := s.types[reflect.TypeOf(param)]
+	if !ok {
+		return "", nil, nil
+	}
+	b, err := json.Marshal(param)
+	if err != nil {
+		return ptype, nil, fmt.Errorf("args [%s] json encode error %v", reflect.TypeOf(param), err)
+	}
+	return ptype, b, nil
+}
+
+func (s *jsonSerialize) Deserialize(ptype string, b []byte) (any, error) {
+	rt, ok := s.ptypes[ptype]
+	if !ok {
+		return nil, fmt.Errorf("json serialize unsupported type %v", ptype)
+	}
+	if rt.Kind() == reflect.Ptr {
+		obj := reflect.New(rt.Elem())
+		if err := json.Unmarshal(b, obj.Interface()); err != nil {
+			return nil, fmt.Errorf("json unmarshal error: %v", err)
+		}
+		return obj.Interface(), nil
+	}
+	obj := reflect.New(rt)
+	if err := json.Unmarshal(b, obj.Interface()); err != nil {
+		return nil, fmt.Errorf("json unmarshal error: %v", err)
+	}
+	return obj.Elem().Interface(), nil
+}
+
+func (s *jsonSerialize) GetTypes() []string {
+	ptypes := make([]string, 0, len(s.ptypes))
+	for ptype := range s.ptypes {
+		ptypes = append(ptypes, ptype)
+	}
+	return ptypes
+}
+
+// AdaptArgValue 将反序列化得到的参数值适配为方法参数类型rt(指针与值之间自动转换)
+func AdaptArgValue(arg any, rt reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		return reflect.Zero(rt), nil
+	}
+	rv := reflect.ValueOf(arg)
+	switch {
+	case rv.Type().AssignableTo(rt):
+		return rv, nil
+	case rv.Kind() == reflect.Ptr && rv.Type().Elem().AssignableTo(rt): // *T -> T
+		if rv.IsNil() {
+			return reflect.Zero(rt), nil
+		}
+		return rv.Elem(), nil
+	case rt.Kind() == reflect.Ptr && rv.Type().AssignableTo(rt.Elem()): // T -> *T
+		pv := reflect.New(rt.Elem())
+		pv.Elem().Set(rv)
+		return pv, nil
+	case isNumberKind(rv.Kind()) && isNumberKind(rt.Kind()): // int32 -> int ...
+		if err := checkNumberConvert(rv, rt); err != nil {
+			return reflect.Value{}, err
+		}
+		return rv.Convert(rt), nil
+	}
+	return reflect.Value{}, fmt.Errorf("arg type %v can not assign to %v", rv.Type(), rt)
+}
+
+// checkNumberConvert 检查数值转换为rt时是否溢出、丢失符号或丢失小数部分
+func checkNumberConvert(rv reflect.Value, rt reflect.Type) error {
+	target := reflect.Zero(rt)
+	overflow := false
+	switch {
+	case target.CanInt():
+		switch {
+		case rv.CanInt():
+			overflow = target.OverflowInt(rv.Int())
+		case rv.CanUint():
+			overflow = rv.Uint() > math.MaxInt64 || target.OverflowInt(int64(rv.Uint()))
+		default:
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("arg %v of type %v loses fraction converting to %v", f, rv.Type(), rt)
+			}
+			overflow = f < math.MinInt64 || f >= math.MaxInt64 || target.OverflowInt(int64(f))
+		}
+	case target.CanUint():
+		switch {
+		case rv.CanInt():
+			overflow = rv.Int() < 0 || target.OverflowUint(uint64(rv.Int()))
+		case rv.CanUint():
+			overflow = target.OverflowUint(rv.Uint())
+		default:
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("arg %v of type %v loses fraction converting to %v", f, rv.Type(), rt)
+			}
+			overflow = f < 0 || f >= math.MaxUint64 || target.OverflowUint(uint64(f))
+		}
+	default:
+		if rv.CanFloat() {
+			overflow = target.OverflowFloat(rv.Float())
+		}
+	}
+	if overflow {
+		return fmt.Errorf("arg %v of type %v overflows %v", rv.Interface(), rv.Type(), rt)
+	}
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
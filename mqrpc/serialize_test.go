@@ -0,0 +1,107 @@
+package mqrpc
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age  int32  `json:"age"`
+}
+
+func init() {
+	RegSerialize(NewJSONSerialize(&jsonUser{}))
+
+	registerFun("rpc_proto", onRPCProto)
+	registerFun("rpc_json", onRPCJson)
+}
+
+func onRPCProto(ctx context.Context, v *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	return wrapperspb.String(v.GetValue() + "!"), nil
+}
+func onRPCJson(ctx context.Context, u *jsonUser) (*jsonUser, error) {
+	u.Age++
+	return u, nil
+}
+
+func TestProtobufArg(t *testing.T) {
+	argType, _, err := ArgToData(wrapperspb.String("hi"))
+	assert.NoError(t, err)
+	assert.Equal(t, "protobuf@*wrapperspb.StringValue", argType)
+
+	ret := &wrapperspb.StringValue{}
+	err = Proto(ret, RpcResult(call(context.TODO(), "rpc_proto", context.Background(), wrapperspb.String("hi"))))
+	assert.NoError(t, err)
+	assert.Equal(t, "hi!", ret.GetValue())
+}
+
+func TestJSONSerialize(t *testing.T) {
+	argType, data, err := ArgToData(&jsonUser{Name: "river", Age: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "json@*mqrpc.jsonUser", argType)
+	assert.JSONEq(t, `{"name":"river","age":1}`, string(data))
+
+	result, err := call(context.TODO(), "rpc_json", context.Background(), &jsonUser{Name: "river", Age: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, &jsonUser{Name: "river", Age: 2}, result)
+}
+
+func TestAdaptArgValue(t *testing.T) {
+	rv, err := AdaptArgValue(&jsonUser{Name: "a"}, reflect.TypeOf(jsonUser{}))
+	assert.NoError(t, err)
+	assert.Equal(t, jsonUser{Name: "a"}, rv.Interface())
+
+	rv, err = AdaptArgValue(jsonUser{Name: "b"}, reflect.TypeOf(&jsonUser{}))
+	assert.NoError(t, err)
+	assert.Equal(t, &jsonUser{Name: "b"}, rv.Interface())
+
+	_, err = AdaptArgValue("str", reflect.TypeOf(int64(0)))
+	assert.Error(t, err)
+}
+
+func TestAdaptArgValueNumber(t *testing.T) {
+	cases := []struct {
+		arg  any
+		to   any
+		want any // nil表示返回错误
+	}{
+		{int32(7), int(0), int(7)},
+		{int64(-5), int8(0), int8(-5)},
+		{int64(127), int8(0), int8(127)},
+		{int64(128), int8(0), nil},
+		{int64(1 << 40), int32(0), nil},
+		{int64(-1 << 40), int32(0), nil},
+		{uint64(1 << 63), int64(0), nil},
+		{uint32(255), uint8(0), uint8(255)},
+		{uint32(256), uint8(0), nil},
+		{int64(-1), uint(0), nil},
+		{int8(-1), uint64(0), nil},
+		{int64(42), uint16(0), uint16(42)},
+		{float64(3), int(0), int(3)},
+		{float64(3.5), int(0), nil},
+		{float64(-2), uint(0), nil},
+		{float64(1 << 40), int32(0), nil},
+		{float64(1e20), int64(0), nil},
+		{math.NaN(), int(0), nil},
+		{math.Inf(1), int64(0), nil},
+		{float64(1e300), float32(0), nil},
+		{float64(1.5), float32(0), float32(1.5)},
+		{int64(1 << 40), float64(0), float64(1 << 40)},
+	}
+	for _, c := range cases {
+		rv, err := AdaptArgValue(c.arg, reflect.TypeOf(c.to))
+		if c.want == nil {
+			assert.Error(t, err, "%T(%v) -> %T", c.arg, c.arg, c.to)
+			continue
+		}
+		if assert.NoError(t, err, "%T(%v) -> %T", c.arg, c.arg, c.to) {
+			assert.Equal(t, c.want, rv.Interface())
+		}
+	}
+}
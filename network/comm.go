@@ -3,6 +3,7 @@ package network
 
 import (
 	"net"
+	"sync"
 )
 
 // Conn 网络代理接口
@@ -12,8 +13,50 @@ type Conn interface {
 	ReadMessage() (messageType int, p []byte, err error)
 }
 
+// HandshakeValuer 握手时带有附加数据的连接(如ws握手钩子返回的值)
+type HandshakeValuer interface {
+	HandshakeValues() map[string]string
+}
+
 // Client 代理
 type Client interface {
 	Run() error
 	OnClose() error
 }
+
+// ipConnCounter 按IP统计连接数
+type ipConnCounter struct {
+	lock  sync.Mutex
+	conns map[string]int
+}
+
+// add 增加该IP的连接数(超出max时返回false,max<=0不限制)
+func (c *ipConnCounter) add(ip string, max int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conns == nil {
+		c.conns = map[string]int{}
+	}
+	if max > 0 && c.conns[ip] >= max {
+		return false
+	}
+	c.conns[ip]++
+	return true
+}
+
+// done 减少该IP的连接数
+func (c *ipConnCounter) done(ip string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conns[ip]--; c.conns[ip] <= 0 {
+		delete(c.conns, ip)
+	}
+}
+
+// addrIP 取出地址中的IP
+func addrIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
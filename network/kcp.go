@@ -0,0 +1,631 @@
+// Package network KCP协议(ikcp的Go移植,线路格式与ikcp.c及不加密、不开FEC的kcp-go一致)
+package network
+
+import (
+	"encoding/binary"
+)
+
+// ikcp常量(与ikcp.c一致)
+const (
+	ikcpRtoNdl     = 30  // nodelay时的最小rto
+	ikcpRtoMin     = 100 // 正常模式的最小rto
+	ikcpRtoDef     = 200
+	ikcpRtoMax     = 60000
+	ikcpCmdPush    = 81 // 数据
+	ikcpCmdAck     = 82 // 确认
+	ikcpCmdWask    = 83 // 询问对方窗口大小
+	ikcpCmdWins    = 84 // 告知自己的窗口大小
+	ikcpAskSend    = 1  // 需要发送ikcpCmdWask
+	ikcpAskTell    = 2  // 需要发送ikcpCmdWins
+	ikcpWndSnd     = 32
+	ikcpWndRcv     = 128 // 不能小于最大分片数
+	ikcpMtuDef     = 1400
+	ikcpInterval   = 100
+	ikcpOverhead   = 24 // 分片头长度
+	ikcpDeadLink   = 20
+	ikcpThreshInit = 2
+	ikcpThreshMin  = 2
+	ikcpProbeInit  = 7000   // 窗口探测的初始间隔
+	ikcpProbeLimit = 120000 // 窗口探测的最大间隔
+	ikcpFastAckLim = 5      // 快速重传的最大次数
+)
+
+// ikcpSegment 分片: [conv u32][cmd u8][frg u8][wnd u16][ts u32][sn u32][una u32][len u32][data](小端序)
+type ikcpSegment struct {
+	conv     uint32
+	cmd      uint8
+	frg      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	rto      uint32
+	xmit     uint32
+	resendts uint32
+	fastack  uint32
+	data     []byte
+}
+
+// encode 把分片头写入ptr,返回剩余的空间
+func (seg *ikcpSegment) encode(ptr []byte) []byte {
+	binary.LittleEndian.PutUint32(ptr, seg.conv)
+	ptr[4] = seg.cmd
+	ptr[5] = seg.frg
+	binary.LittleEndian.PutUint16(ptr[6:], seg.wnd)
+	binary.LittleEndian.PutUint32(ptr[8:], seg.ts)
+	binary.LittleEndian.PutUint32(ptr[12:], seg.sn)
+	binary.LittleEndian.PutUint32(ptr[16:], seg.una)
+	binary.LittleEndian.PutUint32(ptr[20:], uint32(len(seg.data)))
+	return ptr[ikcpOverhead:]
+}
+
+type ikcpAck struct{ sn, ts uint32 }
+
+// ikcp KCP控制块(不是并发安全的,由KCPConn加锁调用)
+type ikcp struct {
+	conv, mtu, mss, state               uint32
+	sndUna, sndNxt, rcvNxt              uint32
+	ssthresh                            uint32
+	rxRttval, rxSrtt                    int32
+	rxRto, rxMinrto                     uint32
+	sndWnd, rcvWnd, rmtWnd, cwnd, probe uint32
+	current, interval, tsFlush, xmit    uint32
+	nodelay, updated                    uint32
+	tsProbe, probeWait                  uint32
+	deadLink, incr                      uint32
+	fastresend                          int32
+	fastlimit                           int32
+	nocwnd, stream                      int32
+
+	sndQueue []ikcpSegment
+	rcvQueue []ikcpSegment
+	sndBuf   []ikcpSegment
+	rcvBuf   []ikcpSegment
+	acklist  []ikcpAck
+	buffer   []byte
+	output   func(buf []byte) // 发送一个UDP包(buf在返回后会被复用)
+}
+
+// newIKCP conv需与对方一致
+func newIKCP(conv uint32, output func(buf []byte)) *ikcp {
+	kcp := &ikcp{
+		conv:      conv,
+		sndWnd:    ikcpWndSnd,
+		rcvWnd:    ikcpWndRcv,
+		rmtWnd:    ikcpWndRcv,
+		mtu:       ikcpMtuDef,
+		mss:       ikcpMtuDef - ikcpOverhead,
+		rxRto:     ikcpRtoDef,
+		rxMinrto:  ikcpRtoMin,
+		interval:  ikcpInterval,
+		tsFlush:   ikcpInterval,
+		ssthresh:  ikcpThreshInit,
+		fastlimit: ikcpFastAckLim,
+		deadLink:  ikcpDeadLink,
+		output:    output,
+	}
+	kcp.buffer = make([]byte, (kcp.mtu+ikcpOverhead)*3)
+	return kcp
+}
+
+func timediff(later, earlier uint32) int32 { return int32(later - earlier) }
+
+// PeekSize 下一个完整消息的长度(没有时返回-1)
+func (kcp *ikcp) PeekSize() int {
+	if len(kcp.rcvQueue) == 0 {
+		return -1
+	}
+	seg := &kcp.rcvQueue[0]
+	if seg.frg == 0 {
+		return len(seg.data)
+	}
+	if len(kcp.rcvQueue) < int(seg.frg)+1 {
+		return -1
+	}
+	length := 0
+	for k := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[k]
+		length += len(seg.data)
+		if seg.frg == 0 {
+			break
+		}
+	}
+	return length
+}
+
+// Recv 读取一个完整消息(-1没有消息,-3 buffer太小)
+func (kcp *ikcp) Recv(buffer []byte) int {
+	peeksize := kcp.PeekSize()
+	if peeksize < 0 {
+		return -1
+	}
+	if peeksize > len(buffer) {
+		return -3
+	}
+	fastRecover := len(kcp.rcvQueue) >= int(kcp.rcvWnd)
+
+	// 合并分片
+	n, count := 0, 0
+	for k := range kcp.rcvQueue {
+		seg := &kcp.rcvQueue[k]
+		n += copy(buffer[n:], seg.data)
+		count++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	kcp.rcvQueue = kcp.removeFront(kcp.rcvQueue, count)
+
+	kcp.moveRcvBuf()
+	// 接收窗口重新打开,告知对方
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) && fastRecover {
+		kcp.probe |= ikcpAskTell
+	}
+	return n
+}
+
+// moveRcvBuf 把按序到达的分片从rcvBuf移到rcvQueue
+func (kcp *ikcp) moveRcvBuf() {
+	count := 0
+	for k := range kcp.rcvBuf {
+		seg := &kcp.rcvBuf[k]
+		if seg.sn != kcp.rcvNxt || len(kcp.rcvQueue)+count >= int(kcp.rcvWnd) {
+			break
+		}
+		kcp.rcvNxt++
+		count++
+	}
+	if count > 0 {
+		kcp.rcvQueue = append(kcp.rcvQueue, kcp.rcvBuf[:count]...)
+		kcp.rcvBuf = kcp.removeFront(kcp.rcvBuf, count)
+	}
+}
+
+// Send 发送一个消息(按mss分片;-1为空消息,-2分片数过多)
+func (kcp *ikcp) Send(buffer []byte) int {
+	if len(buffer) == 0 {
+		return -1
+	}
+	// 流模式下追加到最后一个未发送的分片
+	if kcp.stream != 0 && len(kcp.sndQueue) > 0 {
+		seg := &kcp.sndQueue[len(kcp.sndQueue)-1]
+		if len(seg.data) < int(kcp.mss) {
+			extend := min(len(buffer), int(kcp.mss)-len(seg.data))
+			seg.data = append(seg.data, buffer[:extend]...)
+			buffer = buffer[extend:]
+		}
+		if len(buffer) == 0 {
+			return 0
+		}
+	}
+
+	count := (len(buffer) + int(kcp.mss) - 1) / int(kcp.mss)
+	if count > 255 || count >= int(kcp.rcvWnd) {
+		return -2
+	}
+	for i := 0; i < count; i++ {
+		size := min(len(buffer), int(kcp.mss))
+		seg := ikcpSegment{data: append([]byte(nil), buffer[:size]...)}
+		if kcp.stream == 0 {
+			seg.frg = uint8(count - i - 1)
+		}
+		kcp.sndQueue = append(kcp.sndQueue, seg)
+		buffer = buffer[size:]
+	}
+	return 0
+}
+
+func (kcp *ikcp) updateAck(rtt int32) {
+	if kcp.rxSrtt == 0 {
+		kcp.rxSrtt = rtt
+		kcp.rxRttval = rtt / 2
+	} else {
+		delta := rtt - kcp.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		kcp.rxRttval = (3*kcp.rxRttval + delta) / 4
+		kcp.rxSrtt = (7*kcp.rxSrtt + rtt) / 8
+		if kcp.rxSrtt < 1 {
+			kcp.rxSrtt = 1
+		}
+	}
+	rto := uint32(kcp.rxSrtt) + max(kcp.interval, uint32(4*kcp.rxRttval))
+	kcp.rxRto = min(max(kcp.rxMinrto, rto), ikcpRtoMax)
+}
+
+func (kcp *ikcp) shrinkBuf() {
+	if len(kcp.sndBuf) > 0 {
+		kcp.sndUna = kcp.sndBuf[0].sn
+	} else {
+		kcp.sndUna = kcp.sndNxt
+	}
+}
+
+func (kcp *ikcp) parseAck(sn uint32) {
+	if timediff(sn, kcp.sndUna) < 0 || timediff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for k := range kcp.sndBuf {
+		seg := &kcp.sndBuf[k]
+		if sn == seg.sn {
+			kcp.sndBuf = append(kcp.sndBuf[:k], kcp.sndBuf[k+1:]...)
+			break
+		}
+		if timediff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+func (kcp *ikcp) parseUna(una uint32) {
+	count := 0
+	for k := range kcp.sndBuf {
+		if timediff(una, kcp.sndBuf[k].sn) <= 0 {
+			break
+		}
+		count++
+	}
+	kcp.sndBuf = kcp.removeFront(kcp.sndBuf, count)
+}
+
+func (kcp *ikcp) parseFastack(sn uint32) {
+	if timediff(sn, kcp.sndUna) < 0 || timediff(sn, kcp.sndNxt) >= 0 {
+		return
+	}
+	for k := range kcp.sndBuf {
+		seg := &kcp.sndBuf[k]
+		if timediff(sn, seg.sn) < 0 {
+			break
+		}
+		if sn != seg.sn {
+			seg.fastack++
+		}
+	}
+}
+
+// parseData 把收到的数据分片按sn插入rcvBuf
+func (kcp *ikcp) parseData(newseg ikcpSegment) {
+	sn := newseg.sn
+	if timediff(sn, kcp.rcvNxt+kcp.rcvWnd) >= 0 || timediff(sn, kcp.rcvNxt) < 0 {
+		return
+	}
+	insert := 0
+	for k := len(kcp.rcvBuf) - 1; k >= 0; k-- {
+		seg := &kcp.rcvBuf[k]
+		if seg.sn == sn {
+			return // 重复
+		}
+		if timediff(sn, seg.sn) > 0 {
+			insert = k + 1
+			break
+		}
+	}
+	kcp.rcvBuf = append(kcp.rcvBuf, ikcpSegment{})
+	copy(kcp.rcvBuf[insert+1:], kcp.rcvBuf[insert:])
+	kcp.rcvBuf[insert] = newseg
+	kcp.moveRcvBuf()
+}
+
+// Input 处理收到的UDP包(-1 conv不符或包太短,-2长度错误,-3未知命令)
+func (kcp *ikcp) Input(data []byte) int {
+	prevUna := kcp.sndUna
+	var maxack uint32
+	flag := false
+	if len(data) < ikcpOverhead {
+		return -1
+	}
+	for len(data) >= ikcpOverhead {
+		conv := binary.LittleEndian.Uint32(data)
+		if conv != kcp.conv {
+			return -1
+		}
+		cmd := data[4]
+		frg := data[5]
+		wnd := binary.LittleEndian.Uint16(data[6:])
+		ts := binary.LittleEndian.Uint32(data[8:])
+		sn := binary.LittleEndian.Uint32(data[12:])
+		una := binary.LittleEndian.Uint32(data[16:])
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[ikcpOverhead:]
+		if uint32(len(data)) < length {
+			return -2
+		}
+		if cmd != ikcpCmdPush && cmd != ikcpCmdAck && cmd != ikcpCmdWask && cmd != ikcpCmdWins {
+			return -3
+		}
+
+		kcp.rmtWnd = uint32(wnd)
+		kcp.parseUna(una)
+		kcp.shrinkBuf()
+		switch cmd {
+		case ikcpCmdAck:
+			if timediff(kcp.current, ts) >= 0 {
+				kcp.updateAck(timediff(kcp.current, ts))
+			}
+			kcp.parseAck(sn)
+			kcp.shrinkBuf()
+			if !flag {
+				flag = true
+				maxack = sn
+			} else if timediff(sn, maxack) > 0 {
+				maxack = sn
+			}
+		case ikcpCmdPush:
+			if timediff(sn, kcp.rcvNxt+kcp.rcvWnd) < 0 {
+				kcp.acklist = append(kcp.acklist, ikcpAck{sn: sn, ts: ts})
+				if timediff(sn, kcp.rcvNxt) >= 0 {
+					kcp.parseData(ikcpSegment{conv: conv, cmd: cmd, frg: frg, wnd: wnd, ts: ts, sn: sn, una: una,
+						data: append([]byte(nil), data[:length]...)})
+				}
+			}
+		case ikcpCmdWask:
+			kcp.probe |= ikcpAskTell
+		}
+		data = data[length:]
+	}
+	if flag {
+		kcp.parseFastack(maxack)
+	}
+
+	// 拥塞窗口
+	if timediff(kcp.sndUna, prevUna) > 0 && kcp.cwnd < kcp.rmtWnd {
+		mss := kcp.mss
+		if kcp.cwnd < kcp.ssthresh {
+			kcp.cwnd++
+			kcp.incr += mss
+		} else {
+			if kcp.incr < mss {
+				kcp.incr = mss
+			}
+			kcp.incr += (mss*mss)/kcp.incr + (mss / 16)
+			if (kcp.cwnd+1)*mss <= kcp.incr {
+				kcp.cwnd = (kcp.incr + mss - 1) / mss
+			}
+		}
+		if kcp.cwnd > kcp.rmtWnd {
+			kcp.cwnd = kcp.rmtWnd
+			kcp.incr = kcp.rmtWnd * mss
+		}
+	}
+	return 0
+}
+
+func (kcp *ikcp) wndUnused() uint16 {
+	if len(kcp.rcvQueue) < int(kcp.rcvWnd) {
+		return uint16(int(kcp.rcvWnd) - len(kcp.rcvQueue))
+	}
+	return 0
+}
+
+// flush 发送ack、窗口探测及数据分片
+func (kcp *ikcp) flush() {
+	if kcp.updated == 0 {
+		return
+	}
+	current := kcp.current
+	seg := ikcpSegment{conv: kcp.conv, cmd: ikcpCmdAck, wnd: kcp.wndUnused(), una: kcp.rcvNxt}
+	buffer := kcp.buffer
+	ptr := buffer
+	// 剩余空间不足size时先发送已写入的部分
+	makeSpace := func(size int) {
+		if len(buffer)-len(ptr)+size > int(kcp.mtu) {
+			kcp.output(buffer[:len(buffer)-len(ptr)])
+			ptr = buffer
+		}
+	}
+
+	for _, ack := range kcp.acklist {
+		makeSpace(ikcpOverhead)
+		seg.sn, seg.ts = ack.sn, ack.ts
+		ptr = seg.encode(ptr)
+	}
+	kcp.acklist = kcp.acklist[:0]
+
+	// 对方窗口为0时定时探测
+	if kcp.rmtWnd == 0 {
+		if kcp.probeWait == 0 {
+			kcp.probeWait = ikcpProbeInit
+			kcp.tsProbe = current + kcp.probeWait
+		} else if timediff(current, kcp.tsProbe) >= 0 {
+			if kcp.probeWait < ikcpProbeInit {
+				kcp.probeWait = ikcpProbeInit
+			}
+			kcp.probeWait += kcp.probeWait / 2
+			if kcp.probeWait > ikcpProbeLimit {
+				kcp.probeWait = ikcpProbeLimit
+			}
+			kcp.tsProbe = current + kcp.probeWait
+			kcp.probe |= ikcpAskSend
+		}
+	} else {
+		kcp.tsProbe = 0
+		kcp.probeWait = 0
+	}
+	if kcp.probe&ikcpAskSend != 0 {
+		seg.cmd = ikcpCmdWask
+		makeSpace(ikcpOverhead)
+		ptr = seg.encode(ptr)
+	}
+	if kcp.probe&ikcpAskTell != 0 {
+		seg.cmd = ikcpCmdWins
+		makeSpace(ikcpOverhead)
+		ptr = seg.encode(ptr)
+	}
+	kcp.probe = 0
+
+	// 发送窗口
+	cwnd := min(kcp.sndWnd, kcp.rmtWnd)
+	if kcp.nocwnd == 0 {
+		cwnd = min(kcp.cwnd, cwnd)
+	}
+	// 从sndQueue移入sndBuf
+	count := 0
+	for k := range kcp.sndQueue {
+		if timediff(kcp.sndNxt, kcp.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg := kcp.sndQueue[k]
+		newseg.conv = kcp.conv
+		newseg.cmd = ikcpCmdPush
+		newseg.sn = kcp.sndNxt
+		kcp.sndBuf = append(kcp.sndBuf, newseg)
+		kcp.sndNxt++
+		count++
+	}
+	kcp.sndQueue = kcp.removeFront(kcp.sndQueue, count)
+
+	resent := uint32(kcp.fastresend)
+	if kcp.fastresend <= 0 {
+		resent = 0xffffffff
+	}
+	var rtomin uint32
+	if kcp.nodelay == 0 {
+		rtomin = kcp.rxRto >> 3
+	}
+
+	change, lost := false, false
+	for k := range kcp.sndBuf {
+		segment := &kcp.sndBuf[k]
+		needsend := false
+		if segment.xmit == 0 {
+			needsend = true
+			segment.xmit++
+			segment.rto = kcp.rxRto
+			segment.resendts = current + segment.rto + rtomin
+		} else if timediff(current, segment.resendts) >= 0 {
+			needsend = true
+			segment.xmit++
+			kcp.xmit++
+			if kcp.nodelay == 0 {
+				segment.rto += max(segment.rto, kcp.rxRto)
+			} else {
+				step := segment.rto
+				if kcp.nodelay >= 2 {
+					step = kcp.rxRto
+				}
+				segment.rto += step / 2
+			}
+			segment.resendts = current + segment.rto
+			lost = true
+		} else if segment.fastack >= resent {
+			if segment.xmit <= uint32(kcp.fastlimit) || kcp.fastlimit <= 0 {
+				needsend = true
+				segment.xmit++
+				segment.fastack = 0
+				segment.resendts = current + segment.rto
+				change = true
+			}
+		}
+
+		if needsend {
+			segment.ts = current
+			segment.wnd = seg.wnd
+			segment.una = kcp.rcvNxt
+			makeSpace(ikcpOverhead + len(segment.data))
+			ptr = segment.encode(ptr)
+			ptr = ptr[copy(ptr, segment.data):]
+			if segment.xmit >= kcp.deadLink {
+				kcp.state = 0xffffffff
+			}
+		}
+	}
+	if n := len(buffer) - len(ptr); n > 0 {
+		kcp.output(buffer[:n])
+	}
+
+	// 更新ssthresh
+	if change {
+		inflight := kcp.sndNxt - kcp.sndUna
+		kcp.ssthresh = max(inflight/2, ikcpThreshMin)
+		kcp.cwnd = kcp.ssthresh + resent
+		kcp.incr = kcp.cwnd * kcp.mss
+	}
+	if lost {
+		kcp.ssthresh = max(cwnd/2, ikcpThreshMin)
+		kcp.cwnd = 1
+		kcp.incr = kcp.mss
+	}
+	if kcp.cwnd < 1 {
+		kcp.cwnd = 1
+		kcp.incr = kcp.mss
+	}
+}
+
+// Update 按interval定时调用(current为毫秒时间)
+func (kcp *ikcp) Update(current uint32) {
+	kcp.current = current
+	if kcp.updated == 0 {
+		kcp.updated = 1
+		kcp.tsFlush = current
+	}
+	slap := timediff(current, kcp.tsFlush)
+	if slap >= 10000 || slap < -10000 {
+		kcp.tsFlush = current
+		slap = 0
+	}
+	if slap >= 0 {
+		kcp.tsFlush += kcp.interval
+		if timediff(current, kcp.tsFlush) >= 0 {
+			kcp.tsFlush = current + kcp.interval
+		}
+		kcp.flush()
+	}
+}
+
+// SetMtu 设置mtu(-1 mtu太小)
+func (kcp *ikcp) SetMtu(mtu int) int {
+	if mtu < 50 || mtu < ikcpOverhead {
+		return -1
+	}
+	kcp.mtu = uint32(mtu)
+	kcp.mss = kcp.mtu - ikcpOverhead
+	kcp.buffer = make([]byte, (mtu+ikcpOverhead)*3)
+	return 0
+}
+
+// NoDelay 快速模式: nodelay是否启用,interval内部更新间隔(ms),resend快速重传的ack跨越次数,nc是否关闭拥塞控制
+func (kcp *ikcp) NoDelay(nodelay, interval, resend, nc int) {
+	if nodelay >= 0 {
+		kcp.nodelay = uint32(nodelay)
+		if nodelay != 0 {
+			kcp.rxMinrto = ikcpRtoNdl
+		} else {
+			kcp.rxMinrto = ikcpRtoMin
+		}
+	}
+	if interval >= 0 {
+		kcp.interval = uint32(min(max(interval, 10), 5000))
+	}
+	if resend >= 0 {
+		kcp.fastresend = int32(resend)
+	}
+	if nc >= 0 {
+		kcp.nocwnd = int32(nc)
+	}
+}
+
+// WndSize 设置发送和接收窗口(分片数)
+func (kcp *ikcp) WndSize(sndwnd, rcvwnd int) {
+	if sndwnd > 0 {
+		kcp.sndWnd = uint32(sndwnd)
+	}
+	if rcvwnd > 0 {
+		kcp.rcvWnd = uint32(max(rcvwnd, ikcpWndRcv))
+	}
+}
+
+// WaitSnd 等待发送的分片数
+func (kcp *ikcp) WaitSnd() int { return len(kcp.sndBuf) + len(kcp.sndQueue) }
+
+// removeFront 删除前count个分片(复用底层数组)
+func (kcp *ikcp) removeFront(q []ikcpSegment, count int) []ikcpSegment {
+	if count == 0 {
+		return q
+	}
+	newn := copy(q, q[count:])
+	for k := newn; k < len(q); k++ {
+		q[k] = ikcpSegment{} // 释放data
+	}
+	return q[:newn]
+}
@@ -0,0 +1,304 @@
+// Package network 可靠UDP连接(KCP协议)
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// 协议: 标准KCP(见kcp.go),线路格式与ikcp.c及kcp-go(不加密、不开FEC,即kcp.DialWithOptions(addr, nil, 0, 0))兼容,
+// 每个UDP包包含一个或多个KCP分片,conv由客户端随机生成。使用快速模式(nodelay=1,interval=10ms,resend=2,nc=1),
+// 客户端建议使用相同设置(kcp-go: SetNoDelay(1, 10, 2, 1)),并用SetWindowSize设置合适的窗口。
+// KCP没有握手和关闭: 服务器收到sn为0的数据分片时建立连接,连接断开由gate的心跳超时检测
+const (
+	kcpMTU      = ikcpMtuDef            // 单个UDP包的最大长度
+	kcpMSS      = kcpMTU - ikcpOverhead // 单个分片的最大数据长度
+	kcpMTULimit = 1500                  // 读取UDP包的缓冲大小
+	kcpWndSize  = 256                   // 发送/接收窗口(分片数)
+	kcpInterval = 10                    // 内部更新间隔(ms)
+)
+
+var (
+	errKCPClosed   = errors.New("kcp conn closed")
+	errKCPDeadLink = errors.New("kcp conn dead link")
+)
+
+// kcpRefTime kcp的毫秒时钟起点
+var kcpRefTime = time.Now()
+
+func kcpCurrentMs() uint32 { return uint32(time.Since(kcpRefTime) / time.Millisecond) }
+
+// KCPConn 可靠UDP连接(按序可靠的字节流,与TCPConn一样按流读取数据包)
+type KCPConn struct {
+	local   net.Addr
+	remote  net.Addr
+	output  func([]byte) error // 发送一个UDP包
+	onClose func()             // 连接关闭时回调
+
+	writeLock sync.Mutex // 保证一次Write的分片连续
+	lock      sync.Mutex // 保护以下字段
+	kcp       *ikcp
+	pending   []byte // 已收到的消息中未读取的部分
+	readDL    time.Time
+	writeDL   time.Time
+	err       error // 连接关闭原因
+
+	readEvent  chan struct{}
+	writeEvent chan struct{}
+	die        chan struct{}
+	closeOnce  sync.Once
+}
+
+func newKCPConn(conv uint32, local, remote net.Addr, output func([]byte) error, onClose func()) *KCPConn {
+	c := &KCPConn{
+		local:      local,
+		remote:     remote,
+		output:     output,
+		onClose:    onClose,
+		readEvent:  make(chan struct{}, 1),
+		writeEvent: make(chan struct{}, 1),
+		die:        make(chan struct{}),
+	}
+	c.kcp = newIKCP(conv, func(buf []byte) { _ = c.output(buf) })
+	c.kcp.NoDelay(1, kcpInterval, 2, 1)
+	c.kcp.WndSize(kcpWndSize, kcpWndSize)
+	c.kcp.SetMtu(kcpMTU)
+	go c.updateLoop()
+	return c
+}
+
+// DialKCP 连接KCPServer(客户端及测试使用;也可以使用kcp-go等标准KCP实现)
+func DialKCP(addr string) (*KCPConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udp, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		udp.Close()
+		return nil, err
+	}
+	c := newKCPConn(binary.LittleEndian.Uint32(buf), udp.LocalAddr(), udp.RemoteAddr(),
+		func(b []byte) error {
+			_, err := udp.Write(b)
+			return err
+		},
+		func() { udp.Close() })
+	go func() {
+		buf := make([]byte, kcpMTULimit)
+		for {
+			n, err := udp.Read(buf)
+			if err != nil {
+				c.closeWith(err)
+				return
+			}
+			c.input(buf[:n])
+		}
+	}()
+	return c, nil
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// input 处理收到的UDP包
+func (c *KCPConn) input(data []byte) {
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return
+	}
+	c.kcp.current = kcpCurrentMs()
+	c.kcp.Input(data)
+	readable := c.kcp.PeekSize() >= 0
+	writable := c.kcp.WaitSnd() < int(c.kcp.sndWnd)
+	c.lock.Unlock()
+
+	if readable {
+		notify(c.readEvent)
+	}
+	if writable {
+		notify(c.writeEvent)
+	}
+}
+
+// updateLoop 定时更新kcp(发送ack、重传)
+func (c *KCPConn) updateLoop() {
+	ticker := time.NewTicker(kcpInterval * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.die:
+			return
+		case <-ticker.C:
+		}
+		c.lock.Lock()
+		c.kcp.Update(kcpCurrentMs())
+		dead := c.kcp.state == 0xffffffff
+		writable := c.kcp.WaitSnd() < int(c.kcp.sndWnd)
+		c.lock.Unlock()
+		if dead {
+			c.closeWith(errKCPDeadLink)
+			return
+		}
+		if writable {
+			notify(c.writeEvent)
+		}
+	}
+}
+
+// wait 等待事件或超时
+func (c *KCPConn) wait(event chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-event:
+	case <-c.die:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// Read 读取按序到达的数据
+func (c *KCPConn) Read(b []byte) (int, error) {
+	for {
+		c.lock.Lock()
+		if len(c.pending) > 0 {
+			n := copy(b, c.pending)
+			c.pending = c.pending[n:]
+			c.lock.Unlock()
+			return n, nil
+		}
+		if size := c.kcp.PeekSize(); size >= 0 {
+			// 读取一个完整消息,b放不下的部分留到下次读取
+			msg := b
+			if size > len(b) {
+				msg = make([]byte, size)
+			}
+			n := c.kcp.Recv(msg)
+			if size > len(b) {
+				n = copy(b, msg)
+				c.pending = msg[n:]
+			}
+			c.lock.Unlock()
+			if n == 0 { // 空消息
+				continue
+			}
+			return n, nil
+		}
+		err, deadline := c.err, c.readDL
+		c.lock.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		if err := c.wait(c.readEvent, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write 按mss分片发送(发送窗口满时阻塞)
+func (c *KCPConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	for sent := 0; sent < len(b); {
+		c.lock.Lock()
+		if c.err != nil {
+			err := c.err
+			c.lock.Unlock()
+			return sent, err
+		}
+		if c.kcp.WaitSnd() >= int(c.kcp.sndWnd) {
+			deadline := c.writeDL
+			c.lock.Unlock()
+			if err := c.wait(c.writeEvent, deadline); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		end := min(sent+int(c.kcp.mss), len(b))
+		c.kcp.Send(b[sent:end])
+		c.kcp.current = kcpCurrentMs()
+		c.kcp.flush()
+		c.lock.Unlock()
+		sent = end
+	}
+	return len(b), nil
+}
+
+// closeWith 关闭连接(KCP没有关闭通知,对方通过超时检测)
+func (c *KCPConn) closeWith(err error) {
+	c.closeOnce.Do(func() {
+		c.lock.Lock()
+		c.err = err
+		c.lock.Unlock()
+		close(c.die)
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+}
+
+// Close 关闭连接
+func (c *KCPConn) Close() error {
+	c.closeWith(errKCPClosed)
+	return nil
+}
+
+// kcp not support ReadMessage
+func (c *KCPConn) ReadMessage() (messageType int, p []byte, err error) {
+	return 0, nil, fmt.Errorf("not impl")
+}
+
+// LocalAddr 本地socket端口地址
+func (c *KCPConn) LocalAddr() net.Addr { return c.local }
+
+// RemoteAddr 远程socket端口地址
+func (c *KCPConn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline A zero value for t means I/O operations will not time out.
+func (c *KCPConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+func (c *KCPConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.readDL = t
+	c.lock.Unlock()
+	notify(c.readEvent)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+func (c *KCPConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.writeDL = t
+	c.lock.Unlock()
+	notify(c.writeEvent)
+	return nil
+}
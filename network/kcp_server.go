@@ -0,0 +1,169 @@
+// Package network 可靠UDP(KCP)服务器
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/cloudapex/river/log"
+)
+
+// kcpDefaultMaxConn 未设置MaxConnNum时的连接数上限
+const kcpDefaultMaxConn = 10000
+
+// KCPServer 可靠UDP服务器(标准KCP协议,按远程地址区分连接,见kcp_conn.go)
+// KCP没有握手,伪造源地址的UDP包也能建立连接,由MaxConnNum/MaxConnPerIP限制,未发送心跳的连接由gate超时关闭
+type KCPServer struct {
+	Addr       string
+	MaxConnNum int // 最大连接数(<=0时为kcpDefaultMaxConn)
+	NewAgent   func(*KCPConn) Client
+	conn       *net.UDPConn
+	lock       sync.Mutex
+	conns      map[string]*KCPConn // 远程地址 -> 连接
+	wgLn       sync.WaitGroup
+	wgConns    sync.WaitGroup
+
+	MaxConnPerIP int // 单个IP允许的最大连接数(0不限制)
+	ipConns      ipConnCounter
+}
+
+// Start 开始udp监听
+func (server *KCPServer) Start() {
+	server.init()
+	log.Info("KCP Listen :%s", server.Addr)
+	go server.run()
+}
+
+func (server *KCPServer) init() {
+	addr, err := net.ResolveUDPAddr("udp", server.Addr)
+	if err != nil {
+		log.Error("%v", err)
+		panic(fmt.Sprintf("KCPServer.Start.Resolve err:%v", err))
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Error("%v", err)
+		panic(fmt.Sprintf("KCPServer.Start.Listen err:%v", err))
+	}
+	if server.NewAgent == nil {
+		log.Error("NewConnAgent must not be nil")
+		panic(fmt.Sprintf("KCPServer.NewConnAgent must not be nil"))
+	}
+	if server.MaxConnNum <= 0 {
+		server.MaxConnNum = kcpDefaultMaxConn
+	}
+	server.conn = conn
+	server.conns = map[string]*KCPConn{}
+}
+
+// kcpFirstSegment 是否为客户端的第一个数据分片(只有它能建立连接,忽略已关闭连接的重传和ack)
+func kcpFirstSegment(data []byte) bool {
+	return len(data) >= ikcpOverhead && data[4] == ikcpCmdPush && binary.LittleEndian.Uint32(data[12:]) == 0
+}
+
+// LocalAddr 监听地址(Addr端口为0时获取实际端口)
+func (server *KCPServer) LocalAddr() net.Addr { return server.conn.LocalAddr() }
+
+func (server *KCPServer) run() {
+	server.wgLn.Add(1)
+	defer server.wgLn.Done()
+
+	buf := make([]byte, kcpMTULimit)
+	for {
+		n, addr, err := server.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		if n < ikcpOverhead {
+			continue
+		}
+		key := addr.String()
+		conv := binary.LittleEndian.Uint32(buf)
+		server.lock.Lock()
+		kcpConn := server.conns[key]
+		server.lock.Unlock()
+		if kcpConn != nil && kcpConn.kcp.conv != conv && kcpFirstSegment(buf[:n]) {
+			kcpConn.Close() // 客户端用同一地址重新建立连接
+			kcpConn = nil
+		}
+		if kcpConn == nil {
+			if !kcpFirstSegment(buf[:n]) {
+				continue
+			}
+			if kcpConn = server.accept(addr, conv); kcpConn == nil {
+				continue
+			}
+		}
+		kcpConn.input(buf[:n])
+	}
+}
+
+// accept 建立新连接并启动agent
+func (server *KCPServer) accept(addr *net.UDPAddr, conv uint32) *KCPConn {
+	key := addr.String()
+	server.lock.Lock()
+	current := len(server.conns)
+	server.lock.Unlock()
+	if current >= server.MaxConnNum {
+		log.Warning("KCP Server reach max connection number:%d, current:%d", server.MaxConnNum, current)
+		return nil
+	}
+	ip := addrIP(key)
+	if !server.ipConns.add(ip, server.MaxConnPerIP) {
+		log.Warning("KCP Server reach max connection number per ip:%d, ip:%s", server.MaxConnPerIP, ip)
+		return nil
+	}
+
+	var kcpConn *KCPConn
+	kcpConn = newKCPConn(conv, server.conn.LocalAddr(), addr,
+		func(b []byte) error {
+			_, err := server.conn.WriteToUDP(b, addr)
+			return err
+		},
+		func() {
+			server.lock.Lock()
+			if server.conns[key] == kcpConn {
+				delete(server.conns, key)
+			}
+			server.lock.Unlock()
+		})
+	server.lock.Lock()
+	server.conns[key] = kcpConn
+	server.lock.Unlock()
+
+	agent := server.NewAgent(kcpConn)
+	server.wgConns.Add(1)
+	go func() {
+		defer func() {
+			server.ipConns.done(ip)
+			server.wgConns.Done()
+		}()
+		agent.Run()
+
+		// cleanup
+		kcpConn.Close()
+		agent.OnClose()
+	}()
+	return kcpConn
+}
+
+// Close 关闭UDP监听
+func (server *KCPServer) Close() {
+	server.lock.Lock()
+	conns := make([]*KCPConn, 0, len(server.conns))
+	for _, c := range server.conns {
+		conns = append(conns, c)
+	}
+	server.lock.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+	server.wgConns.Wait()
+	server.conn.Close()
+	server.wgLn.Wait()
+}
@@ -0,0 +1,255 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// kcpEchoAgent 把收到的数据原样写回
+type kcpEchoAgent struct{ conn *KCPConn }
+
+func (a *kcpEchoAgent) Run() error {
+	_, err := io.Copy(a.conn, a.conn)
+	return err
+}
+
+func (a *kcpEchoAgent) OnClose() error { return nil }
+
+func newTestKCPServer(t *testing.T, maxConn int) (*KCPServer, *atomic.Int32) {
+	accepted := &atomic.Int32{}
+	server := &KCPServer{Addr: "127.0.0.1:0", MaxConnNum: maxConn, NewAgent: func(c *KCPConn) Client {
+		accepted.Add(1)
+		return &kcpEchoAgent{conn: c}
+	}}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, accepted
+}
+
+// lossyProxy 在客户端和服务器之间转发UDP包,每个方向每drop个包丢弃一个
+func lossyProxy(t *testing.T, server net.Addr, drop int) (string, *atomic.Int32) {
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	upstream, err := net.DialUDP("udp", nil, server.(*net.UDPAddr))
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close(); upstream.Close() })
+
+	dropped := &atomic.Int32{}
+	var lock sync.Mutex
+	var client *net.UDPAddr
+	go func() {
+		buf := make([]byte, kcpMTULimit)
+		for i := 1; ; i++ {
+			n, addr, err := ln.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			client = addr
+			lock.Unlock()
+			if i%drop == 0 {
+				dropped.Add(1)
+				continue
+			}
+			upstream.Write(buf[:n])
+		}
+	}()
+	go func() {
+		buf := make([]byte, kcpMTULimit)
+		for i := 1; ; i++ {
+			n, err := upstream.Read(buf)
+			if err != nil {
+				return
+			}
+			if i%drop == 0 {
+				dropped.Add(1)
+				continue
+			}
+			lock.Lock()
+			addr := client
+			lock.Unlock()
+			ln.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return ln.LocalAddr().String(), dropped
+}
+
+func TestKCPEcho(t *testing.T) {
+	server, accepted := newTestKCPServer(t, 0)
+	conn, err := DialKCP(server.LocalAddr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	msg := []byte("hello kcp")
+	_, err = conn.Write(msg)
+	assert.NoError(t, err)
+	got := make([]byte, len(msg))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, got)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, got)
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestKCPRetransmit(t *testing.T) {
+	server, _ := newTestKCPServer(t, 0)
+	addr, dropped := lossyProxy(t, server.LocalAddr(), 5)
+	conn, err := DialKCP(addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// 多个分片,丢包后按序完整到达
+	data := make([]byte, 64*kcpMSS+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	go conn.Write(data)
+	got := make([]byte, len(data))
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	_, err = io.ReadFull(conn, got)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	assert.Greater(t, dropped.Load(), int32(10))
+}
+
+func TestKCPWireFormat(t *testing.T) {
+	server, accepted := newTestKCPServer(t, 0)
+	udp, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	assert.NoError(t, err)
+	defer udp.Close()
+	recv := func() []byte {
+		buf := make([]byte, kcpMTULimit)
+		udp.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := udp.Read(buf)
+		if err != nil {
+			return nil
+		}
+		return buf[:n]
+	}
+
+	// 不是第一个数据分片的包不能建立连接
+	ack := []byte{
+		0x04, 0x03, 0x02, 0x01, // conv
+		ikcpCmdAck, 0, 128, 0, // cmd frg wnd
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // ts sn una len
+	}
+	udp.Write(ack)
+	udp.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = udp.Read(make([]byte, kcpMTULimit))
+	assert.Error(t, err)
+	assert.Equal(t, int32(0), accepted.Load())
+
+	// ikcp.c编码的第一个数据分片
+	push := []byte{
+		0x04, 0x03, 0x02, 0x01, // conv
+		ikcpCmdPush, 0, 128, 0, // cmd frg wnd
+		0x10, 0, 0, 0, // ts
+		0, 0, 0, 0, // sn
+		0, 0, 0, 0, // una
+		5, 0, 0, 0, // len
+		'h', 'e', 'l', 'l', 'o',
+	}
+	udp.Write(push)
+	var acked, echoed bool
+	for !(acked && echoed) {
+		pkt := recv()
+		if !assert.NotNil(t, pkt) {
+			return
+		}
+		for len(pkt) >= ikcpOverhead {
+			assert.Equal(t, uint32(0x01020304), binary.LittleEndian.Uint32(pkt))
+			length := binary.LittleEndian.Uint32(pkt[20:])
+			switch pkt[4] {
+			case ikcpCmdAck:
+				acked = true
+				assert.Equal(t, uint32(0x10), binary.LittleEndian.Uint32(pkt[8:])) // 回显ts
+				assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(pkt[12:]))   // sn
+				assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(pkt[16:]))   // una
+			case ikcpCmdPush:
+				echoed = true
+				assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(pkt[12:]))
+				assert.Equal(t, "hello", string(pkt[ikcpOverhead:ikcpOverhead+length]))
+			}
+			pkt = pkt[ikcpOverhead+length:]
+		}
+	}
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestKCPServerLimits(t *testing.T) {
+	server, accepted := newTestKCPServer(t, 1)
+	conn, err := DialKCP(server.LocalAddr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("a"))
+	assert.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, make([]byte, 1))
+	assert.NoError(t, err)
+
+	// 超过MaxConnNum的连接不被接受
+	over, err := DialKCP(server.LocalAddr().String())
+	assert.NoError(t, err)
+	defer over.Close()
+	over.Write([]byte("b"))
+	over.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err = over.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), accepted.Load())
+}
+
+func TestIKCPMessages(t *testing.T) {
+	// 两个kcp之间互相投递,随机丢弃30%的包
+	var a, b *ikcp
+	var pipeAB, pipeBA [][]byte
+	rnd := rand.New(rand.NewSource(1))
+	lossy := func(pipe *[][]byte) func([]byte) {
+		return func(buf []byte) {
+			if rnd.Intn(10) < 3 {
+				return
+			}
+			*pipe = append(*pipe, append([]byte(nil), buf...))
+		}
+	}
+	a = newIKCP(7, lossy(&pipeAB))
+	b = newIKCP(7, lossy(&pipeBA))
+	for _, k := range []*ikcp{a, b} {
+		k.NoDelay(1, 10, 2, 1)
+	}
+
+	// 超过mss的消息分片发送,接收方按消息读取
+	msgs := [][]byte{[]byte("short"), bytes.Repeat([]byte("x"), 3*ikcpMtuDef), []byte("tail")}
+	for _, m := range msgs {
+		assert.Equal(t, 0, a.Send(m))
+	}
+	var got [][]byte
+	for now := uint32(0); now < 10000 && (len(got) < len(msgs) || a.WaitSnd() > 0); now += 10 {
+		a.Update(now)
+		b.Update(now)
+		for _, p := range pipeAB {
+			b.current = now
+			assert.Equal(t, 0, b.Input(p))
+		}
+		for _, p := range pipeBA {
+			a.current = now
+			assert.Equal(t, 0, a.Input(p))
+		}
+		pipeAB, pipeBA = pipeAB[:0], pipeBA[:0]
+		for size := b.PeekSize(); size >= 0; size = b.PeekSize() {
+			buf := make([]byte, size)
+			assert.Equal(t, size, b.Recv(buf))
+			got = append(got, buf)
+		}
+	}
+	assert.Equal(t, msgs, got)
+	assert.Equal(t, 0, a.WaitSnd())
+}
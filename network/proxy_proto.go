@@ -0,0 +1,178 @@
+// Package network PROXY protocol(v1/v2)解析
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudapex/river/tools/iptool"
+)
+
+// proxyHeaderTimeout 读取PROXY头的超时时间
+const proxyHeaderTimeout = 10 * time.Second
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// newProxyListener 解析PROXY protocol头的监听器
+// trusted为空时所有连接都必须带PROXY头;否则只有来自可信代理的连接必须带,其他连接按直连处理
+func newProxyListener(ln net.Listener, trusted *iptool.TrustedProxies) net.Listener {
+	return &proxyListener{Listener: ln, trusted: trusted}
+}
+
+type proxyListener struct {
+	net.Listener
+	trusted *iptool.TrustedProxies
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted.Empty() && !l.trusted.Contains(conn.RemoteAddr().String()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn 第一次读取或获取地址时解析PROXY头(不阻塞Accept)
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.err = fmt.Errorf("proxy protocol: %v", c.err)
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr PROXY头中的客户端地址(LOCAL命令或UNKNOWN协议时为直连地址)
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader 读取PROXY头(v1或v2),返回客户端地址(无地址信息时返回nil)
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(sig, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, fmt.Errorf("header not found")
+}
+
+// readProxyV1 "PROXY TCP4 src dst sport dport\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 { // v1头最长107字节
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("v1 header too long")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid v1 header %q", line)
+	}
+	// 地址需与协议一致(TCP4为点分十进制,TCP6为冒号格式)
+	v6 := fields[1] == "TCP6"
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if src == nil || dst == nil || strings.Contains(fields[2], ":") != v6 || strings.Contains(fields[3], ":") != v6 {
+		return nil, fmt.Errorf("invalid v1 address %q", line)
+	}
+	port, err := parseProxyPort(fields[4])
+	if err == nil {
+		_, err = parseProxyPort(fields[5])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 port %q", line)
+	}
+	return &net.TCPAddr{IP: src, Port: port}, nil
+}
+
+func parseProxyPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 || s[0] == '+' || s[0] == '-' {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// readProxyV2 [12字节签名][ver_cmd][fam][uint16 len][地址][TLV](大端序)
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[12]>>4 != 2 {
+		return nil, fmt.Errorf("invalid v2 version %d", head[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(head[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	switch head[12] & 0x0F {
+	case 0x00: // LOCAL: 代理自身的连接(如健康检查)
+		return nil, nil
+	case 0x01: // PROXY
+	default:
+		return nil, fmt.Errorf("invalid v2 command %d", head[12]&0x0F)
+	}
+	switch head[13] >> 4 {
+	case 0x1: // AF_INET
+		if len(body) < 12 {
+			return nil, fmt.Errorf("v2 ipv4 address too short")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}, nil
+	case 0x2: // AF_INET6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("v2 ipv6 address too short")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}, nil
+	}
+	return nil, nil // AF_UNSPEC/AF_UNIX不携带ip地址
+}
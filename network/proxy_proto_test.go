@@ -0,0 +1,125 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/cloudapex/river/tools/iptool"
+	"github.com/stretchr/testify/assert"
+)
+
+// proxyV2 构造v2头: cmd(0 LOCAL/1 PROXY),fam(高4位地址族),body为地址及TLV
+func proxyV2(cmd, fam byte, body []byte) string {
+	head := append([]byte{}, proxyV2Signature...)
+	head = append(head, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(head[14:], uint16(len(body)))
+	return string(append(head, body...))
+}
+
+func proxyV2Addr(src, dst net.IP, sport, dport uint16) []byte {
+	body := append(append([]byte{}, src...), dst...)
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16(body, sport), dport)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v4 := proxyV2Addr(net.IPv4(10, 0, 0, 1).To4(), net.IPv4(10, 0, 0, 2).To4(), 5000, 443)
+	v6 := proxyV2Addr(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 6000, 443)
+	cases := []struct {
+		name   string
+		header string
+		addr   string // 空表示没有地址信息(使用直连地址)
+		err    bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 192.168.1.1 192.168.1.2 5000 443\r\n", "192.168.1.1:5000", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 6000 443\r\n", "[2001:db8::1]:6000", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"v1 unknown with addr", "PROXY UNKNOWN 192.168.1.1 192.168.1.2 5000 443\r\n", "", false},
+		{"v1 tcp4 with ipv6", "PROXY TCP4 2001:db8::1 2001:db8::2 6000 443\r\n", "", true},
+		{"v1 tcp6 with ipv4", "PROXY TCP6 192.168.1.1 192.168.1.2 5000 443\r\n", "", true},
+		{"v1 bad ip", "PROXY TCP4 192.168.1 192.168.1.2 5000 443\r\n", "", true},
+		{"v1 bad port", "PROXY TCP4 192.168.1.1 192.168.1.2 70000 443\r\n", "", true},
+		{"v1 bad dst port", "PROXY TCP4 192.168.1.1 192.168.1.2 5000 x\r\n", "", true},
+		{"v1 signed port", "PROXY TCP4 192.168.1.1 192.168.1.2 +50 443\r\n", "", true},
+		{"v1 missing fields", "PROXY TCP4 192.168.1.1 192.168.1.2 5000\r\n", "", true},
+		{"v1 bad proto", "PROXY UDP4 192.168.1.1 192.168.1.2 5000 443\r\n", "", true},
+		{"v1 no crlf", "PROXY TCP4 192.168.1.1 192.168.1.2 5000 443\n", "", true},
+		{"v1 too long", "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n", "", true},
+		{"v1 truncated", "PROXY TCP4 192.168.1.1", "", true},
+		{"v2 tcp4", proxyV2(1, 0x11, v4), "10.0.0.1:5000", false},
+		{"v2 tcp6", proxyV2(1, 0x21, v6), "[2001:db8::1]:6000", false},
+		{"v2 tcp4 with tlv", proxyV2(1, 0x11, append(v4, 0x04, 0, 1, 'x')), "10.0.0.1:5000", false},
+		{"v2 local", proxyV2(0, 0x00, nil), "", false},
+		{"v2 local with addr", proxyV2(0, 0x11, v4), "", false},
+		{"v2 unspec", proxyV2(1, 0x00, nil), "", false},
+		{"v2 unix", proxyV2(1, 0x31, make([]byte, 216)), "", false},
+		{"v2 bad command", proxyV2(2, 0x11, v4), "", true},
+		{"v2 bad version", strings.Replace(proxyV2(1, 0x11, v4), "\x21", "\x11", 1), "", true},
+		{"v2 ipv4 too short", proxyV2(1, 0x11, v4[:8]), "", true},
+		{"v2 ipv6 too short", proxyV2(1, 0x21, v6[:20]), "", true},
+		{"v2 truncated head", proxyV2(1, 0x11, v4)[:14], "", true},
+		{"v2 truncated body", proxyV2(1, 0x11, v4)[:20], "", true},
+		{"bad signature", "\r\n\r\n\x00\r\nQUIX\n" + "\x21\x11\x00\x0c" + string(v4), "", true},
+		{"no header", "GET / HTTP/1.1\r\n\r\n", "", true},
+		{"short", "PROX", "", true},
+	}
+	for _, c := range cases {
+		r := bufio.NewReader(strings.NewReader(c.header + "payload"))
+		addr, err := readProxyHeader(r)
+		if c.err {
+			assert.Error(t, err, c.name)
+			continue
+		}
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		if c.addr == "" {
+			assert.Nil(t, addr, c.name)
+		} else if assert.NotNil(t, addr, c.name) {
+			assert.Equal(t, c.addr, addr.String(), c.name)
+		}
+		// 头之后的数据原样保留
+		rest, _ := io.ReadAll(r)
+		assert.Equal(t, "payload", string(rest), c.name)
+	}
+}
+
+func TestProxyListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	accept := func(trusted *iptool.TrustedProxies, data string) (net.Addr, string, error) {
+		pl := newProxyListener(ln, trusted)
+		client, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		defer client.Close()
+		client.Write([]byte(data))
+		client.(*net.TCPConn).CloseWrite()
+		conn, err := pl.Accept()
+		assert.NoError(t, err)
+		defer conn.Close()
+		body, err := io.ReadAll(conn)
+		return conn.RemoteAddr(), string(body), err
+	}
+
+	addr, body, err := accept(nil, "PROXY TCP4 192.168.1.1 192.168.1.2 5000 443\r\nhello")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.1:5000", addr.String())
+	assert.Equal(t, "hello", body)
+
+	// 没有可信代理配置时必须带PROXY头
+	_, _, err = accept(nil, "hello")
+	assert.Error(t, err)
+
+	// 不是来自可信代理的连接按直连处理,不解析PROXY头
+	trusted, err := iptool.NewTrustedProxies([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	addr, body, err = accept(trusted, "PROXY TCP4 192.168.1.1 192.168.1.2 5000 443\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", addr.(*net.TCPAddr).IP.String())
+	assert.Equal(t, "PROXY TCP4 192.168.1.1 192.168.1.2 5000 443\r\n", body)
+}
@@ -0,0 +1,265 @@
+// Package network WebTransport(HTTP/3)连接
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// WebTransport(draft-ietf-webtrans-http3)使用的HTTP/3扩展
+const (
+	wtProtocol           = "webtransport" // 扩展CONNECT的:protocol
+	wtFrameStream        = 0x41           // WebTransport双向流开头的帧类型(后跟会话ID)
+	wtSettingEnable      = 0x2b603742     // SETTINGS_ENABLE_WEBTRANSPORT(draft-02)
+	wtSettingMaxSessions = 0xc671706a     // SETTINGS_WEBTRANSPORT_MAX_SESSIONS(draft-07之后)
+)
+
+// wtSettings 服务端和客户端都需要发送的HTTP/3设置(每个连接一个会话)
+var wtSettings = map[uint64]uint64{wtSettingEnable: 1, wtSettingMaxSessions: 1}
+
+// TopicWriter 支持按topic选择发送通道的连接(如quic的多个流)
+type TopicWriter interface {
+	WriteTopic(topic string, b []byte) (int, error)
+}
+
+// QUICStream WebTransport会话中的一个双向流
+type QUICStream struct {
+	*quic.Stream
+}
+
+// wtStream 客户端打开的WebTransport流及其所属会话
+type wtStream struct {
+	session quic.StreamID
+	stream  *quic.Stream
+}
+
+// QUICConn WebTransport会话(基于HTTP/3,浏览器可以通过WebTransport API连接)
+// 每个quic连接只能建立一个会话,客户端打开的第一个双向流为主流,Read/Write都在主流上进行;
+// 客户端可以再打开其他双向流(如聊天与战斗分开),gate按模块把下行消息发送到该模块最后使用的流上;
+// 开启gate的SecureCipher时,客户端也需按流分别校验接收序号(发送序号在所有流中递增)
+type QUICConn struct {
+	conn      *quic.Conn
+	sessionID quic.StreamID // 建立会话的CONNECT请求流
+	incoming  chan wtStream // 客户端打开的流(只在服务端)
+	main      *QUICStream
+	lock      sync.Mutex
+	routes    map[string]*QUICStream // 模块类型 -> 流
+	readDL    time.Time
+	closeOnce sync.Once
+}
+
+func newQUICConn(conn *quic.Conn, sessionID quic.StreamID, main *quic.Stream) *QUICConn {
+	return &QUICConn{
+		conn:      conn,
+		sessionID: sessionID,
+		main:      &QUICStream{Stream: main},
+		routes:    map[string]*QUICStream{},
+	}
+}
+
+// DialQUIC 建立WebTransport会话并打开主流(原生客户端及测试使用,rawurl如"https://127.0.0.1:4433/")
+func DialQUIC(rawurl string, tlsConf *tls.Config) (*QUICConn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf = tlsConf.Clone()
+	tlsConf.NextProtos = []string{http3.NextProtoH3}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, u.Host, tlsConf, &quic.Config{EnableDatagrams: true})
+	if err != nil {
+		return nil, err
+	}
+	session, err := dialWebTransport(ctx, conn, u)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+	c := newQUICConn(conn, session.StreamID(), nil)
+	main, err := c.OpenStream()
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+	c.main = main
+	go c.watchSession(session)
+	return c, nil
+}
+
+// dialWebTransport 发送扩展CONNECT请求建立会话,返回会话的请求流
+func dialWebTransport(ctx context.Context, conn *quic.Conn, u *url.URL) (*http3.RequestStream, error) {
+	tr := &http3.Transport{EnableDatagrams: true, AdditionalSettings: wtSettings}
+	cc := tr.NewClientConn(conn)
+	select {
+	case <-cc.ReceivedSettings():
+	case <-conn.Context().Done(): // 服务端拒绝连接(如超过最大连接数)
+		return nil, context.Cause(conn.Context())
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !cc.Settings().EnableExtendedConnect {
+		return nil, fmt.Errorf("webtransport: server didn't enable extended CONNECT")
+	}
+	str, err := cc.OpenRequestStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{Method: http.MethodConnect, Proto: wtProtocol, Host: u.Host, URL: u,
+		Header: http.Header{"Sec-Webtransport-Http3-Draft02": {"1"}}}
+	if err := str.SendRequestHeader(req); err != nil {
+		return nil, err
+	}
+	rsp, err := str.ReadResponse()
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return nil, fmt.Errorf("webtransport: server responded with %d", rsp.StatusCode)
+	}
+	return str, nil
+}
+
+// watchSession 会话的请求流结束(对端关闭会话)时关闭连接
+func (c *QUICConn) watchSession(session io.Reader) {
+	io.Copy(io.Discard, session)
+	c.Close()
+}
+
+// quicRouteKey topic所属的模块类型(与gate默认路由的解析规则一致)
+func quicRouteKey(topic string) string {
+	if i := strings.IndexAny(topic, "/_"); i >= 0 {
+		return topic[:i]
+	}
+	return topic
+}
+
+// MainStream 主流
+func (c *QUICConn) MainStream() *QUICStream { return c.main }
+
+// OpenStream 打开新的流(客户端使用)
+func (c *QUICConn) OpenStream() (*QUICStream, error) {
+	stream, err := c.conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	// 流开头标明所属的会话,服务端立即可以接收到该流
+	head := quicvarint.Append(nil, wtFrameStream)
+	head = quicvarint.Append(head, uint64(c.sessionID))
+	if _, err := stream.Write(head); err != nil {
+		stream.CancelWrite(0)
+		return nil, err
+	}
+	return &QUICStream{Stream: stream}, nil
+}
+
+// AcceptStream 等待客户端打开的新流(连接关闭时返回错误)
+func (c *QUICConn) AcceptStream() (*QUICStream, error) {
+	if c.incoming == nil {
+		return nil, fmt.Errorf("webtransport: accept stream is only supported on the server")
+	}
+	for {
+		select {
+		case s := <-c.incoming:
+			if s.session == c.sessionID {
+				return &QUICStream{Stream: s.stream}, nil
+			}
+			s.stream.CancelRead(quic.StreamErrorCode(http3.ErrCodeIDError))
+			s.stream.CancelWrite(quic.StreamErrorCode(http3.ErrCodeIDError))
+		case <-c.Done():
+			return nil, c.conn.Context().Err()
+		}
+	}
+}
+
+// Route 该topic所属模块的下行消息改为通过stream发送
+func (c *QUICConn) Route(topic string, stream *QUICStream) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.routes[quicRouteKey(topic)] = stream
+}
+
+// WriteTopic 按topic所属模块选择流发送(未指定时使用主流)
+func (c *QUICConn) WriteTopic(topic string, b []byte) (int, error) {
+	c.lock.Lock()
+	stream, ok := c.routes[quicRouteKey(topic)]
+	c.lock.Unlock()
+	if !ok {
+		stream = c.main
+	}
+	return stream.Write(b)
+}
+
+// Done 连接关闭时关闭的chan
+func (c *QUICConn) Done() <-chan struct{} { return c.conn.Context().Done() }
+
+// ReadDeadline 当前的读取超时时间
+func (c *QUICConn) ReadDeadline() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.readDL
+}
+
+// Close 关闭会话及quic连接(每个连接只有一个会话)
+func (c *QUICConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.conn.CloseWithError(0, "")
+	})
+	return nil
+}
+
+// Write 在主流上发送
+func (c *QUICConn) Write(b []byte) (int, error) { return c.main.Write(b) }
+
+// Read 在主流上读取
+func (c *QUICConn) Read(b []byte) (int, error) {
+	c.main.SetReadDeadline(c.ReadDeadline())
+	return c.main.Read(b)
+}
+
+// webtransport not support ReadMessage
+func (c *QUICConn) ReadMessage() (messageType int, p []byte, err error) {
+	return 0, nil, fmt.Errorf("not impl")
+}
+
+// LocalAddr 本地socket端口地址
+func (c *QUICConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr 远程socket端口地址
+func (c *QUICConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// SetDeadline A zero value for t means I/O operations will not time out.
+func (c *QUICConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置读取超时(对之后的Read生效;直接读取各个流时由读取方按ReadDeadline处理)
+func (c *QUICConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readDL = t
+	return nil
+}
+
+// SetWriteDeadline 设置所有流的发送超时
+func (c *QUICConn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, stream := range c.routes {
+		stream.SetWriteDeadline(t)
+	}
+	return c.main.SetWriteDeadline(t)
+}
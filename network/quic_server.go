@@ -0,0 +1,226 @@
+// Package network WebTransport(HTTP/3)服务器
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudapex/river/log"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// QUICServer WebTransport服务器(基于HTTP/3,必须使用tls)
+// 浏览器通过 new WebTransport("https://host:port/path") 连接,证书需被浏览器信任(或使用serverCertificateHashes);
+// 每个quic连接只接受一个会话,MaxConnNum/MaxConnPerIP按quic连接计数
+type QUICServer struct {
+	Addr           string
+	Path           string // 接受会话的路径(空不限制)
+	AllowedOrigins []string
+	CertFile       string
+	KeyFile        string
+	TLSOptions     TLSOptions  // tls配置(未配置证书时使用CertFile/KeyFile)
+	TLSConfig      *tls.Config // 优先于TLSOptions
+	MaxConnNum     int
+	IdleTimeout    time.Duration // 无数据的最大空闲时间(默认30s)
+	NewAgent       func(*QUICConn) Client
+	ln             *quic.Listener
+	h3             *http3.Server
+	conns          sync.Map // quic.ConnectionTracingID -> *wtConnState
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wgLn           sync.WaitGroup
+	wgConns        sync.WaitGroup
+
+	MaxConnPerIP int // 单个IP允许的最大连接数(0不限制)
+	ipConns      ipConnCounter
+}
+
+// wtConnState quic连接上的会话状态
+type wtConnState struct {
+	conn     *quic.Conn
+	claimed  atomic.Bool   // 是否已建立会话
+	incoming chan wtStream // 客户端打开的WebTransport流
+}
+
+// Start 开始WebTransport监听
+func (server *QUICServer) Start() {
+	server.init()
+	log.Info("WebTransport Listen :%s", server.Addr)
+	go server.run()
+}
+
+func (server *QUICServer) init() {
+	if server.NewAgent == nil {
+		log.Error("NewConnAgent must not be nil")
+		panic(fmt.Sprintf("QUICServer.NewConnAgent must not be nil"))
+	}
+	tlsConf := server.TLSConfig
+	if tlsConf == nil {
+		var err error
+		tlsConf, err = NewTLSConfig(server.TLSOptions.WithDefaultCert(server.CertFile, server.KeyFile))
+		if err != nil {
+			log.Error("quic_server tls :%v", err)
+			panic(fmt.Sprintf("QUICServer.Start.TLS err:%v", err))
+		}
+	}
+
+	ln, err := quic.ListenAddr(server.Addr, http3.ConfigureTLSConfig(tlsConf), &quic.Config{
+		MaxIdleTimeout:  server.IdleTimeout,
+		KeepAlivePeriod: server.IdleTimeout / 2,
+		EnableDatagrams: true,
+	})
+	if err != nil {
+		log.Error("%v", err)
+		panic(fmt.Sprintf("QUICServer.Start.Listen err:%v", err))
+	}
+	server.ln = ln
+	server.h3 = &http3.Server{
+		Handler:            http.HandlerFunc(server.serveSession),
+		EnableDatagrams:    true,
+		AdditionalSettings: wtSettings,
+		StreamHijacker:     server.hijackStream,
+	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+}
+
+// LocalAddr 监听地址(Addr端口为0时获取实际端口)
+func (server *QUICServer) LocalAddr() net.Addr { return server.ln.Addr() }
+
+func (server *QUICServer) run() {
+	server.wgLn.Add(1)
+	defer server.wgLn.Done()
+
+	var connNum int32
+	for {
+		conn, err := server.ln.Accept(server.ctx)
+		if err != nil {
+			return
+		}
+		current := atomic.LoadInt32(&connNum)
+		if server.MaxConnNum > 0 && int(current) >= server.MaxConnNum {
+			log.Warning("QUIC Server reach max connection number:%d, current:%d", server.MaxConnNum, current)
+			conn.CloseWithError(0, "reach max connection num")
+			continue
+		}
+		ip := addrIP(conn.RemoteAddr().String())
+		if !server.ipConns.add(ip, server.MaxConnPerIP) {
+			log.Warning("QUIC Server reach max connection number per ip:%d, ip:%s", server.MaxConnPerIP, ip)
+			conn.CloseWithError(0, "reach max connection num per ip")
+			continue
+		}
+		atomic.AddInt32(&connNum, 1)
+
+		id := conn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+		server.conns.Store(id, &wtConnState{conn: conn, incoming: make(chan wtStream, 16)})
+		server.wgConns.Add(1)
+		go func() {
+			defer func() {
+				server.conns.Delete(id)
+				atomic.AddInt32(&connNum, -1)
+				server.ipConns.done(ip)
+				server.wgConns.Done()
+			}()
+			// 客户端一直不建立会话时由IdleTimeout关闭连接
+			server.h3.ServeQUICConn(conn)
+			conn.CloseWithError(0, "")
+		}()
+	}
+}
+
+// hijackStream 接管客户端打开的WebTransport双向流(其他流交给HTTP/3处理)
+func (server *QUICServer) hijackStream(ft http3.FrameType, id quic.ConnectionTracingID, stream *quic.Stream, err error) (bool, error) {
+	if err != nil || ft != wtFrameStream {
+		return false, nil
+	}
+	v, ok := server.conns.Load(id)
+	if !ok {
+		return false, nil
+	}
+	state := v.(*wtConnState)
+	sessionID, err := quicvarint.Read(quicvarint.NewReader(stream))
+	if err != nil {
+		stream.CancelRead(quic.StreamErrorCode(http3.ErrCodeGeneralProtocolError))
+		stream.CancelWrite(quic.StreamErrorCode(http3.ErrCodeGeneralProtocolError))
+		return true, nil
+	}
+	// 会话可能还未建立(流先于CONNECT请求到达),先缓存
+	select {
+	case state.incoming <- wtStream{session: quic.StreamID(sessionID), stream: stream}:
+	default:
+		stream.CancelRead(quic.StreamErrorCode(http3.ErrCodeExcessiveLoad))
+		stream.CancelWrite(quic.StreamErrorCode(http3.ErrCodeExcessiveLoad))
+	}
+	return true, nil
+}
+
+// serveSession 处理建立WebTransport会话的扩展CONNECT请求,会话结束后返回
+func (server *QUICServer) serveSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect || r.Proto != wtProtocol {
+		http.Error(w, "webtransport only", http.StatusBadRequest)
+		return
+	}
+	if server.Path != "" && r.URL.Path != server.Path {
+		http.NotFound(w, r)
+		return
+	}
+	if !originAllowed(server.AllowedOrigins, r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	hconn := w.(http3.Hijacker).Connection()
+	v, ok := server.conns.Load(hconn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID))
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	state := v.(*wtConnState)
+	if !state.claimed.CompareAndSwap(false, true) {
+		http.Error(w, "one session per connection", http.StatusTooManyRequests)
+		return
+	}
+	w.Header().Set("Sec-Webtransport-Http3-Draft", "draft02")
+	w.WriteHeader(http.StatusOK)
+	session := w.(http3.HTTPStreamer).HTTPStream()
+
+	conn := newQUICConn(state.conn, session.StreamID(), nil)
+	conn.incoming = state.incoming
+	go conn.watchSession(session)
+	// 等待客户端打开主流
+	accepted := make(chan *QUICStream, 1)
+	go func() {
+		if stream, err := conn.AcceptStream(); err == nil {
+			accepted <- stream
+		}
+	}()
+	select {
+	case conn.main = <-accepted:
+	case <-time.After(10 * time.Second):
+		conn.Close()
+		return
+	case <-conn.Done():
+		return
+	}
+	agent := server.NewAgent(conn)
+	agent.Run()
+
+	// cleanup
+	conn.Close()
+	agent.OnClose()
+}
+
+// Close 关闭WebTransport监听
+func (server *QUICServer) Close() {
+	server.cancel()
+	server.ln.Close()
+	server.h3.Close()
+	server.wgLn.Wait()
+	server.wgConns.Wait()
+}
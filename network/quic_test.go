@@ -0,0 +1,190 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTLSConfig 自签名证书
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// quicTestAgent 把连接交给测试,等待连接关闭
+type quicTestAgent struct{ conn *QUICConn }
+
+func (a *quicTestAgent) Run() error {
+	<-a.conn.Done()
+	return nil
+}
+
+func (a *quicTestAgent) OnClose() error { return nil }
+
+func newTestQUICServer(t *testing.T, maxConn int) (*QUICServer, chan *QUICConn) {
+	conns := make(chan *QUICConn, 10)
+	server := &QUICServer{Addr: "127.0.0.1:0", TLSConfig: testTLSConfig(t), MaxConnNum: maxConn, IdleTimeout: 5 * time.Second,
+		NewAgent: func(c *QUICConn) Client {
+			conns <- c
+			return &quicTestAgent{conn: c}
+		}}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, conns
+}
+
+// quicTestURL 服务器的WebTransport地址
+func quicTestURL(server *QUICServer, path string) string {
+	return "https://" + server.LocalAddr().String() + path
+}
+
+func dialTestQUIC(t *testing.T, server *QUICServer) *QUICConn {
+	conn, err := DialQUIC(quicTestURL(server, "/"), &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	// 客户端打开的流在发送数据后服务端才能接收到
+	_, err = conn.Write([]byte("hi"))
+	assert.NoError(t, err)
+	return conn
+}
+
+func readN(t *testing.T, r io.Reader, n int) string {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	assert.NoError(t, err)
+	return string(buf)
+}
+
+func TestQUICStreams(t *testing.T) {
+	server, conns := newTestQUICServer(t, 0)
+	client := dialTestQUIC(t, server)
+	sc := <-conns
+	assert.Equal(t, "hi", readN(t, sc, 2))
+
+	// 未指定流的topic在主流上发送
+	_, err := sc.WriteTopic("chat/say", []byte("main"))
+	assert.NoError(t, err)
+	assert.Equal(t, "main", readN(t, client.MainStream(), 4))
+
+	// 客户端在其他流上发送过的模块改为在该流上发送
+	battle, err := client.OpenStream()
+	assert.NoError(t, err)
+	_, err = battle.Write([]byte("fight"))
+	assert.NoError(t, err)
+	ss, err := sc.AcceptStream()
+	assert.NoError(t, err)
+	assert.Equal(t, "fight", readN(t, ss, 5))
+	sc.Route("battle/attack", ss)
+
+	_, err = sc.WriteTopic("battle_hit", []byte("hit"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hit", readN(t, battle, 3))
+	_, err = sc.WriteTopic("chat/say", []byte("chat"))
+	assert.NoError(t, err)
+	assert.Equal(t, "chat", readN(t, client.MainStream(), 4))
+}
+
+func TestQUICReadDeadline(t *testing.T) {
+	server, conns := newTestQUICServer(t, 0)
+	dialTestQUIC(t, server)
+	sc := <-conns
+	sc.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 10)
+	_, err := io.ReadFull(sc, buf)
+	assert.Error(t, err)
+}
+
+func TestQUICServerLimits(t *testing.T) {
+	server, conns := newTestQUICServer(t, 1)
+	dialTestQUIC(t, server)
+	<-conns
+
+	// 超过MaxConnNum的连接被关闭
+	conn, err := DialQUIC(quicTestURL(server, "/"), &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		conn.Write([]byte("hi"))
+		select {
+		case <-conn.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("connection over MaxConnNum not closed")
+		}
+	}
+
+}
+
+func TestQUICWebTransportSession(t *testing.T) {
+	server, conns := newTestQUICServer(t, 0)
+	server.Path = "/river"
+	server.AllowedOrigins = []string{"https://game.example.com"}
+	tlsConf := &tls.Config{InsecureSkipVerify: true}
+
+	// 路径不符的会话被拒绝
+	_, err := DialQUIC(quicTestURL(server, "/other"), tlsConf)
+	assert.Error(t, err)
+
+	// 普通HTTP/3请求不能建立会话
+	tr := &http3.Transport{TLSClientConfig: tlsConf}
+	defer tr.Close()
+	rsp, err := tr.RoundTrip(httptest.NewRequest(http.MethodGet, quicTestURL(server, "/river"), nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+		rsp.Body.Close()
+	}
+
+	// 客户端关闭会话后服务端连接关闭
+	client, err := DialQUIC(quicTestURL(server, "/river"), tlsConf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = client.Write([]byte("hi"))
+	assert.NoError(t, err)
+	sc := <-conns
+	assert.Equal(t, "hi", readN(t, sc, 2))
+	client.Close()
+	select {
+	case <-sc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server session not closed")
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	cases := []struct {
+		origins []string
+		origin  string
+		allowed bool
+	}{
+		{nil, "https://a.com", true},
+		{[]string{"https://a.com"}, "", true},
+		{[]string{"https://a.com"}, "https://a.com", true},
+		{[]string{"https://a.com"}, "http://a.com", false},
+		{[]string{"*.example.com"}, "https://game.example.com", true},
+		{[]string{"*.example.com"}, "https://example.com", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.allowed, originAllowed(c.origins, c.origin), "%v %s", c.origins, c.origin)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cloudapex/river/log"
+	"github.com/cloudapex/river/tools/iptool"
 )
 
 // TCPServer tcp服务器
@@ -24,6 +25,14 @@ type TCPServer struct {
 	ln       net.Listener
 	wgLn     sync.WaitGroup
 	wgConns  sync.WaitGroup
+
+	MaxConnPerIP int // 单个IP允许的最大连接数(0不限制)
+	ipConns      ipConnCounter
+
+	TLSOptions TLSOptions // 开启TLS时的配置(未配置证书时使用CertFile/KeyFile)
+
+	ProxyProtocol  bool                   // 是否解析PROXY protocol(v1/v2)头获取客户端真实地址
+	TrustedProxies *iptool.TrustedProxies // 可信代理(为空时所有连接都必须带PROXY头)
 }
 
 // Start 开始tcp监听
@@ -44,16 +53,18 @@ func (server *TCPServer) init() {
 		log.Error("NewConnAgent must not be nil")
 		panic(fmt.Sprintf("TCPServer.NewConnAgent must not be nil"))
 	}
+	if server.ProxyProtocol { // PROXY头在tls握手之前
+		ln = newProxyListener(ln, server.TrustedProxies)
+	}
 	if server.TLS {
-		tlsConf := new(tls.Config)
-		tlsConf.Certificates = make([]tls.Certificate, 1)
-		tlsConf.Certificates[0], err = tls.LoadX509KeyPair(server.CertFile, server.KeyFile)
-		if err == nil {
-			ln = tls.NewListener(ln, tlsConf)
-			log.Info("TCP Listen TLS load success")
-		} else {
-			log.Warning("tcp_server tls :%v", err)
+		tlsConf, err := NewTLSConfig(server.TLSOptions.WithDefaultCert(server.CertFile, server.KeyFile))
+		if err != nil { // 不能退化为明文
+			ln.Close()
+			log.Error("tcp_server tls :%v", err)
+			panic(fmt.Sprintf("TCPServer.Start.TLS err:%v", err))
 		}
+		ln = tls.NewListener(ln, tlsConf)
+		log.Info("TCP Listen TLS load success")
 	}
 
 	server.ln = ln
@@ -90,15 +101,23 @@ func (server *TCPServer) run() {
 			continue
 		}
 		atomic.AddInt32(&connNum, 1)
-
-		tcpConn := newTCPConn(conn)
-		agent := server.NewAgent(tcpConn)
 		server.wgConns.Add(1)
 		go func() {
 			defer func() {
 				atomic.AddInt32(&connNum, -1)
 				server.wgConns.Done()
 			}()
+			// 开启PROXY protocol时获取地址需要读取PROXY头,不能在Accept协程中进行
+			ip := addrIP(conn.RemoteAddr().String())
+			if !server.ipConns.add(ip, server.MaxConnPerIP) {
+				log.Warning("TCP Server reach max connection number per ip:%d, ip:%s", server.MaxConnPerIP, ip)
+				conn.Close()
+				return
+			}
+			defer server.ipConns.done(ip)
+
+			tcpConn := newTCPConn(conn)
+			agent := server.NewAgent(tcpConn)
 			agent.Run()
 
 			// cleanup
@@ -0,0 +1,212 @@
+// Package network tls配置
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudapex/river/log"
+)
+
+// 客户端证书验证方式
+const (
+	TLSClientAuthRequest          = "request"            // 请求客户端证书(不验证)
+	TLSClientAuthRequire          = "require"            // 必须有客户端证书(不验证)
+	TLSClientAuthVerifyIfGiven    = "verify_if_given"    // 有客户端证书时验证
+	TLSClientAuthRequireAndVerify = "require_and_verify" // 必须有客户端证书并验证(配置了ClientCAFile时的默认值)
+)
+
+// TLSCertificate 证书文件
+type TLSCertificate struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// TLSOptions tls配置(tcp/ws/quic网关和hapi共用)
+type TLSOptions struct {
+	CertFile       string           `json:"cert_file"`       // 默认证书
+	KeyFile        string           `json:"key_file"`        // 默认证书的私钥
+	Certificates   []TLSCertificate `json:"certificates"`    // 其他证书(按客户端SNI选择,都不匹配时使用默认证书)
+	MinVersion     string           `json:"min_version"`     // 最低版本(1.2/1.3,默认1.2)
+	CipherSuites   []string         `json:"cipher_suites"`   // TLS1.2允许的加密套件(tls.CipherSuites()中的名称,空为go默认)
+	ClientCAFile   string           `json:"client_ca_file"`  // 双向认证: 验证客户端证书的CA
+	ClientAuth     string           `json:"client_auth"`     // 客户端证书验证方式(TLSClientAuthXxx)
+	ReloadInterval int              `json:"reload_interval"` // 检查证书文件变化的间隔(秒,默认10,<0不检查)
+}
+
+// ParseTLSOptions 解析settings中的tls配置(json对象)
+func ParseTLSOptions(v any) (TLSOptions, error) {
+	o := TLSOptions{}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return o, err
+	}
+	err = json.Unmarshal(data, &o)
+	return o, err
+}
+
+// WithDefaultCert 未配置默认证书时使用certFile/keyFile
+func (o TLSOptions) WithDefaultCert(certFile, keyFile string) TLSOptions {
+	if o.CertFile == "" {
+		o.CertFile, o.KeyFile = certFile, keyFile
+	}
+	return o
+}
+
+// NewTLSConfig 按配置创建tls.Config(证书文件变化时自动重新加载)
+func NewTLSConfig(o TLSOptions) (*tls.Config, error) {
+	files := []TLSCertificate{}
+	if o.CertFile != "" {
+		files = append(files, TLSCertificate{CertFile: o.CertFile, KeyFile: o.KeyFile})
+	}
+	files = append(files, o.Certificates...)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("tls certificate not configured")
+	}
+	reloader := &certReloader{files: files, interval: 10 * time.Second}
+	if o.ReloadInterval != 0 {
+		reloader.interval = time.Duration(o.ReloadInterval) * time.Second
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{GetCertificate: reloader.getCertificate}
+	switch o.MinVersion {
+	case "", "1.2":
+		conf.MinVersion = tls.VersionTLS12
+	case "1.3":
+		conf.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("tls min version %q not supported", o.MinVersion)
+	}
+	if len(o.CipherSuites) > 0 {
+		suites := map[string]uint16{}
+		for _, s := range tls.CipherSuites() { // 只允许安全的套件
+			suites[s.Name] = s.ID
+		}
+		for _, name := range o.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("tls cipher suite %q not supported", name)
+			}
+			conf.CipherSuites = append(conf.CipherSuites, id)
+		}
+	}
+	if o.ClientCAFile != "" {
+		pem, err := os.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls client ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls client ca: no certificate found in %s", o.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	switch o.ClientAuth {
+	case "":
+	case TLSClientAuthRequest:
+		conf.ClientAuth = tls.RequestClientCert
+	case TLSClientAuthRequire:
+		conf.ClientAuth = tls.RequireAnyClientCert
+	case TLSClientAuthVerifyIfGiven:
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+	case TLSClientAuthRequireAndVerify:
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("tls client auth %q not supported", o.ClientAuth)
+	}
+	if conf.ClientAuth >= tls.VerifyClientCertIfGiven && conf.ClientCAs == nil {
+		return nil, fmt.Errorf("tls client auth %q requires client_ca_file", o.ClientAuth)
+	}
+	return conf, nil
+}
+
+// certReloader 证书文件变化时重新加载
+type certReloader struct {
+	files     []TLSCertificate
+	interval  time.Duration
+	lock      sync.RWMutex
+	certs     []*tls.Certificate
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+// load 加载所有证书
+func (r *certReloader) load() error {
+	certs := make([]*tls.Certificate, 0, len(r.files))
+	modTimes := make([]time.Time, 0, len(r.files))
+	for _, f := range r.files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("tls load %s: %v", f.CertFile, err)
+		}
+		certs = append(certs, &cert)
+		modTimes = append(modTimes, r.modTime(f))
+	}
+	r.lock.Lock()
+	r.certs, r.modTimes, r.lastCheck = certs, modTimes, time.Now()
+	r.lock.Unlock()
+	return nil
+}
+
+// modTime 证书和私钥文件中最后的修改时间
+func (r *certReloader) modTime(f TLSCertificate) time.Time {
+	var t time.Time
+	for _, name := range []string{f.CertFile, f.KeyFile} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(t) {
+			t = info.ModTime()
+		}
+	}
+	return t
+}
+
+// check 到检查间隔时,证书文件有变化则重新加载(加载失败继续使用旧证书)
+func (r *certReloader) check() {
+	if r.interval < 0 {
+		return
+	}
+	r.lock.Lock()
+	if time.Since(r.lastCheck) < r.interval {
+		r.lock.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	changed := false
+	for i, f := range r.files {
+		if !r.modTime(f).Equal(r.modTimes[i]) {
+			changed = true
+			break
+		}
+	}
+	r.lock.Unlock()
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		log.Error("tls reload certificate err:%v", err)
+		return
+	}
+	log.Info("tls certificate reloaded")
+}
+
+func (r *certReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.check()
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if hello.ServerName != "" {
+		for _, cert := range r.certs {
+			if hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return r.certs[0], nil
+}
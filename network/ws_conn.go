@@ -8,7 +8,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/cloudapex/river/tools/iptool"
 	"github.com/gorilla/websocket"
 )
 
@@ -27,14 +26,19 @@ type WSConn struct {
 	io.Writer //Write(p []byte) (n int, err error)
 	sync.Mutex
 	header    http.Header // 只保存 请求时的header
+	ip        string      // 客户端真实IP
+	values    map[string]string
 	conn      *websocket.Conn
 	closeFlag bool
+
+	compressThreshold int // 协商了permessage-deflate时,消息超过该字节数才压缩
 }
 
-func newWSConn(conn *websocket.Conn, r *http.Request) *WSConn {
+func newWSConn(conn *websocket.Conn, r *http.Request, ip string) *WSConn {
 	wsConn := new(WSConn)
 	wsConn.conn = conn
 	wsConn.header = r.Header.Clone()
+	wsConn.ip = ip
 	return wsConn
 }
 
@@ -42,6 +46,12 @@ func (wsConn *WSConn) Conn() *websocket.Conn {
 	return wsConn.conn
 }
 
+// Subprotocol 协商的子协议(Sec-WebSocket-Protocol)
+func (wsConn *WSConn) Subprotocol() string { return wsConn.conn.Subprotocol() }
+
+// HandshakeValues 握手钩子返回的值
+func (wsConn *WSConn) HandshakeValues() map[string]string { return wsConn.values }
+
 // Close 关闭连接
 func (wsConn *WSConn) Close() error {
 	wsConn.Lock()
@@ -55,6 +65,8 @@ func (wsConn *WSConn) Close() error {
 
 // Write Write
 func (wsConn *WSConn) Write(p []byte) (int, error) {
+	// 未协商permessage-deflate时该设置无效
+	wsConn.conn.EnableWriteCompression(len(p) >= wsConn.compressThreshold)
 	err := wsConn.conn.WriteMessage(websocket.BinaryMessage, p)
 	return len(p), err
 }
@@ -80,7 +92,7 @@ func (wsConn *WSConn) LocalAddr() net.Addr {
 
 // RemoteAddr 获取远程socket地址
 func (wsConn *WSConn) RemoteAddr() net.Addr {
-	return &Addr{ip: iptool.RealIP(&http.Request{Header: wsConn.header, RemoteAddr: wsConn.conn.RemoteAddr().String()})}
+	return &Addr{ip: wsConn.ip}
 }
 
 // SetDeadline A zero value for t means I/O operations will not time out.
@@ -6,21 +6,27 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/cloudapex/river/log"
+	"github.com/cloudapex/river/tools/iptool"
 	"github.com/gorilla/websocket"
 )
 
 // WSHandler websocket 处理器
 type WSHandler struct {
-	newConnAgent func(*WSConn) Client
+	newConnAgent      func(*WSConn) Client
+	compressThreshold int
 }
 
-func (handler *WSHandler) work(conn *websocket.Conn, r *http.Request) {
-	wsConn := newWSConn(conn, r)
+func (handler *WSHandler) work(conn *websocket.Conn, r *http.Request, ip string, values map[string]string) {
+	wsConn := newWSConn(conn, r, ip)
+	wsConn.values = values
+	wsConn.compressThreshold = handler.compressThreshold
 	agent := handler.newConnAgent(wsConn)
 	agent.Run()
 
@@ -44,6 +50,73 @@ type WSServer struct {
 	ShakeFunc   func(r *http.Request) error
 	wgConns     sync.WaitGroup
 	httpServer  *http.Server // 添加 HTTP 服务器实例
+
+	MaxConnPerIP int // 单个IP允许的最大连接数(0不限制)
+	ipConns      ipConnCounter
+
+	EnableCompression bool // 是否开启permessage-deflate(客户端支持时生效)
+	CompressThreshold int  // 开启压缩时,消息超过该字节数才压缩(0全部压缩)
+
+	TLSOptions TLSOptions // 开启TLS时的配置(未配置证书时使用CertFile/KeyFile)
+
+	ProxyProtocol  bool                   // 是否解析PROXY protocol(v1/v2)头获取客户端真实地址
+	TrustedProxies *iptool.TrustedProxies // 可信代理: 只采信来自可信代理的PROXY头和X-Forwarded-For/X-Real-IP
+
+	AllowedOrigins  []string // 允许的Origin(空不限制;支持"*"和"*.example.com"/"https://*.example.com")
+	Subprotocols    []string // 支持的子协议(按优先顺序协商Sec-WebSocket-Protocol)
+	ReadBufferSize  int      // 读缓存大小(默认5KB)
+	WriteBufferSize int      // 写缓存大小(默认5KB)
+
+	// 握手钩子(在ShakeFunc之后): 返回的值保存到连接上(gate放入session的Settings),返回error拒绝连接
+	HandshakeFunc func(r *http.Request) (map[string]string, error)
+}
+
+// checkOrigin 检查Origin是否允许(没有Origin的非浏览器客户端总是允许)
+func (server *WSServer) checkOrigin(r *http.Request) bool {
+	return originAllowed(server.AllowedOrigins, r.Header.Get("Origin"))
+}
+
+// originAllowed Origin是否在允许列表中(列表为空或没有Origin时允许)
+func originAllowed(origins []string, origin string) bool {
+	if len(origins) == 0 || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, allowed := range origins {
+		if allowed == "*" {
+			return true
+		}
+		host := allowed
+		if scheme, rest, ok := strings.Cut(allowed, "://"); ok {
+			if !strings.EqualFold(scheme, u.Scheme) {
+				continue
+			}
+			host = rest
+		}
+		if matchOriginHost(strings.ToLower(host), strings.ToLower(u.Host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOriginHost 匹配host(支持"*."前缀的子域名通配)
+func matchOriginHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasPrefix(suffix, ".") {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return pattern == host
+}
+
+// realIP 客户端真实IP(未配置可信代理时按内网地址判断X-Forwarded-For)
+func (server *WSServer) realIP(r *http.Request) string {
+	if server.TrustedProxies.Empty() {
+		return iptool.RealIP(r)
+	}
+	return server.TrustedProxies.RealIP(r.RemoteAddr, r.Header)
 }
 
 // Start 开启监听websocket端口
@@ -62,30 +135,40 @@ func (server *WSServer) Start() {
 		log.Error("NewConnAgent must not be nil")
 		panic(fmt.Sprintf("TCPServer.NewConnAgent must not be nil"))
 	}
+	if server.ProxyProtocol { // PROXY头在tls握手之前
+		ln = newProxyListener(ln, server.TrustedProxies)
+	}
 	if server.TLS {
-		tlsConf := new(tls.Config)
-		tlsConf.Certificates = make([]tls.Certificate, 1)
-		tlsConf.Certificates[0], err = tls.LoadX509KeyPair(server.CertFile, server.KeyFile)
-		if err == nil {
-			ln = tls.NewListener(ln, tlsConf)
-			log.Info("WS Listen TLS load success")
-		} else {
-			log.Warning("ws_server tls :%v", err)
+		tlsConf, err := NewTLSConfig(server.TLSOptions.WithDefaultCert(server.CertFile, server.KeyFile))
+		if err != nil { // 不能退化为明文
+			ln.Close()
+			log.Error("ws_server tls :%v", err)
+			panic(fmt.Sprintf("WSServer.Start.TLS err:%v", err))
 		}
+		ln = tls.NewListener(ln, tlsConf)
+		log.Info("WS Listen TLS load success")
 	}
 	server.ln = ln
 	server.handler = &WSHandler{
-		newConnAgent: server.NewAgent,
+		newConnAgent:      server.NewAgent,
+		compressThreshold: server.CompressThreshold,
 	}
 
 	// upgrader connect
+	if server.ReadBufferSize <= 0 {
+		server.ReadBufferSize = 1024 * 5
+	}
+	if server.WriteBufferSize <= 0 {
+		server.WriteBufferSize = 1024 * 5
+	}
 	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024 * 5,
-		WriteBufferSize: 1024 * 5,
-		// 开启跨域
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		ReadBufferSize:  server.ReadBufferSize,
+		WriteBufferSize: server.WriteBufferSize,
+
+		EnableCompression: server.EnableCompression,
+		Subprotocols:      server.Subprotocols,
+		// 跨域检查
+		CheckOrigin: server.checkOrigin,
 	}
 
 	var connNum int32 // 连接计数器
@@ -102,6 +185,15 @@ func (server *WSServer) Start() {
 				return
 			}
 		}
+		var values map[string]string
+		if server.HandshakeFunc != nil {
+			var err error
+			if values, err = server.HandshakeFunc(r); err != nil {
+				log.Error("WS client HandshakeFunc err:%v", err)
+				http.Error(w, "HandShake error", http.StatusBadRequest)
+				return
+			}
+		}
 
 		current := atomic.LoadInt32(&connNum)
 		if server.MaxConnNum > 0 && int(current) >= server.MaxConnNum {
@@ -110,10 +202,18 @@ func (server *WSServer) Start() {
 			return
 		}
 
+		ip := server.realIP(r)
+		if !server.ipConns.add(ip, server.MaxConnPerIP) {
+			log.Warning("WS Server reach max connection number per ip:%d, ip:%s", server.MaxConnPerIP, ip)
+			http.Error(w, "reach max connection num per ip", http.StatusTooManyRequests)
+			return
+		}
+
 		// 使用 websocket.Upgrader 升级为 WebSocket 连接
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("clientAcceptor 提升为 websocket 失败, %v", err), http.StatusBadRequest)
+			server.ipConns.done(ip)
+			log.Warning("WS upgrade ip:%s err:%v", ip, err) // upgrader已回复错误(如Origin不允许)
 			return
 		}
 
@@ -130,9 +230,10 @@ func (server *WSServer) Start() {
 		go func() {
 			defer func() {
 				atomic.AddInt32(&connNum, -1)
+				server.ipConns.done(ip)
 				server.wgConns.Done()
 			}()
-			server.handler.work(conn, r)
+			server.handler.work(conn, r, ip, values)
 		}()
 	}
 
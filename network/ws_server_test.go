@@ -0,0 +1,50 @@
+package network
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWSCheckOrigin(t *testing.T) {
+	cases := []struct {
+		name    string
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{"no restriction", nil, "https://evil.com", true},
+		{"no origin header", []string{"example.com"}, "", true},
+		{"any", []string{"*"}, "https://evil.com", true},
+		{"exact host", []string{"example.com"}, "https://example.com", true},
+		{"case insensitive", []string{"Example.COM"}, "https://EXAMPLE.com", true},
+		{"other host", []string{"example.com"}, "https://evil.com", false},
+		{"suffix is not subdomain", []string{"example.com"}, "https://evilexample.com", false},
+		{"wildcard subdomain", []string{"*.example.com"}, "https://a.example.com", true},
+		{"wildcard nested subdomain", []string{"*.example.com"}, "https://a.b.example.com", true},
+		{"wildcard excludes bare domain", []string{"*.example.com"}, "https://example.com", false},
+		{"wildcard excludes lookalike", []string{"*.example.com"}, "https://evilexample.com", false},
+		{"scheme match", []string{"https://example.com"}, "https://example.com", true},
+		{"scheme mismatch", []string{"https://example.com"}, "http://example.com", false},
+		{"scheme with wildcard", []string{"https://*.example.com"}, "https://a.example.com", true},
+		{"scheme mismatch with wildcard", []string{"https://*.example.com"}, "http://a.example.com", false},
+		{"port must be listed", []string{"example.com"}, "https://example.com:8080", false},
+		{"port match", []string{"example.com:8080"}, "https://example.com:8080", true},
+		{"port mismatch", []string{"example.com:8080"}, "https://example.com:9090", false},
+		{"wildcard with port", []string{"*.example.com:8080"}, "https://a.example.com:8080", true},
+		{"one of many", []string{"a.com", "https://b.com"}, "https://b.com", true},
+		{"null origin", []string{"example.com"}, "null", false},
+		{"malformed origin", []string{"example.com"}, "://example.com", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := &WSServer{AllowedOrigins: c.allowed}
+			r := httptest.NewRequest("GET", "/", nil)
+			if c.origin != "" {
+				r.Header.Set("Origin", c.origin)
+			}
+			assert.Equal(t, c.ok, server.checkOrigin(r))
+		})
+	}
+}
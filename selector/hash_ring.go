@@ -0,0 +1,86 @@
+package selector
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+
+	"github.com/cloudapex/river/registry"
+)
+
+// DefaultHashReplicas 一致性哈希环中每个节点的虚拟节点数
+var DefaultHashReplicas = 160
+
+// HashRing 一致性哈希环(节点增删时只有少部分key会迁移)
+type HashRing struct {
+	hashes []uint32
+	nodes  map[uint32]*registry.Node
+	sign   string // 节点集合签名(按节点ID排序拼接)
+}
+
+// NewHashRing 用节点列表构造一致性哈希环(replicas<=0时使用DefaultHashReplicas)
+func NewHashRing(nodes []*registry.Node, replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = DefaultHashReplicas
+	}
+	ring := &HashRing{
+		nodes: make(map[uint32]*registry.Node, len(nodes)*replicas),
+		sign:  NodesSign(nodes),
+	}
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", node.Id, i)))
+			if _, ok := ring.nodes[h]; ok { // 哈希冲突时保留先加入的
+				continue
+			}
+			ring.nodes[h] = node
+			ring.hashes = append(ring.hashes, h)
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+// Get 获取key对应的节点
+func (r *HashRing) Get(key string) (*registry.Node, error) {
+	if len(r.hashes) == 0 {
+		return nil, ErrNoneAvailable
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]], nil
+}
+
+// Sign 节点集合签名(用于判断节点是否发生变化)
+func (r *HashRing) Sign() string { return r.sign }
+
+// NodesSign 计算节点集合签名
+func NodesSign(nodes []*registry.Node) string {
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.Id)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// ConsistentHash is a consistent hashing strategy algorithm for node selection
+// (the same key always selects the same node while the nodes are unchanged)
+func ConsistentHash(key string) Strategy {
+	return func(services []*registry.Service) Next {
+		var nodes []*registry.Node
+
+		for _, service := range services {
+			nodes = append(nodes, service.Nodes...)
+		}
+		ring := NewHashRing(nodes, 0)
+
+		return func() (*registry.Node, error) {
+			return ring.Get(key)
+		}
+	}
+}
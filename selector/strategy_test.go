@@ -1,6 +1,7 @@
 package selector
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/cloudapex/river/registry"
@@ -57,3 +58,43 @@ func TestStrategies(t *testing.T) {
 		t.Logf("%s: %+v\n", name, counts)
 	}
 }
+
+func TestConsistentHash(t *testing.T) {
+	nodes := []*registry.Node{{Id: "test1-1"}, {Id: "test1-2"}, {Id: "test1-3"}}
+	services := []*registry.Service{{Name: "test1", Nodes: nodes}}
+
+	// 同一个key总是选中同一个节点
+	first, err := ConsistentHash("user-1")(services)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		node, _ := ConsistentHash("user-1")(services)()
+		if node.Id != first.Id {
+			t.Fatalf("expected %s got %s", first.Id, node.Id)
+		}
+	}
+
+	// 增加节点只迁移部分key
+	before := NewHashRing(nodes, 0)
+	after := NewHashRing(append(nodes, &registry.Node{Id: "test1-4"}), 0)
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		n1, _ := before.Get(key)
+		n2, _ := after.Get(key)
+		if n1.Id != n2.Id {
+			if n2.Id != "test1-4" {
+				t.Fatalf("key %s moved to old node %s", key, n2.Id)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 500 {
+		t.Fatalf("unexpected moved count %d", moved)
+	}
+
+	if _, err := NewHashRing(nil, 0).Get("user-1"); err != ErrNoneAvailable {
+		t.Fatalf("expected ErrNoneAvailable got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package iptool
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies 可信代理(负载均衡)的网段, 只有来自可信代理的转发头才被采信
+type TrustedProxies struct {
+	blocks []*net.IPNet
+}
+
+// NewTrustedProxies 创建可信代理列表(CIDR或单个IP)
+func NewTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", c)
+			}
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, block, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", c, err)
+		}
+		t.blocks = append(t.blocks, block)
+	}
+	return t, nil
+}
+
+// Empty 没有配置任何可信代理
+func (t *TrustedProxies) Empty() bool { return t == nil || len(t.blocks) == 0 }
+
+// Contains ip(可带端口)是否是可信代理
+func (t *TrustedProxies) Contains(addr string) bool {
+	if t == nil {
+		return false
+	}
+	ip := net.ParseIP(hostOf(addr))
+	if ip == nil {
+		return false
+	}
+	for _, b := range t.blocks {
+		if b.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealIP 客户端的真实IP: 直连地址是可信代理时,从X-Forwarded-For右往左取第一个非可信代理的地址,
+// 没有X-Forwarded-For时取X-Real-IP;否则直连地址即客户端地址
+func (t *TrustedProxies) RealIP(remoteAddr string, header http.Header) string {
+	remote := hostOf(remoteAddr)
+	if !t.Contains(remote) {
+		return remote
+	}
+	if forwarded := header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		ips := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if !CheckIp(ip) {
+				break // 格式错误的地址之前的内容都不可信
+			}
+			if !t.Contains(ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(header.Get("X-Real-IP")); CheckIp(ip) {
+		return ip
+	}
+	return remote
+}
+
+// hostOf 去掉地址中的端口
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
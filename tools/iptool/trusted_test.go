@@ -0,0 +1,37 @@
+package iptool
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	trusted, err := NewTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	assert.NoError(t, err)
+	assert.True(t, trusted.Contains("10.1.2.3:8080"))
+	assert.True(t, trusted.Contains("192.168.1.1"))
+	assert.True(t, trusted.Contains("[::1]:80"))
+	assert.False(t, trusted.Contains("192.168.1.2"))
+
+	_, err = NewTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+
+	header := http.Header{}
+	header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	header.Add("X-Forwarded-For", "10.0.0.2")
+	// 直连不是可信代理时不采信转发头
+	assert.Equal(t, "3.3.3.3", trusted.RealIP("3.3.3.3:1234", header))
+	// 从右往左取第一个非可信代理的地址(左边的可被客户端伪造)
+	assert.Equal(t, "2.2.2.2", trusted.RealIP("10.0.0.1:1234", header))
+
+	header = http.Header{}
+	header.Set("X-Forwarded-For", "10.0.0.3, 10.0.0.2")
+	assert.Equal(t, "10.0.0.3", trusted.RealIP("10.0.0.1:1234", header))
+
+	header = http.Header{}
+	header.Set("X-Real-IP", "4.4.4.4")
+	assert.Equal(t, "4.4.4.4", trusted.RealIP("10.0.0.1:1234", header))
+	assert.Equal(t, "10.0.0.1", trusted.RealIP("10.0.0.1:1234", http.Header{}))
+}
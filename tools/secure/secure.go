@@ -0,0 +1,230 @@
+// Package secure 基于ECDH密钥交换和AEAD的加密通道
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 支持的AEAD算法
+const (
+	CipherAESGCM   = "aes-gcm"
+	CipherChaCha20 = "chacha20-poly1305"
+)
+
+// KeySize 派生的会话key长度
+const KeySize = 32
+
+// ErrReplay 重复或过期的消息
+var ErrReplay = errors.New("secure: replayed or expired message")
+
+// NewAEAD 按算法名创建AEAD(key为32字节)
+func NewAEAD(cipherName string, key []byte) (cipher.AEAD, error) {
+	switch cipherName {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherChaCha20:
+		return chacha20poly1305.New(key)
+	}
+	return nil, fmt.Errorf("secure: unsupported cipher %q", cipherName)
+}
+
+// DeriveKey 从密钥材料派生指定用途的key(HKDF-SHA256)
+func DeriveKey(secret []byte, info string) ([]byte, error) {
+	return hkdf.Key(sha256.New, secret, nil, info, KeySize)
+}
+
+// deriveKeyPSK 用预共享key作为salt派生key(psk为空时同DeriveKey)
+func deriveKeyPSK(secret, psk []byte, info string) ([]byte, error) {
+	return hkdf.Key(sha256.New, secret, psk, info, KeySize)
+}
+
+// NewKeyExchange 创建一次性的ECDH(X25519)密钥对
+func NewKeyExchange() (*KeyExchange, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyExchange{priv: priv}, nil
+}
+
+// KeyExchange ECDH(X25519)密钥交换
+type KeyExchange struct {
+	priv *ecdh.PrivateKey
+}
+
+// PublicKey 发送给对端的公钥(32字节)
+func (k *KeyExchange) PublicKey() []byte { return k.priv.PublicKey().Bytes() }
+
+// Channel 用对端公钥派生会话通道(服务端和客户端的收发key相反)
+// psk为双方预先共享的key(如gate的EncryptKey),混入key派生: 不知道psk的中间人无法得到会话key,
+// 第一条消息就会解密失败; psk为空时密钥交换不做认证,只能防被动窃听
+func (k *KeyExchange) Channel(cipherName string, peerPublic, psk []byte, isServer bool) (*Channel, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerPublic)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := k.priv.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	c2s, err := deriveKeyPSK(secret, psk, "river client to server")
+	if err != nil {
+		return nil, err
+	}
+	s2c, err := deriveKeyPSK(secret, psk, "river server to client")
+	if err != nil {
+		return nil, err
+	}
+	if !isServer {
+		c2s, s2c = s2c, c2s
+	}
+	recv, err := NewAEAD(cipherName, c2s)
+	if err != nil {
+		return nil, err
+	}
+	send, err := NewAEAD(cipherName, s2c)
+	if err != nil {
+		return nil, err
+	}
+	return &Channel{send: send, recv: recv}, nil
+}
+
+// Channel 会话加密通道, 用于有序传输(TCP/WS):
+// 每条消息为[8字节序号][密文], 序号作为nonce, 接收方拒绝序号不递增的消息(防重放)
+// Seal和Open各自只能在一个协程中调用
+type Channel struct {
+	send    cipher.AEAD
+	recv    cipher.AEAD
+	sendSeq uint64
+	recvSeq uint64
+}
+
+// Seal 加密一条消息
+func (c *Channel) Seal(plain []byte) []byte {
+	c.sendSeq++
+	out := make([]byte, 8, 8+len(plain)+c.send.Overhead())
+	binary.LittleEndian.PutUint64(out, c.sendSeq)
+	return c.send.Seal(out, seqNonce(c.send, c.sendSeq), plain, out[:8])
+}
+
+// Open 解密一条消息
+func (c *Channel) Open(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, errors.New("secure: message too short")
+	}
+	seq := binary.LittleEndian.Uint64(data)
+	if seq <= c.recvSeq {
+		return nil, ErrReplay
+	}
+	plain, err := c.recv.Open(nil, seqNonce(c.recv, seq), data[8:], data[:8])
+	if err != nil {
+		return nil, err
+	}
+	c.recvSeq = seq
+	return plain, nil
+}
+
+// Receiver 共享接收key、独立接收序号的通道(只用于Open),用于一个连接的多个有序流(如quic):
+// 发送方的序号在所有流中递增,每个流内的序号仍然递增;跨流的重放由承载的传输(quic的TLS)防止
+func (c *Channel) Receiver() *Channel { return &Channel{recv: c.recv} }
+
+func seqNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.LittleEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// SealMessage 无状态消息加密(用于http): [随机nonce][密文(8字节时间戳+明文)]
+func SealMessage(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+8+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 8, 8+len(plain))
+	binary.LittleEndian.PutUint64(data, uint64(time.Now().Unix()))
+	data = append(data, plain...)
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// OpenMessage 解密SealMessage加密的消息, 返回明文及nonce和时间戳(用于ReplayFilter)
+func OpenMessage(aead cipher.AEAD, data []byte) (plain []byte, nonce []byte, ts time.Time, err error) {
+	if len(data) < aead.NonceSize()+8 {
+		return nil, nil, ts, errors.New("secure: message too short")
+	}
+	nonce = data[:aead.NonceSize()]
+	out, err := aead.Open(nil, nonce, data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, nil, ts, err
+	}
+	if len(out) < 8 {
+		return nil, nil, ts, errors.New("secure: message too short")
+	}
+	ts = time.Unix(int64(binary.LittleEndian.Uint64(out)), 0)
+	return out[8:], nonce, ts, nil
+}
+
+// DefaultReplayFilterSize 防重放过滤器默认最多记录的nonce数
+const DefaultReplayFilterSize = 1 << 20
+
+// NewReplayFilter 创建防重放过滤器(只接受时间戳在window内且nonce未出现过的消息)
+// size为最多记录的nonce数(<=0时为DefaultReplayFilterSize),记录满时拒绝新消息直到过期的nonce被清理
+func NewReplayFilter(window time.Duration, size int) *ReplayFilter {
+	if size <= 0 {
+		size = DefaultReplayFilterSize
+	}
+	return &ReplayFilter{window: window, size: size, seen: map[string]time.Time{}}
+}
+
+// ReplayFilter 无状态消息的防重放过滤器(线程安全)
+type ReplayFilter struct {
+	window time.Duration
+	size   int
+	lock   sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+// ErrReplayFilterFull 防重放过滤器记录已满
+var ErrReplayFilterFull = errors.New("secure: too many messages in replay window")
+
+// Check 检查消息是否重放或过期
+func (f *ReplayFilter) Check(nonce []byte, ts time.Time) error {
+	now := time.Now()
+	if ts.Before(now.Add(-f.window)) || ts.After(now.Add(f.window)) {
+		return ErrReplay
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if now.Sub(f.pruned) > f.window || (len(f.seen) >= f.size && now.Sub(f.pruned) > time.Second) {
+		for k, t := range f.seen {
+			if now.Sub(t) > 2*f.window {
+				delete(f.seen, k)
+			}
+		}
+		f.pruned = now
+	}
+	if _, ok := f.seen[string(nonce)]; ok {
+		return ErrReplay
+	}
+	if len(f.seen) >= f.size {
+		return ErrReplayFilterFull
+	}
+	f.seen[string(nonce)] = now
+	return nil
+}
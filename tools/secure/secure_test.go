@@ -0,0 +1,120 @@
+package secure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannel(t *testing.T) {
+	for _, name := range []string{CipherAESGCM, CipherChaCha20} {
+		server, err := NewKeyExchange()
+		assert.Nil(t, err)
+		client, err := NewKeyExchange()
+		assert.Nil(t, err)
+
+		sc, err := server.Channel(name, client.PublicKey(), nil, true)
+		assert.Nil(t, err)
+		cc, err := client.Channel(name, server.PublicKey(), nil, false)
+		assert.Nil(t, err)
+
+		msg := sc.Seal([]byte("hello"))
+		plain, err := cc.Open(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(plain))
+
+		// 重放被拒绝
+		_, err = cc.Open(msg)
+		assert.Equal(t, ErrReplay, err)
+
+		plain, err = sc.Open(cc.Seal([]byte("world")))
+		assert.Nil(t, err)
+		assert.Equal(t, "world", string(plain))
+	}
+}
+
+func TestSealMessage(t *testing.T) {
+	key, err := DeriveKey([]byte("0123456789abcdef"), "test")
+	assert.Nil(t, err)
+	aead, err := NewAEAD(CipherAESGCM, key)
+	assert.Nil(t, err)
+
+	data, err := SealMessage(aead, []byte("hello"))
+	assert.Nil(t, err)
+	plain, nonce, ts, err := OpenMessage(aead, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(plain))
+
+	filter := NewReplayFilter(time.Minute, 0)
+	assert.Nil(t, filter.Check(nonce, ts))
+	assert.Equal(t, ErrReplay, filter.Check(nonce, ts))
+	assert.Equal(t, ErrReplay, filter.Check([]byte("other"), ts.Add(-time.Hour)))
+}
+
+func TestChannelPSK(t *testing.T) {
+	psk := []byte("0123456789abcdef")
+	server, _ := NewKeyExchange()
+	client, _ := NewKeyExchange()
+	sc, err := server.Channel(CipherAESGCM, client.PublicKey(), psk, true)
+	assert.Nil(t, err)
+	cc, err := client.Channel(CipherAESGCM, server.PublicKey(), psk, false)
+	assert.Nil(t, err)
+	plain, err := sc.Open(cc.Seal([]byte("hello")))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(plain))
+
+	// 中间人分别与双方交换公钥,不知道psk时无法解密也无法伪造消息
+	mitm, _ := NewKeyExchange()
+	toServer, err := mitm.Channel(CipherAESGCM, server.PublicKey(), nil, false)
+	assert.Nil(t, err)
+	sc, err = server.Channel(CipherAESGCM, mitm.PublicKey(), psk, true)
+	assert.Nil(t, err)
+	_, err = sc.Open(toServer.Seal([]byte("forged")))
+	assert.NotNil(t, err)
+
+	toClient, err := mitm.Channel(CipherAESGCM, client.PublicKey(), nil, true)
+	assert.Nil(t, err)
+	cc, err = client.Channel(CipherAESGCM, mitm.PublicKey(), psk, false)
+	assert.Nil(t, err)
+	_, err = toClient.Open(cc.Seal([]byte("secret")))
+	assert.NotNil(t, err)
+}
+
+func TestReplayFilterSize(t *testing.T) {
+	filter := NewReplayFilter(time.Minute, 2)
+	now := time.Now()
+	assert.Nil(t, filter.Check([]byte("a"), now))
+	assert.Nil(t, filter.Check([]byte("b"), now))
+	assert.Equal(t, ErrReplayFilterFull, filter.Check([]byte("c"), now))
+	assert.Equal(t, ErrReplay, filter.Check([]byte("a"), now))
+	assert.Len(t, filter.seen, 2)
+}
+
+func TestChannelReceiver(t *testing.T) {
+	server, _ := NewKeyExchange()
+	client, _ := NewKeyExchange()
+	sc, err := server.Channel(CipherAESGCM, client.PublicKey(), nil, true)
+	assert.Nil(t, err)
+	cc, err := client.Channel(CipherAESGCM, server.PublicKey(), nil, false)
+	assert.Nil(t, err)
+
+	// 客户端按顺序发送到两个流,服务端两个流的包交错到达
+	m1, m2, m3 := cc.Seal([]byte("1")), cc.Seal([]byte("2")), cc.Seal([]byte("3"))
+	rx := sc.Receiver()
+	plain, err := sc.Open(m2)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(plain))
+	plain, err = rx.Open(m1) // 另一个流中序号更小的包
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(plain))
+	plain, err = rx.Open(m3)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", string(plain))
+
+	// 每个流内的重放被拒绝
+	_, err = rx.Open(m3)
+	assert.Equal(t, ErrReplay, err)
+	_, err = sc.Open(m2)
+	assert.Equal(t, ErrReplay, err)
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"sync"
+	"time"
+)
+
+// NewTokenBucket 创建令牌桶(rate每秒生成的令牌数, burst桶容量,<=0时取rate)
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst <= 0 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// TokenBucket 令牌桶限流(线程安全)
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Allow 令牌足够时消耗n个令牌并返回true, 否则不消耗返回false
+func (b *TokenBucket) Allow(n float64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Refund 归还n个令牌(不超过桶容量)
+func (b *TokenBucket) Refund(n float64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens = min(b.tokens+n, b.burst)
+}
+
+// Burst 桶容量
+func (b *TokenBucket) Burst() float64 { return b.burst }
+
+// Reserve 消耗n个令牌(可透支), 返回需要等待多久才能使用
+func (b *TokenBucket) Reserve(n float64) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *TokenBucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
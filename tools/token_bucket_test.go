@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(10, 5)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.Allow(1))
+	}
+	assert.False(t, b.Allow(1))
+
+	time.Sleep(120 * time.Millisecond)
+	assert.True(t, b.Allow(1))
+
+	// 透支后需要等待
+	wait := b.Reserve(3)
+	assert.True(t, wait > 150*time.Millisecond && wait <= 300*time.Millisecond, wait)
+}
+
+func TestTokenBucketRefund(t *testing.T) {
+	b := NewTokenBucket(1, 2)
+	assert.Equal(t, float64(2), b.Burst())
+	assert.True(t, b.Allow(2))
+	b.Refund(1)
+	assert.True(t, b.Allow(1))
+	assert.False(t, b.Allow(1))
+	b.Refund(5) // 不超过桶容量
+	assert.False(t, b.Allow(3))
+	assert.True(t, b.Allow(2))
+}